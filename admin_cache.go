@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/metrics"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEntriesLimit = 50
+	maxEntriesLimit     = 500
+	warmupQueueSize     = 1000
+)
+
+// warmupJob is a single product queued for background warmup.
+type warmupJob struct {
+	store     string
+	productID string
+	refresh   bool
+}
+
+var (
+	warmupQueue = make(chan warmupJob, warmupQueueSize)
+	warmupOnce  sync.Once
+)
+
+// cacheStatsHandler reports entries per store, their age distribution, the
+// hit ratio since startup and the database size.
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := productCache.Stats()
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// cacheEntriesHandler lists cached products page by page, optionally only
+// for one store or only stale ones.
+func cacheEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	store := strings.ToLower(query.Get("store"))
+	if store != "" && !slices.Contains(supportedStores, store) {
+		api.WriteBadRequest(w, "Store not supported. Available: "+strings.Join(supportedStores, ", "), r.URL.Path)
+		return
+	}
+
+	staleOnly := false
+	if val := query.Get("stale"); val != "" {
+		parsed, err := strconv.ParseBool(val)
+		if err != nil {
+			api.WriteBadRequest(w, "Invalid stale value: "+val+". Must be true or false.", r.URL.Path)
+			return
+		}
+		staleOnly = parsed
+	}
+
+	limit := defaultEntriesLimit
+	if val := query.Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 || parsed > maxEntriesLimit {
+			api.WriteBadRequest(w, "Invalid limit value: "+val+". Must be between 1 and "+strconv.Itoa(maxEntriesLimit)+".", r.URL.Path)
+			return
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	if val := query.Get("offset"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 {
+			api.WriteBadRequest(w, "Invalid offset value: "+val+". Must be a non-negative number.", r.URL.Path)
+			return
+		}
+		offset = parsed
+	}
+
+	entries, total, err := productCache.Entries(store, staleOnly, limit, offset)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// purgeStoreHandler deletes every cached product of a store.
+func purgeStoreHandler(w http.ResponseWriter, r *http.Request) {
+	store, ok := storeParam(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := productCache.DeleteStore(store)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	log.InfoContext(r.Context(), "Purged cached store", "store", store, "deleted", deleted)
+	writeJSON(w, http.StatusOK, map[string]int64{"deleted": deleted})
+}
+
+// purgeProductHandler deletes a single cached product.
+func purgeProductHandler(w http.ResponseWriter, r *http.Request) {
+	store, ok := storeParam(w, r)
+	if !ok {
+		return
+	}
+	productID, ok := productIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := productCache.Delete(store, productID)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	if !deleted {
+		api.WriteNotFound(w, "Product not cached", r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cacheWarmupHandler queues products to be scraped into the cache in the
+// background. Entries that are still fresh are skipped unless refresh is set.
+func cacheWarmupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Store   string   `json:"store"`
+		IDs     []string `json:"ids"`
+		Refresh bool     `json:"refresh"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteBadRequest(w, `Invalid JSON body. Expected {"store": "...", "ids": ["..."]}.`, r.URL.Path)
+		return
+	}
+	defer r.Body.Close()
+
+	store := strings.ToLower(req.Store)
+	if !slices.Contains(supportedStores, store) {
+		api.WriteBadRequest(w, "Store not supported. Available: "+strings.Join(supportedStores, ", "), r.URL.Path)
+		return
+	}
+	if len(req.IDs) == 0 {
+		api.WriteBadRequest(w, "No product IDs given.", r.URL.Path)
+		return
+	}
+
+	warmupOnce.Do(func() { goBackground(context.Background(), "", warmupWorker) })
+
+	queued, skipped := 0, 0
+	seen := map[string]bool{}
+	for _, raw := range req.IDs {
+		productID := digitsOnly(raw)
+		if productID == "" || seen[productID] {
+			skipped++
+			continue
+		}
+		seen[productID] = true
+
+		select {
+		case warmupQueue <- warmupJob{store: store, productID: productID, refresh: req.Refresh}:
+			metrics.WarmupQueued.Set(float64(len(warmupQueue)))
+			queued++
+		default:
+			skipped++
+		}
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]int{"queued": queued, "skipped": skipped})
+}
+
+// warmupWorker scrapes queued products one at a time, sharing the scraper
+// semaphore with interactive requests, until ctx is cancelled.
+func warmupWorker(ctx context.Context) {
+	for {
+		var job warmupJob
+		select {
+		case <-ctx.Done():
+			return
+		case job = <-warmupQueue:
+		}
+		metrics.WarmupQueued.Set(float64(len(warmupQueue)))
+
+		if !job.refresh {
+			if cached, scrapedAt, ok := productCache.GetStale(job.store, job.productID); ok && time.Since(scrapedAt) <= productCache.TTLFor(job.store, job.productID, cached) {
+				continue
+			}
+			if _, ok := productCache.GetNotFound(job.store, job.productID); ok {
+				continue
+			}
+		}
+		guard(ctx, job.store, panicInBackground, func() { revalidateCache(ctx, job.store, job.productID) })
+	}
+}
+
+// cacheRetentionHandler runs the configured retention policy right away and
+// reports what it removed and reclaimed.
+func cacheRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := productCache.ApplyRetention(retentionPolicy)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// cacheVacuumHandler compacts the cache storage and reports the reclaimed space.
+func cacheVacuumHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := productCache.Vacuum()
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// clearNegativeCacheHandler removes remembered not-found results, optionally
+// only for the store given in ?store=.
+func clearNegativeCacheHandler(w http.ResponseWriter, r *http.Request) {
+	store := strings.ToLower(r.URL.Query().Get("store"))
+	if store != "" && !slices.Contains(supportedStores, store) {
+		api.WriteBadRequest(w, "Store not supported. Available: "+strings.Join(supportedStores, ", "), r.URL.Path)
+		return
+	}
+
+	cleared, err := productCache.ClearNotFound(store)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{"cleared": cleared})
+}
+
+// digitsOnly strips everything but digits from a product ID,
+// e.g. "00-626061" -> "00626061".
+func digitsOnly(raw string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, raw)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("Error encoding response", "error", err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/auth"
+	"hunter-base/pkg/metrics"
+	"hunter-base/pkg/router"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader carries the API key of a request. Keys are also accepted as
+// "Authorization: Bearer <key>" and in the api_key query parameter.
+const APIKeyHeader = "X-API-Key"
+
+const (
+	defaultUsageDays = 30
+	maxUsageDays     = 366
+)
+
+// Why auth refused a request, as labelled in metrics.
+const (
+	rejectMissing   = "missing"
+	rejectInvalid   = "invalid"
+	rejectScope     = "scope"
+	rejectRateLimit = "rate_limit"
+	rejectQuota     = "quota"
+)
+
+// errQuotaExhausted is returned for lookups that would have to scrape with a
+// key that has used up its daily scrapes.
+var errQuotaExhausted = errors.New("daily scrape quota exhausted")
+
+var (
+	// keyStore holds the API keys. It is nil when auth is disabled.
+	keyStore   *auth.Store
+	keyLimiter = auth.NewLimiter()
+)
+
+// configureAuth opens the key database when auth is enabled. The returned
+// function closes it.
+func configureAuth() (func(), error) {
+	if !appConfig.Auth.Enabled {
+		return func() {}, nil
+	}
+	store, err := auth.Open(appConfig.Auth.Path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.Keys()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if len(keys) == 0 {
+		log.Warn("API key auth is enabled but there are no keys; create one with the keys command", "path", appConfig.Auth.Path)
+	}
+	keyStore = store
+	return func() { store.Close() }, nil
+}
+
+// requireScope lets requests through that carry an API key with any of the
+// scopes and are within the key's rate limit. The key is put in the request
+// context and its use is counted. Without auth it lets every request through.
+func requireScope(scopes ...auth.Scope) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if keyStore == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			secret := apiKey(r)
+			if secret == "" {
+				rejectAuth(w, r, nil, rejectMissing, http.StatusUnauthorized, "Unauthorized",
+					"An API key is required. Send it in the "+APIKeyHeader+" header.")
+				return
+			}
+			key, err := keyStore.Authenticate(secret)
+			if errors.Is(err, auth.ErrInvalidKey) {
+				rejectAuth(w, r, nil, rejectInvalid, http.StatusUnauthorized, "Unauthorized", "Invalid API key")
+				return
+			}
+			if err != nil {
+				api.WriteInternalServerError(w, err, r.URL.Path)
+				return
+			}
+			recordUsage(r.Context(), key, auth.Usage{Requests: 1})
+
+			if !hasAnyScope(key, scopes) {
+				rejectAuth(w, r, key, rejectScope, http.StatusForbidden, "Forbidden",
+					fmt.Sprintf("API key %s lacks the %s scope", key.ID, joinScopes(scopes, " or ")))
+				return
+			}
+			if ok, retryAfter := keyLimiter.Allow(key.ID, key.RatePerMinute); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				rejectAuth(w, r, key, rejectRateLimit, http.StatusTooManyRequests, "Too Many Requests",
+					fmt.Sprintf("API key %s is limited to %d requests per minute", key.ID, key.RatePerMinute))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), key)))
+		})
+	}
+}
+
+// apiKey returns the API key sent with r, or "".
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(bearer)
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+func hasAnyScope(key *auth.Key, scopes []auth.Scope) bool {
+	for _, scope := range scopes {
+		if key.Has(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinScopes formats scopes with sep between them, e.g. "read or scrape".
+func joinScopes(scopes []auth.Scope, sep string) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, sep)
+}
+
+// rejectAuth answers a refused request with a problem and counts the
+// refusal, also against key when the request was authenticated.
+func rejectAuth(w http.ResponseWriter, r *http.Request, key *auth.Key, reason string, status int, title, detail string) {
+	metrics.AuthRejections.WithLabelValues(reason).Inc()
+	if key != nil {
+		recordUsage(r.Context(), key, auth.Usage{Rejected: 1})
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="hunter-base"`)
+	}
+	api.WriteError(w, status, title, detail, r.URL.Path)
+}
+
+// recordUsage adds u to today's usage of key. Failures are only logged, so a
+// busy key database never fails a lookup.
+func recordUsage(ctx context.Context, key *auth.Key, u auth.Usage) {
+	if keyStore == nil || key == nil {
+		return
+	}
+	if err := keyStore.Record(key.ID, u); err != nil {
+		log.WarnContext(ctx, "Could not record API key usage", "key", key.ID, "error", err)
+	}
+}
+
+// scrapeLimit returns why the key of the request may not scrape, or nil. Keys
+// without the scrape scope get errNotCached and keys that used up today's
+// scrapes get errQuotaExhausted; both are still answered from the cache.
+// Concurrent lookups may overshoot the quota by the number of scraper slots.
+func scrapeLimit(ctx context.Context) error {
+	key := auth.FromContext(ctx)
+	if key == nil {
+		return nil
+	}
+	if !key.Has(auth.ScopeScrape) {
+		return errNotCached
+	}
+	if key.DailyScrapes == 0 {
+		return nil
+	}
+	scrapes, err := keyStore.ScrapesToday(key.ID)
+	if err != nil {
+		log.WarnContext(ctx, "Could not read API key usage", "key", key.ID, "error", err)
+		return nil
+	}
+	if scrapes >= int64(key.DailyScrapes) {
+		return errQuotaExhausted
+	}
+	return nil
+}
+
+// countScrape counts a scrape against the key of the request.
+func countScrape(ctx context.Context) {
+	recordUsage(ctx, auth.FromContext(ctx), auth.Usage{Scrapes: 1})
+}
+
+// writeQuotaExhausted answers a lookup refused by the daily scrape quota.
+func writeQuotaExhausted(w http.ResponseWriter, r *http.Request) {
+	key := auth.FromContext(r.Context())
+	w.Header().Set("Retry-After", strconv.Itoa(int(auth.UntilReset(time.Now()).Seconds())+1))
+	rejectAuth(w, r, key, rejectQuota, http.StatusTooManyRequests, "Too Many Requests",
+		fmt.Sprintf("API key %s used its %d scrapes for today and this product is not cached", key.ID, key.DailyScrapes))
+}
+
+// withKeyStore answers 404 when auth is disabled, as there are no keys to
+// manage.
+func withKeyStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keyStore == nil {
+			api.WriteNotFound(w, "API key auth is disabled", r.URL.Path)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listKeysHandler lists the API keys with today's usage.
+func listKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := keyStore.Keys()
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+// createKeyHandler creates an API key. The key itself is only part of this
+// response.
+func createKeyHandler(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Name          string `json:"name"`
+		Scopes        string `json:"scopes"`
+		RatePerMinute *int   `json:"rate_per_minute"`
+		DailyScrapes  *int   `json:"daily_scrapes"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteBadRequest(w, `Invalid JSON body. Expected {"name": "...", "scopes": "read,scrape"}.`, r.URL.Path)
+		return
+	}
+	defer r.Body.Close()
+
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		api.WriteBadRequest(w, err.Error(), r.URL.Path)
+		return
+	}
+	rate, daily := auth.DefaultRatePerMinute, auth.DefaultDailyScrapes
+	if req.RatePerMinute != nil {
+		rate = *req.RatePerMinute
+	}
+	if req.DailyScrapes != nil {
+		daily = *req.DailyScrapes
+	}
+
+	key, secret, err := keyStore.Create(strings.TrimSpace(req.Name), scopes, rate, daily)
+	if err != nil {
+		api.WriteBadRequest(w, err.Error(), r.URL.Path)
+		return
+	}
+	log.InfoContext(r.Context(), "Created API key", "key", key.ID, "name", key.Name, "scopes", req.Scopes)
+	writeJSON(w, http.StatusCreated, map[string]any{"key": key, "secret": secret})
+}
+
+// revokeKeyHandler deletes an API key and its usage.
+func revokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	revoked, err := keyStore.Revoke(id)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	if !revoked {
+		api.WriteNotFound(w, "No such API key: "+id, r.URL.Path)
+		return
+	}
+	log.InfoContext(r.Context(), "Revoked API key", "key", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keyUsageHandler reports the daily usage of an API key over the last
+// ?days= days.
+func keyUsageHandler(w http.ResponseWriter, r *http.Request) {
+	days := defaultUsageDays
+	if val := r.URL.Query().Get("days"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 || parsed > maxUsageDays {
+			api.WriteBadRequest(w, "Invalid days value: "+val+". Must be between 1 and "+strconv.Itoa(maxUsageDays)+".", r.URL.Path)
+			return
+		}
+		days = parsed
+	}
+
+	key, err := keyStore.Get(r.PathValue("id"))
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		api.WriteNotFound(w, "No such API key: "+r.PathValue("id"), r.URL.Path)
+		return
+	}
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	usage, err := keyStore.Usage(key.ID, days)
+	if err != nil {
+		api.WriteInternalServerError(w, err, r.URL.Path)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"key": key, "usage": usage})
+}
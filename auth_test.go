@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"hunter-base/pkg/auth"
+	"hunter-base/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestKeyStore enables auth with a key database in a temporary directory.
+func useTestKeyStore(t *testing.T) *auth.Store {
+	t.Helper()
+	store, err := auth.Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyStore, keyLimiter = store, auth.NewLimiter()
+	t.Cleanup(func() {
+		keyStore = nil
+		store.Close()
+	})
+	return store
+}
+
+func serveWithKey(method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuthDisabled(t *testing.T) {
+	productCache = newTestCache(t)
+	productCache.Set("billa", "1", &models.Product{Name: "Milk", Price: 1.49, ScrapedAt: time.Now()})
+
+	if rr := serveWithKey("GET", "/stores/billa/products/1", "", ""); rr.Code != http.StatusOK {
+		t.Errorf("lookup without auth: got %d", rr.Code)
+	}
+	if rr := serveWithKey("GET", "/admin/keys", "", ""); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "API key auth is disabled") {
+		t.Errorf("key admin without auth: got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAuthKeys(t *testing.T) {
+	productCache = newTestCache(t)
+	productCache.Set("billa", "1", &models.Product{Name: "Milk", Price: 1.49, ScrapedAt: time.Now()})
+	store := useTestKeyStore(t)
+
+	_, reader, _ := store.Create("dashboard", []auth.Scope{auth.ScopeRead}, 2, 0)
+	scraperKey, scraper, _ := store.Create("cron", []auth.Scope{auth.ScopeScrape}, 0, 1)
+	_, admin, _ := store.Create("ops", []auth.Scope{auth.ScopeAdmin}, 0, 0)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+	}{
+		{"health stays open", "GET", "/healthz", "", http.StatusOK},
+		{"missing key", "GET", "/stores/billa/products/1", "", http.StatusUnauthorized},
+		{"invalid key", "GET", "/stores/billa/products/1", reader + "x", http.StatusUnauthorized},
+		{"read key, cached", "GET", "/stores/billa/products/1", reader, http.StatusOK},
+		{"read key, not cached", "GET", "/stores/billa/products/2", reader, http.StatusNotFound},
+		{"read key over rate", "GET", "/stores/billa/products/1", reader, http.StatusTooManyRequests},
+		{"query parameter", "GET", "/stores/billa/products/1?api_key=" + scraper, "", http.StatusOK},
+		{"product key on admin", "GET", "/admin/cache/stats", scraper, http.StatusForbidden},
+		{"admin key on products", "GET", "/stores/billa/products/1", admin, http.StatusForbidden},
+		{"admin key", "GET", "/admin/cache/stats", admin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := serveWithKey(tt.method, tt.path, tt.key, "")
+		if rr.Code != tt.status {
+			t.Errorf("%s: got %d, want %d: %s", tt.name, rr.Code, tt.status, rr.Body.String())
+		}
+		if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", tt.name)
+		}
+	}
+
+	store.Record(scraperKey.ID, auth.Usage{Scrapes: 1})
+	rr := serveWithKey("GET", "/stores/billa/products/2", scraper, "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" || !strings.Contains(rr.Body.String(), "scrapes for today") {
+		t.Errorf("exhausted quota: got %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	rr = serveWithKey("POST", "/stores/billa/products/batch", scraper, `[{"barcode": "1"}, {"barcode": "2"}]`)
+	if !strings.Contains(rr.Body.String(), `"name":"Milk"`) || !strings.Contains(rr.Body.String(), "Daily scrape quota exhausted") {
+		t.Errorf("batch with exhausted quota: %s", rr.Body.String())
+	}
+
+	usage, err := store.Usage(scraperKey.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].Requests != 4 || usage[0].Scrapes != 1 || usage[0].Rejected != 2 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestKeyAdminHandlers(t *testing.T) {
+	store := useTestKeyStore(t)
+	_, admin, _ := store.Create("ops", []auth.Scope{auth.ScopeAdmin}, 0, 0)
+
+	rr := serveWithKey("POST", "/admin/keys", admin, `{"name": "app", "scopes": "scrape,read", "daily_scrapes": 0}`)
+	var created struct {
+		Key    auth.Key `json:"key"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || rr.Code != http.StatusCreated {
+		t.Fatalf("create: got %d, %v", rr.Code, err)
+	}
+	if created.Key.RatePerMinute != auth.DefaultRatePerMinute || created.Key.DailyScrapes != 0 || len(created.Key.Scopes) != 2 {
+		t.Errorf("unexpected key %+v", created.Key)
+	}
+	if rr := serveWithKey("GET", "/stores/unknown/products/1", created.Secret, ""); rr.Code != http.StatusBadRequest {
+		t.Error("created key does not authenticate")
+	}
+
+	if rr := serveWithKey("POST", "/admin/keys", admin, `{"name": "app", "scopes": "write"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope: got %d", rr.Code)
+	}
+	if rr := serveWithKey("GET", "/admin/keys", admin, ""); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), created.Secret) || strings.Count(rr.Body.String(), `"id"`) != 2 {
+		t.Errorf("list: got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := serveWithKey("GET", "/admin/keys/"+created.Key.ID+"/usage?days=7", admin, ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"requests":1`) {
+		t.Errorf("usage: got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := serveWithKey("GET", "/admin/keys/"+created.Key.ID+"/usage?days=0", admin, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("usage days=0: got %d", rr.Code)
+	}
+
+	if rr := serveWithKey("DELETE", "/admin/keys/"+created.Key.ID, admin, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("revoke: got %d", rr.Code)
+	}
+	if rr := serveWithKey("DELETE", "/admin/keys/"+created.Key.ID, admin, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("revoke twice: got %d", rr.Code)
+	}
+	if rr := serveWithKey("GET", "/stores/billa/products/1", created.Secret, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: got %d", rr.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNotCached is returned for cache_only requests without a usable entry.
+var errNotCached = errors.New("product not cached")
+
+// errNegativeHit is returned when the product is known to be missing at the
+// store. It wraps models.ErrProductNotFound.
+var errNegativeHit = fmt.Errorf("%w (negative cache hit)", models.ErrProductNotFound)
+
+// cacheOptions are the cache directives that apply to a single request.
+type cacheOptions struct {
+	// NoCache forces a scrape even when a fresh entry exists.
+	NoCache bool
+	// MaxAge, when positive, only accepts entries younger than this as fresh.
+	MaxAge time.Duration
+	// CacheOnly never scrapes and fails with errNotCached instead.
+	CacheOnly bool
+	// AcceptStale serves expired entries within MaxStale without scraping
+	// first, as requested by Cache-Control: max-stale.
+	AcceptStale bool
+	// MaxStale bounds how long past its TTL an entry may still be served,
+	// either directly (AcceptStale) or when the scrape fails.
+	MaxStale time.Duration
+	// NoRevalidate skips the background refresh of served entries, for
+	// commands that exit right after answering.
+	NoRevalidate bool
+}
+
+// defaultCacheOptions applies the server-wide max staleness.
+func defaultCacheOptions() cacheOptions {
+	return cacheOptions{MaxStale: time.Duration(appConfig.Cache.MaxStale)}
+}
+
+// cacheOptionsFromRequest reads the Cache-Control request header and the
+// refresh, max_age and cache_only query parameters. Supported header
+// directives are no-cache and max-stale[=seconds]; a bare max-stale accepts
+// entries of any age.
+func cacheOptionsFromRequest(r *http.Request) (cacheOptions, error) {
+	opts := defaultCacheOptions()
+
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			opts.NoCache = true
+		case "max-stale":
+			opts.AcceptStale = true
+			opts.MaxStale = math.MaxInt64
+			if hasValue {
+				if secs, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64); err == nil && secs >= 0 {
+					opts.MaxStale = time.Duration(secs) * time.Second
+				}
+			}
+		}
+	}
+
+	query := r.URL.Query()
+
+	if val := query.Get("refresh"); val != "" {
+		refresh, err := strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid refresh value: %s. Must be true or false.", val)
+		}
+		opts.NoCache = opts.NoCache || refresh
+	}
+
+	if val := query.Get("max_age"); val != "" {
+		secs, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || secs < 0 {
+			return opts, fmt.Errorf("Invalid max_age value: %s. Must be a non-negative number of seconds.", val)
+		}
+		if secs == 0 {
+			opts.NoCache = true
+		} else {
+			opts.MaxAge = time.Duration(secs) * time.Second
+		}
+	}
+
+	if val := query.Get("cache_only"); val != "" {
+		cacheOnly, err := strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid cache_only value: %s. Must be true or false.", val)
+		}
+		opts.CacheOnly = cacheOnly
+	}
+
+	if opts.CacheOnly && opts.NoCache {
+		return opts, errors.New("cache_only cannot be combined with refresh, max_age=0 or Cache-Control: no-cache.")
+	}
+
+	return opts, nil
+}
+
+// freshFor returns how long an entry counts as fresh for this request.
+func (o cacheOptions) freshFor(ttl time.Duration) time.Duration {
+	if o.MaxAge > 0 && o.MaxAge < ttl {
+		return o.MaxAge
+	}
+	return ttl
+}
+
+// withCacheStatus annotates a product with how it was served.
+func withCacheStatus(product *models.Product, status string, scrapedAt time.Time) *models.Product {
+	product.CacheStatus = status
+	product.AgeSeconds = int64(time.Since(scrapedAt).Seconds())
+	return product
+}
+
+// writeCacheHeaders mirrors the product's cache metadata in HTTP headers.
+func writeCacheHeaders(w http.ResponseWriter, product *models.Product) {
+	if product.CacheStatus == "" {
+		return
+	}
+	w.Header().Set("X-Cache-Status", product.CacheStatus)
+	w.Header().Set("Age", strconv.FormatInt(product.AgeSeconds, 10))
+	if product.CacheStatus == cache.StatusStale {
+		w.Header().Add("Warning", `110 - "Response is Stale"`)
+		if product.StaleReason != "" {
+			w.Header().Add("Warning", fmt.Sprintf(`111 - "Revalidation Failed: %s"`, strings.ReplaceAll(product.StaleReason, `"`, `'`)))
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hunter-base/pkg/config"
+	"hunter-base/pkg/export"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// commands maps subcommand names to their implementation.
+var commands = map[string]func(args []string) error{
+	"serve":   serveCommand,
+	"scrape":  scrapeCommand,
+	"compare": compareCommand,
+	"cache":   cacheCommand,
+	"watch":   watchCommand,
+	"export":  exportCommand,
+	"import":  importCommand,
+	"keys":    keysCommand,
+	"version": versionCommand,
+}
+
+const usage = `Usage: hunter-base [command] [flags]
+
+Commands:
+  serve                                   Start the HTTP server (default)
+  scrape <store> <id>... [--json|--table] [--no-cache]
+                                          Scrape products through the cache
+  compare --ean <ean> [--refresh]         Compare cached prices of a product across stores
+  cache stats|purge|vacuum                Inspect and maintain the cache
+  watch add|list|remove                   Manage the watchlist
+  export                                  Write cached products and price history as CSV, JSON or Parquet
+  import <file>...                        Merge previous exports into the cache
+  keys create|list|revoke|usage           Manage API keys
+  version [--json]                        Print the build version
+
+Run "hunter-base <command> -h" for the flags of a command.
+`
+
+// errUsage is returned by commands after printing their usage for invalid
+// arguments.
+var errUsage = errors.New("invalid arguments")
+
+// runCommand runs a subcommand and returns the process exit code.
+func runCommand(name string, args []string) int {
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return 0
+	}
+
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n%s", name, usage)
+		return 2
+	}
+
+	err := command(args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "hunter-base %s: %v\n", name, err)
+		return 1
+	}
+}
+
+// parseArgs parses flags placed anywhere among the positional arguments, so
+// "scrape billa 1 --json" works as well as "scrape --json billa 1".
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// outputFlags adds the --json and --table flags shared by commands that
+// print results. It returns whether JSON was chosen once parsed.
+func outputFlags(fs *flag.FlagSet) func() (bool, error) {
+	asJSON := fs.Bool("json", false, "print JSON")
+	asTable := fs.Bool("table", false, "print a table (default)")
+	return func() (bool, error) {
+		if *asJSON && *asTable {
+			return false, errors.New("--json and --table are mutually exclusive")
+		}
+		return *asJSON, nil
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// validStore normalizes store and checks that it is supported.
+func validStore(store string) (string, error) {
+	store = strings.ToLower(store)
+	if !slices.Contains(supportedStores, store) {
+		return "", fmt.Errorf("store %q not supported, available: %s", store, strings.Join(supportedStores, ", "))
+	}
+	return store, nil
+}
+
+// cacheCommand inspects and maintains the cache:
+//
+//	cache stats [--json|--table]
+//	cache purge <store> [<id>...]
+//	cache purge --negative [<store>]
+//	cache vacuum
+func cacheCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hunter-base cache stats|purge|vacuum")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "stats":
+		return cacheStatsCommand(args[1:])
+	case "purge":
+		return cachePurgeCommand(args[1:])
+	case "vacuum":
+		return cacheVacuumCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache command %q. Use stats, purge or vacuum.\n", args[0])
+		return errUsage
+	}
+}
+
+func cacheStatsCommand(args []string) error {
+	fs := flag.NewFlagSet("cache stats", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	output := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	asJSON, err := output()
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	stats, err := productCache.Stats()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(stats)
+	}
+
+	stores := slices.Sorted(maps.Keys(stats.Stores))
+	tw := newTable()
+	fmt.Fprintln(tw, "STORE\tENTRIES\tSTALE\tNOT FOUND")
+	for _, store := range stores {
+		s := stats.Stores[store]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", store, s.Entries, s.Stale, s.NotFound)
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%d\n", stats.Entries, stats.Stale, stats.NotFound)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	tw = newTable()
+	for _, bucket := range stats.Ages {
+		fmt.Fprintf(tw, "%s\t%d\n", bucket.Label, bucket.Count)
+	}
+	fmt.Fprintf(tw, "size\t%d bytes\n", stats.DBSizeBytes)
+	return tw.Flush()
+}
+
+func cachePurgeCommand(args []string) error {
+	fs := flag.NewFlagSet("cache purge", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	negative := fs.Bool("negative", false, "clear remembered not-found results instead of products")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base cache purge <store> [<id>...]\n       hunter-base cache purge --negative [<store>]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *negative {
+		if len(positional) > 1 {
+			fs.Usage()
+			return errUsage
+		}
+		store := ""
+		if len(positional) == 1 {
+			if store, err = validStore(positional[0]); err != nil {
+				return err
+			}
+		}
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		if _, err := openProductCache(); err != nil {
+			return err
+		}
+		defer productCache.Close()
+
+		cleared, err := productCache.ClearNotFound(store)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cleared %d not-found results\n", cleared)
+		return nil
+	}
+
+	if len(positional) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	store, err := validStore(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	if len(positional) == 1 {
+		deleted, err := productCache.DeleteStore(store)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d products of %s\n", deleted, store)
+		return nil
+	}
+
+	for _, raw := range positional[1:] {
+		productID := digitsOnly(raw)
+		deleted, err := productCache.Delete(store, productID)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			fmt.Printf("Purged %s/%s\n", store, productID)
+		} else {
+			fmt.Printf("%s/%s was not cached\n", store, productID)
+		}
+	}
+	return nil
+}
+
+func cacheVacuumCommand(args []string) error {
+	fs := flag.NewFlagSet("cache vacuum", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	report, err := productCache.Vacuum()
+	if err != nil {
+		return err
+	}
+	if !report.Vacuumed {
+		fmt.Println("The cache backend does not support vacuuming")
+		return nil
+	}
+	fmt.Printf("Reclaimed %d bytes (%d -> %d) in %dms\n", report.ReclaimedBytes, report.SizeBeforeBytes, report.SizeAfterBytes, report.DurationMS)
+	return nil
+}
+
+// exportCommand writes an export to --out, or to stdout.
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	format := fs.String("format", export.FormatJSON, "output format: "+strings.Join(export.Formats, ", "))
+	store := fs.String("store", "", "only export this store")
+	from := fs.String("from", "", "only export data from this date or RFC 3339 time on")
+	to := fs.String("to", "", "only export data before this date or RFC 3339 time")
+	out := fs.String("out", "", "write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !slices.Contains(export.Formats, *format) {
+		return fmt.Errorf("invalid format %q, use one of %s", *format, strings.Join(export.Formats, ", "))
+	}
+	filter, err := exportFilter(*store, *from, *to)
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	if *out == "" {
+		return export.Write(os.Stdout, *format, productCache, filter)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := export.Write(file, *format, productCache, filter); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// importCommand merges the given export files, or stdin for "-", into the
+// cache. The format is taken from --format or the file extension.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	format := fs.String("format", "", "input format: "+strings.Join(export.Formats, ", ")+" (default: from the file extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base import [--format json] <file|-> ...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	for _, path := range fs.Args() {
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		}
+		if !slices.Contains(export.Formats, fileFormat) {
+			return fmt.Errorf("%s: unknown format %q, set --format", path, fileFormat)
+		}
+
+		var in io.ReadCloser = os.Stdin
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			in = file
+		}
+
+		report, err := export.Import(productCache, in, fileFormat)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("%s: %d products and %d prices imported, %d products and %d prices already known\n",
+			path, report.ProductsImported, report.HistoryImported, report.ProductsSkipped, report.HistorySkipped)
+	}
+	return nil
+}
+
+// configFlag adds --config to fs. The returned function loads the
+// configuration once fs is parsed.
+func configFlag(fs *flag.FlagSet) func() error {
+	loader := config.NewLoader(supportedStores)
+	loader.RegisterFlags(fs, false)
+	return func() error {
+		return useConfig(loader)
+	}
+}
+
+// versionCommand prints the build version, like GET /version.
+func versionCommand(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	info := buildInfo()
+	if *asJSON {
+		return printJSON(info)
+	}
+	fmt.Printf("hunter-base %s (commit %s", info.Version, info.Commit)
+	if info.BuildDate != "" {
+		fmt.Printf(", built %s", info.BuildDate)
+	}
+	fmt.Printf(", %s)\n", info.GoVersion)
+	return nil
+}
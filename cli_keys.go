@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"hunter-base/pkg/auth"
+	"os"
+	"time"
+)
+
+// keysCommand manages API keys. It works whether or not auth is enabled, so
+// keys can be created before turning it on:
+//
+//	keys create --name <name> [--scopes read,scrape] [--rate 60] [--daily-scrapes 200]
+//	keys list [--json|--table]
+//	keys revoke <id>
+//	keys usage <id> [--days 30] [--json|--table]
+func keysCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hunter-base keys create|list|revoke|usage")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "create":
+		return keysCreateCommand(args[1:])
+	case "list":
+		return keysListCommand(args[1:])
+	case "revoke":
+		return keysRevokeCommand(args[1:])
+	case "usage":
+		return keysUsageCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown keys command %q. Use create, list, revoke or usage.\n", args[0])
+		return errUsage
+	}
+}
+
+// openKeyStore opens the key database of the loaded configuration.
+func openKeyStore() (*auth.Store, error) {
+	if appConfig.Auth.Path == "" {
+		return nil, errors.New("no key database configured, set HUNTER_AUTH_DB_PATH")
+	}
+	return auth.Open(appConfig.Auth.Path)
+}
+
+func keysCreateCommand(args []string) error {
+	fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	name := fs.String("name", "", "who or what the key is for")
+	scopes := fs.String("scopes", "read", "comma-separated scopes: read, scrape, admin")
+	rate := fs.Int("rate", auth.DefaultRatePerMinute, "requests per minute, 0 for unlimited")
+	daily := fs.Int("daily-scrapes", auth.DefaultDailyScrapes, "scrapes per UTC day, 0 for unlimited")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || fs.NArg() > 0 {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base keys create --name <name> [--scopes read,scrape] [--rate 60] [--daily-scrapes 200]")
+		fs.PrintDefaults()
+		return errUsage
+	}
+	parsed, err := auth.ParseScopes(*scopes)
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	store, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	key, secret, err := store.Create(*name, parsed, *rate, *daily)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created key %s for %s. Store it now, it is not shown again:\n%s\n", key.ID, key.Name, secret)
+	return nil
+}
+
+func keysListCommand(args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	output := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	asJSON, err := output()
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	store, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	keys, err := store.Keys()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(keys)
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tRATE/MIN\tDAILY SCRAPES\tREQUESTS TODAY\tSCRAPES TODAY\tLAST USED")
+	for _, key := range keys {
+		lastUsed := "never"
+		if key.LastUsedAt != nil {
+			lastUsed = key.LastUsedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", key.ID, key.Name, joinScopes(key.Scopes, ","),
+			limitText(key.RatePerMinute), limitText(key.DailyScrapes), key.Today.Requests, key.Today.Scrapes, lastUsed)
+	}
+	return tw.Flush()
+}
+
+func keysRevokeCommand(args []string) error {
+	fs := flag.NewFlagSet("keys revoke", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base keys revoke <id>")
+		return errUsage
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	store, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	revoked, err := store.Revoke(positional[0])
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("no such key: %s", positional[0])
+	}
+	fmt.Printf("Revoked key %s\n", positional[0])
+	return nil
+}
+
+func keysUsageCommand(args []string) error {
+	fs := flag.NewFlagSet("keys usage", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	output := outputFlags(fs)
+	days := fs.Int("days", defaultUsageDays, "number of days to show, including today")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *days < 1 || *days > maxUsageDays {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base keys usage <id> [--days 30]")
+		return errUsage
+	}
+	asJSON, err := output()
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	store, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	key, err := store.Get(positional[0])
+	if err != nil {
+		return err
+	}
+	usage, err := store.Usage(key.ID, *days)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(usage)
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, "DAY\tREQUESTS\tSCRAPES\tREJECTED")
+	for _, u := range usage {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", u.Day, u.Requests, u.Scrapes, u.Rejected)
+	}
+	return tw.Flush()
+}
+
+// limitText formats a key limit, where 0 is unlimited.
+func limitText(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(limit)
+}
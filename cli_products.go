@@ -0,0 +1,408 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/models"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// productResult is a product as printed by the scrape, compare and watch
+// commands.
+type productResult struct {
+	Store     string          `json:"store"`
+	ProductID string          `json:"product_id"`
+	Product   *models.Product `json:"product,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// scrapeCommand scrapes products through the cache, like the HTTP API does.
+func scrapeCommand(args []string) error {
+	fs := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	output := outputFlags(fs)
+	noCache := fs.Bool("no-cache", false, "scrape even when a fresh entry is cached")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base scrape <store> <id>... [--json|--table] [--no-cache]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	asJSON, err := output()
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	store, err := validStore(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	opts := defaultCacheOptions()
+	opts.NoCache = *noCache
+	opts.NoRevalidate = true
+
+	results := make([]productResult, 0, len(positional)-1)
+	failed := 0
+	for _, raw := range positional[1:] {
+		result := productResult{Store: store, ProductID: digitsOnly(raw)}
+		if result.ProductID == "" {
+			result.Error = "invalid product ID " + strconv.Quote(raw)
+		} else if product, err := getProduct(context.Background(), store, result.ProductID, opts); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Product = product
+		}
+		if result.Error != "" {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if asJSON {
+		err = printJSON(results)
+	} else {
+		err = printProducts(results)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d products failed", failed, len(results))
+	}
+	return nil
+}
+
+// compareCommand lists the cached products with the given EAN across stores,
+// cheapest first. Stores are searched by product ID, so each product has to
+// have been scraped or imported once before it can be compared.
+func compareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	output := outputFlags(fs)
+	ean := fs.String("ean", "", "EAN (GTIN-13) of the product")
+	refresh := fs.Bool("refresh", false, "scrape the matching products again before comparing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	asJSON, err := output()
+	if err != nil {
+		return err
+	}
+	if digitsOnly(*ean) == "" || fs.NArg() > 0 {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base compare --ean <ean> [--refresh] [--json|--table]")
+		fs.PrintDefaults()
+		return errUsage
+	}
+	gtin := digitsOnly(*ean)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if *refresh {
+		err = setup()
+	} else {
+		_, err = openProductCache()
+	}
+	if err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	records, err := productCache.Records("", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	var results []productResult
+	for _, record := range records {
+		if record.Product.GTIN13 != gtin {
+			continue
+		}
+		result := productResult{Store: record.Store, ProductID: record.ProductID, Product: record.Product}
+		if *refresh {
+			opts := defaultCacheOptions()
+			opts.NoCache = true
+			opts.NoRevalidate = true
+			if product, err := getProduct(context.Background(), record.Store, record.ProductID, opts); err != nil {
+				log.Warn("Could not refresh, comparing the cached price", "store", record.Store, "id", record.ProductID, "error", err)
+			} else {
+				result.Product = product
+			}
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no cached product with EAN %s; scrape it in each store first", gtin)
+	}
+
+	// Unavailable products and those without a price go last.
+	slices.SortStableFunc(results, func(a, b productResult) int {
+		pa, pb := a.Product, b.Product
+		return cmp.Or(
+			cmp.Compare(priceRank(pa), priceRank(pb)),
+			cmp.Compare(pa.Price, pb.Price),
+		)
+	})
+
+	if asJSON {
+		return printJSON(results)
+	}
+	return printProducts(results)
+}
+
+func priceRank(p *models.Product) int {
+	if p.Price > 0 && p.IsAvailable {
+		return 0
+	}
+	return 1
+}
+
+// watchCommand manages the watchlist:
+//
+//	watch add <store> <id> [--target 1.49] [--note text]
+//	watch list [--refresh] [--json|--table]
+//	watch remove <store> <id>
+func watchCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: hunter-base watch add|list|remove")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "add":
+		return watchAddCommand(args[1:])
+	case "list":
+		return watchListCommand(args[1:])
+	case "remove":
+		return watchRemoveCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown watch command %q. Use add, list or remove.\n", args[0])
+		return errUsage
+	}
+}
+
+func watchAddCommand(args []string) error {
+	fs := flag.NewFlagSet("watch add", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	target := fs.Float64("target", 0, "price at or below which the product counts as a deal")
+	note := fs.String("note", "", "free text shown in the list")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base watch add <store> <id> [--target 1.49] [--note text]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 || digitsOnly(positional[1]) == "" || *target < 0 {
+		fs.Usage()
+		return errUsage
+	}
+	store, err := validStore(positional[0])
+	if err != nil {
+		return err
+	}
+	productID := digitsOnly(positional[1])
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	if err := productCache.AddWatch(store, productID, *target, *note); err != nil {
+		return err
+	}
+	fmt.Printf("Watching %s/%s\n", store, productID)
+	return nil
+}
+
+func watchRemoveCommand(args []string) error {
+	fs := flag.NewFlagSet("watch remove", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(fs.Output(), "Usage: hunter-base watch remove <store> <id>")
+		return errUsage
+	}
+	store, err := validStore(positional[0])
+	if err != nil {
+		return err
+	}
+	productID := digitsOnly(positional[1])
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if _, err := openProductCache(); err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	removed, err := productCache.RemoveWatch(store, productID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("%s/%s is not on the watchlist", store, productID)
+	}
+	fmt.Printf("Stopped watching %s/%s\n", store, productID)
+	return nil
+}
+
+// watchResult is a watchlist entry with its latest known price.
+type watchResult struct {
+	cache.Watch
+	Product *models.Product `json:"product,omitempty"`
+	Deal    bool            `json:"deal"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func watchListCommand(args []string) error {
+	fs := flag.NewFlagSet("watch list", flag.ContinueOnError)
+	loadConfig := configFlag(fs)
+	output := outputFlags(fs)
+	refresh := fs.Bool("refresh", false, "scrape watched products whose cache entry expired instead of showing the last known price")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	asJSON, err := output()
+	if err != nil {
+		return err
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if *refresh {
+		err = setup()
+	} else {
+		_, err = openProductCache()
+	}
+	if err != nil {
+		return err
+	}
+	defer productCache.Close()
+
+	watches, err := productCache.Watches()
+	if err != nil {
+		return err
+	}
+
+	opts := defaultCacheOptions()
+	opts.NoRevalidate = true
+
+	results := make([]watchResult, 0, len(watches))
+	for _, watch := range watches {
+		result := watchResult{Watch: watch}
+
+		var product *models.Product
+		var err error
+		if *refresh {
+			product, err = getProduct(context.Background(), watch.Store, watch.ProductID, opts)
+		} else if cached, _, ok := productCache.GetStale(watch.Store, watch.ProductID); ok {
+			product = cached
+		} else {
+			err = errNotCached
+		}
+
+		switch {
+		case errors.Is(err, errNotCached):
+			result.Error = "not cached"
+		case err != nil:
+			result.Error = err.Error()
+		default:
+			result.Product = product
+			result.Deal = watch.TargetPrice > 0 && product.Price > 0 && product.Price <= watch.TargetPrice
+		}
+		results = append(results, result)
+	}
+
+	if asJSON {
+		return printJSON(results)
+	}
+
+	tw := newTable()
+	fmt.Fprintln(tw, "STORE\tID\tNAME\tPRICE\tAGE\tTARGET\tDEAL\tNOTE")
+	for _, r := range results {
+		name, price, age := r.Error, "-", "-"
+		if r.Product != nil {
+			name, price, age = r.Product.Name, formatPrice(r.Product), formatAge(r.Product.ScrapedAt)
+		}
+		target := "-"
+		if r.TargetPrice > 0 {
+			target = strconv.FormatFloat(r.TargetPrice, 'f', 2, 64)
+		}
+		deal := ""
+		if r.Deal {
+			deal = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Store, r.ProductID, name, price, age, target, deal, r.Note)
+	}
+	return tw.Flush()
+}
+
+// printProducts prints results as a table, with the error in place of the
+// name for products that failed.
+func printProducts(results []productResult) error {
+	tw := newTable()
+	fmt.Fprintln(tw, "STORE\tID\tNAME\tPRICE\tDISCOUNT\tCACHE\tAGE")
+	for _, r := range results {
+		if r.Product == nil {
+			fmt.Fprintf(tw, "%s\t%s\terror: %s\t-\t\t\t\n", r.Store, r.ProductID, r.Error)
+			continue
+		}
+		p := r.Product
+		discount := p.DiscountLabel
+		if discount == "" && p.IsDiscounted {
+			discount = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Store, r.ProductID, p.Name, formatPrice(p), discount, p.CacheStatus, formatAge(p.ScrapedAt))
+	}
+	return tw.Flush()
+}
+
+func formatAge(scrapedAt time.Time) string {
+	age := time.Since(scrapedAt)
+	if age >= 48*time.Hour {
+		return strconv.Itoa(int(age.Hours()/24)) + "d"
+	}
+	return age.Round(time.Second).String()
+}
+
+func formatPrice(p *models.Product) string {
+	price := strconv.FormatFloat(p.Price, 'f', 2, 64)
+	if p.Currency != "" {
+		price += " " + p.Currency
+	}
+	if p.OldPrice > 0 {
+		price += " (was " + strconv.FormatFloat(p.OldPrice, 'f', 2, 64) + ")"
+	}
+	return price
+}
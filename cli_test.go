@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	fs := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "")
+	noCache := fs.Bool("no-cache", false, "")
+
+	positional, err := parseArgs(fs, []string{"billa", "--json", "1", "2", "--no-cache"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(positional, []string{"billa", "1", "2"}) || !*asJSON || !*noCache {
+		t.Errorf("got %v json=%t no-cache=%t", positional, *asJSON, *noCache)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Setenv("CACHE_BACKEND", "sqlite")
+	t.Setenv("CACHE_DB_PATH", filepath.Join(t.TempDir(), "cache.db"))
+	t.Setenv("HUNTER_AUTH_DB_PATH", filepath.Join(t.TempDir(), "keys.db"))
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"unknown"}, 2},
+		{[]string{"scrape", "billa"}, 2},
+		{[]string{"scrape", "unknown", "1"}, 1},
+		{[]string{"scrape", "billa", "1", "--json", "--table"}, 1},
+		{[]string{"cache"}, 2},
+		{[]string{"watch", "add", "billa", "00-626061", "--target", "1.49"}, 0},
+		{[]string{"watch", "add", "billa"}, 2},
+		{[]string{"watch", "list", "--json"}, 0},
+		{[]string{"compare", "--ean", "9001234567890"}, 1},
+		{[]string{"cache", "stats"}, 0},
+		{[]string{"cache", "vacuum"}, 0},
+		{[]string{"watch", "remove", "billa", "626061"}, 1},
+		{[]string{"watch", "remove", "billa", "00626061"}, 0},
+		{[]string{"keys"}, 2},
+		{[]string{"keys", "create", "--scopes", "read"}, 2},
+		{[]string{"keys", "create", "--name", "cron", "--scopes", "write"}, 1},
+		{[]string{"keys", "create", "--name", "cron", "--scopes", "read,scrape"}, 0},
+		{[]string{"keys", "list", "--json"}, 0},
+		{[]string{"keys", "usage", "00000000"}, 1},
+		{[]string{"keys", "revoke", "00000000"}, 1},
+	}
+	for _, tt := range tests {
+		if code := runCommand(tt.args[0], tt.args[1:]); code != tt.code {
+			t.Errorf("%v: got exit code %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/export"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxImportBytes bounds the body of POST /import.
+const maxImportBytes = 256 << 20
+
+// exportHandler streams cached products and price history:
+//
+//	GET /export?format=csv|json|parquet&store=&from=&to=
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = export.FormatJSON
+	}
+	if !slices.Contains(export.Formats, format) {
+		api.WriteBadRequest(w, "Invalid format: "+format+". Available: "+strings.Join(export.Formats, ", "), r.URL.Path)
+		return
+	}
+
+	filter, err := exportFilter(query.Get("store"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		api.WriteBadRequest(w, err.Error(), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="hunter-base-%s.%s"`, time.Now().Format("20060102"), format))
+	if err := export.Write(w, format, productCache, filter); err != nil {
+		log.ErrorContext(r.Context(), "Error writing export", "format", format, "error", err)
+	}
+}
+
+// importHandler merges a previous export into the cache:
+//
+//	POST /import?format=csv|json|parquet
+//
+// Without a format the Content-Type decides, falling back to JSON.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = formatForContentType(r.Header.Get("Content-Type"))
+	}
+	if !slices.Contains(export.Formats, format) {
+		api.WriteBadRequest(w, "Invalid format: "+format+". Available: "+strings.Join(export.Formats, ", "), r.URL.Path)
+		return
+	}
+
+	report, err := export.Import(productCache, http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		api.WriteError(w, http.StatusRequestEntityTooLarge, "Payload Too Large", fmt.Sprintf("Import is larger than %d bytes.", maxImportBytes), r.URL.Path)
+	case err != nil && report == nil:
+		api.WriteBadRequest(w, "Invalid import: "+err.Error(), r.URL.Path)
+	case err != nil:
+		api.WriteInternalServerError(w, err, r.URL.Path)
+	default:
+		log.InfoContext(r.Context(), "Import finished",
+			"products_imported", report.ProductsImported, "history_imported", report.HistoryImported,
+			"products_skipped", report.ProductsSkipped, "history_skipped", report.HistorySkipped)
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// exportFilter validates the store and time range of an export.
+func exportFilter(store, from, to string) (export.Filter, error) {
+	filter := export.Filter{Store: strings.ToLower(store)}
+	if filter.Store != "" && !slices.Contains(supportedStores, filter.Store) {
+		return filter, fmt.Errorf("Store not supported. Available: %s", strings.Join(supportedStores, ", "))
+	}
+
+	var err error
+	if filter.From, err = export.ParseTime(from); err != nil {
+		return filter, fmt.Errorf("Invalid from value: %s. Use a date (2006-01-02) or RFC 3339 timestamp.", from)
+	}
+	if filter.To, err = export.ParseTime(to); err != nil {
+		return filter, fmt.Errorf("Invalid to value: %s. Use a date (2006-01-02) or RFC 3339 timestamp.", to)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("Invalid range: from must be before to.")
+	}
+	return filter, nil
+}
+
+func formatForContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, format := range export.Formats {
+		if mediaType == export.ContentType(format) {
+			return format
+		}
+	}
+	return export.FormatJSON
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hunter-base/pkg/metrics"
+	"hunter-base/pkg/scrapers/common"
+	"hunter-base/pkg/tracing"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Build information, set by the release workflow and the Dockerfiles with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// browserCheckInterval is how long the result of launching Chrome is reused
+// by readiness probes.
+const browserCheckInterval = 5 * time.Minute
+
+// lastScraperRelease is when a scraper slot was last freed, in Unix
+// nanoseconds. Readiness fails when every slot has been taken for too long.
+var lastScraperRelease atomic.Int64
+
+func init() {
+	lastScraperRelease.Store(time.Now().UnixNano())
+}
+
+// acquireScraper takes a slot of scraperSemaphore. It gives up and returns
+// false when ctx is done first, e.g. because the client went away.
+func acquireScraper(ctx context.Context) bool {
+	_, span := tracing.Start(ctx, "scraper.wait")
+	start := time.Now()
+	select {
+	case scraperSemaphore <- struct{}{}:
+		span.End()
+	case <-ctx.Done():
+		tracing.End(span, ctx.Err())
+		return false
+	}
+	metrics.ScraperWait.Observe(time.Since(start).Seconds())
+	metrics.ScraperSlotsBusy.Inc()
+	return true
+}
+
+// releaseScraper frees a slot of scraperSemaphore.
+func releaseScraper() {
+	lastScraperRelease.Store(time.Now().UnixNano())
+	metrics.ScraperSlotsBusy.Dec()
+	<-scraperSemaphore
+}
+
+// versionInfo is the body of GET /version.
+type versionInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Stores    []string `json:"stores"`
+}
+
+func buildInfo() versionInfo {
+	info := versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Stores:    supportedStores,
+	}
+	// Builds without ldflags still know their commit when built from a
+	// git checkout.
+	if info.Commit == "" {
+		info.Commit = "unknown"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range bi.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					info.Commit = setting.Value
+				case "vcs.time":
+					info.BuildDate = cmp.Or(info.BuildDate, setting.Value)
+				}
+			}
+		}
+	}
+	return info
+}
+
+// check is the outcome of one readiness check.
+type check struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// browserCheck caches whether Chrome can be launched, as starting it on
+// every probe would be expensive.
+var browserCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	result    check
+}
+
+func checkBrowser(ctx context.Context) check {
+	browserCheck.mu.Lock()
+	defer browserCheck.mu.Unlock()
+
+	if time.Since(browserCheck.checkedAt) < browserCheckInterval {
+		return browserCheck.result
+	}
+	reported, err := common.CheckBrowser(ctx)
+	if err != nil {
+		browserCheck.result = check{Detail: err.Error()}
+	} else {
+		browserCheck.result = check{OK: true, Detail: reported}
+	}
+	browserCheck.checkedAt = time.Now()
+	return browserCheck.result
+}
+
+func checkDatabase(ctx context.Context) check {
+	if err := productCache.Ping(ctx); err != nil {
+		return check{Detail: err.Error()}
+	}
+	return check{OK: true, Detail: appConfig.Cache.Backend}
+}
+
+// checkScheduler fails when every scraper slot has been taken without any
+// being freed for three browser timeouts, which no healthy scrape including
+// its retries takes, or when the warmup queue is full.
+func checkScheduler() check {
+	busy, slots := len(scraperSemaphore), cap(scraperSemaphore)
+	queued := len(warmupQueue)
+	detail := fmt.Sprintf("%d/%d scraper slots busy, %d/%d warmups queued", busy, slots, queued, cap(warmupQueue))
+
+	stuckAfter := 3 * time.Duration(appConfig.Scraper.BrowserTimeout)
+	idle := time.Since(time.Unix(0, lastScraperRelease.Load()))
+	switch {
+	case busy == slots && idle > stuckAfter:
+		return check{Detail: fmt.Sprintf("%s, none freed for %s", detail, idle.Round(time.Second))}
+	case queued == cap(warmupQueue):
+		return check{Detail: detail + ", warmup queue full"}
+	}
+	return check{OK: true, Detail: detail}
+}
+
+// healthzHandler reports that the process is alive and serving HTTP.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler reports whether requests can be served: the cache is
+// reachable, Chrome can be launched and the scrapers are not wedged. It
+// answers 503 with the failing checks otherwise, and while shutting down.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	checks := map[string]check{
+		"database":  checkDatabase(ctx),
+		"browser":   checkBrowser(ctx),
+		"scheduler": checkScheduler(),
+	}
+	background.mu.Lock()
+	stopping := background.stopping
+	background.mu.Unlock()
+	if stopping {
+		checks["shutdown"] = check{Detail: "shutting down"}
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status, code = "not ready", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// versionHandler reports the build version and the supported stores.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildInfo())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hunter-base/pkg/cache"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeBrowserCheck presets the cached browser check so tests do not depend
+// on Chrome being installed.
+func fakeBrowserCheck(t *testing.T, result check) {
+	t.Helper()
+	browserCheck.mu.Lock()
+	browserCheck.checkedAt, browserCheck.result = time.Now(), result
+	browserCheck.mu.Unlock()
+	t.Cleanup(func() {
+		browserCheck.mu.Lock()
+		browserCheck.checkedAt, browserCheck.result = time.Time{}, check{}
+		browserCheck.mu.Unlock()
+	})
+}
+
+// downStore is a cache store whose database cannot be reached.
+type downStore struct{ cache.Store }
+
+func (downStore) Ping(context.Context) error { return errors.New("connection refused") }
+
+type readiness struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks"`
+}
+
+func getReadiness(t *testing.T) (int, readiness) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	var got readiness
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, got
+}
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, httptest.NewRequest("HEAD", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("HEAD: got status %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, httptest.NewRequest("POST", "/healthz", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d", rr.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	productCache = newTestCache(t)
+	fakeBrowserCheck(t, check{OK: true, Detail: "Chromium 130"})
+
+	code, got := getReadiness(t)
+	if code != http.StatusOK || got.Status != "ready" {
+		t.Fatalf("got %d %+v", code, got)
+	}
+	for _, name := range []string{"database", "browser", "scheduler"} {
+		if !got.Checks[name].OK {
+			t.Errorf("check %s failed: %+v", name, got.Checks[name])
+		}
+	}
+
+	// Every slot taken and none freed for longer than a scrape can take.
+	for range cap(scraperSemaphore) {
+		acquireScraper(context.Background())
+	}
+	lastScraperRelease.Store(time.Now().Add(-time.Hour).UnixNano())
+	code, got = getReadiness(t)
+	for range cap(scraperSemaphore) {
+		releaseScraper()
+	}
+	if code != http.StatusServiceUnavailable || got.Checks["scheduler"].OK {
+		t.Errorf("saturated scheduler: got %d %+v", code, got)
+	}
+
+	productCache = cache.NewWithStore(downStore{cache.NewMemoryStore(0)}, time.Hour)
+	code, got = getReadiness(t)
+	if code != http.StatusServiceUnavailable || got.Status != "not ready" || got.Checks["database"].OK {
+		t.Errorf("unreachable cache: got %d %+v", code, got)
+	}
+}
+
+func TestReadyzWhileShuttingDown(t *testing.T) {
+	productCache = newTestCache(t)
+	fakeBrowserCheck(t, check{OK: true})
+	resetBackground(t)
+	cancelBackground()
+
+	code, got := getReadiness(t)
+	if code != http.StatusServiceUnavailable || got.Checks["shutdown"].OK {
+		t.Errorf("got %d %+v", code, got)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+	version, commit = "v1.2.3", "abc123"
+
+	rr := httptest.NewRecorder()
+	newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/version", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d", rr.Code)
+	}
+	var got versionInfo
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "v1.2.3" || got.Commit != "abc123" || got.GoVersion == "" || len(got.Stores) != len(supportedStores) {
+		t.Errorf("unexpected version: %+v", got)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"hunter-base/pkg/logger"
+	"hunter-base/pkg/scrapers/common"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// background tracks goroutines that outlive the request that started them,
+// such as revalidations, the warmup worker and retention, so shutdown can
+// cancel and wait for them.
+var background = struct {
+	mu       sync.Mutex
+	stopping bool
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}{}
+
+func init() {
+	background.ctx, background.cancel = context.WithCancel(context.Background())
+}
+
+// goBackground runs fn in a tracked goroutine. Its context carries the
+// request ID of from, if any, and is cancelled when shutdown begins; after
+// that goBackground does not start fn and returns false. A panic in fn is
+// logged and counted for store instead of taking down the process.
+func goBackground(from context.Context, store string, fn func(ctx context.Context)) bool {
+	background.mu.Lock()
+	defer background.mu.Unlock()
+	if background.stopping {
+		return false
+	}
+	ctx := background.ctx
+	if id := logger.RequestID(from); id != "" {
+		ctx = logger.WithRequestID(ctx, id)
+	}
+	background.wg.Add(1)
+	go func() {
+		defer background.wg.Done()
+		guard(ctx, store, panicInBackground, func() { fn(ctx) })
+	}()
+	return true
+}
+
+// detachScrape returns a context carrying the values of ctx that is not
+// cancelled with it but when shutdown begins, so a scrape shared by several
+// callers outlives the one that started it but not the process.
+func detachScrape(ctx context.Context) (context.Context, context.CancelFunc) {
+	background.mu.Lock()
+	shutdownCtx := background.ctx
+	background.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(shutdownCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// cancelBackground cancels running background work and scrapes and refuses
+// new background work.
+func cancelBackground() {
+	background.mu.Lock()
+	defer background.mu.Unlock()
+	background.stopping = true
+	background.cancel()
+}
+
+// waitBackground waits for background work until ctx is done and reports
+// whether everything finished in time.
+func waitBackground(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		background.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shutdown stops server from accepting connections, cancels background work
+// and running scrapes and drains in-flight requests for up to timeout. Browsers still
+// running after that are killed and pending log lines are flushed; closing
+// the cache is left to the caller.
+func shutdown(server *http.Server, timeout time.Duration) {
+	log.Info("Shutting down, waiting for running scrapes", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cancelBackground()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warn("Requests still running after shutdown timeout, closing their connections", "timeout", timeout)
+		server.Close()
+	}
+	if !waitBackground(ctx) {
+		log.Warn("Background scrapes still running after shutdown timeout", "timeout", timeout)
+	}
+
+	if n := common.CloseBrowsers(); n > 0 {
+		log.Warn("Killed leftover browsers", "count", n)
+		// Give the scrapes whose browser was killed a moment to fail before
+		// the cache is closed under them.
+		grace, cancelGrace := context.WithTimeout(context.Background(), 2*time.Second)
+		waitBackground(grace)
+		cancelGrace()
+	}
+
+	logger.Flush()
+}
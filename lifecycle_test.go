@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hunter-base/pkg/models"
+	"hunter-base/pkg/resilience"
+	"hunter-base/pkg/scrapers/common"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetBackground undoes shutdown so later tests can start background work.
+func resetBackground(t *testing.T) {
+	t.Cleanup(func() {
+		background.mu.Lock()
+		defer background.mu.Unlock()
+		background.stopping = false
+		background.ctx, background.cancel = context.WithCancel(context.Background())
+	})
+}
+
+func TestShutdownDrainsRequestsAndBackgroundWork(t *testing.T) {
+	resetBackground(t)
+
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{Handler: mux}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+
+	var cancelled atomic.Bool
+	if !goBackground(context.Background(), "", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		cancelled.Store(true)
+	}) {
+		t.Fatal("background work refused before shutdown")
+	}
+
+	var browserKilled atomic.Bool
+	closeBrowser := common.TrackBrowser(func() { browserKilled.Store(true) })
+	defer closeBrowser()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	shutdown(server, 5*time.Second)
+
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("in-flight request: got status %d", got)
+	}
+	if !cancelled.Load() {
+		t.Error("shutdown returned before background work finished")
+	}
+	if !browserKilled.Load() {
+		t.Error("leftover browser was not killed")
+	}
+	if goBackground(context.Background(), "", func(context.Context) {}) {
+		t.Error("background work started after shutdown")
+	}
+}
+
+func TestShutdownGivesUpAfterTimeout(t *testing.T) {
+	resetBackground(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	goBackground(context.Background(), "", func(ctx context.Context) { <-release })
+
+	server := &http.Server{}
+	start := time.Now()
+	shutdown(server, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+}
+
+func TestShutdownCancelsRunningScrapes(t *testing.T) {
+	resetBackground(t)
+	productCache = newTestCache(t)
+	breakers["billa"] = resilience.NewBreaker("billa", 5, time.Minute)
+	defer delete(breakers, "billa")
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	scrape = func(ctx context.Context, store, productID string) (*models.Product, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+		return nil, fmt.Errorf("chromedp execution failed: %w", ctx.Err())
+	}
+	defer func() { scrape = scrapeProduct }()
+
+	scrapeErr := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scrape", func(w http.ResponseWriter, r *http.Request) {
+		_, err := scrapeShared(r.Context(), "billa", "1")
+		scrapeErr <- err
+	})
+	server := &http.Server{Handler: mux}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	go http.Get("http://" + ln.Addr().String() + "/scrape")
+	<-started
+
+	start := time.Now()
+	shutdown(server, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown waited %s for the scrape", elapsed)
+	}
+	if err := <-scrapeErr; resilience.Classify(err) != resilience.ClassCanceled {
+		t.Errorf("scrape error: got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("cancelled scrape was retried: %d attempts", n)
+	}
+	if _, _, ok := productCache.GetStale("billa", "1"); ok {
+		t.Error("cancelled scrape was cached")
+	}
+}
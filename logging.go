@@ -0,0 +1,62 @@
+package main
+
+import (
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/logger"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+var log = logger.For("main")
+
+// requestIDPattern limits request IDs taken from clients to characters that
+// are safe in headers and log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Lines logged for every product lookup are collapsed per minute into
+// summaries such as "cache hits: 412 across 37 products in last 1m0s".
+var (
+	productSubject = []string{"store", "id"}
+
+	cacheHitLog      = logger.NewDeduper("cache hits", logger.DedupOptions{Unit: "products", DistinctBy: productSubject, Logger: log})
+	staleHitLog      = logger.NewDeduper("stale hits", logger.DedupOptions{Unit: "products", DistinctBy: productSubject, Logger: log})
+	negativeHitLog   = logger.NewDeduper("negative cache hits", logger.DedupOptions{Unit: "products", DistinctBy: productSubject, Logger: log})
+	revalidatedLog   = logger.NewDeduper("revalidations", logger.DedupOptions{Unit: "products", DistinctBy: productSubject, Logger: log})
+	staleFallbackLog = logger.NewDeduper("stale fallbacks", logger.DedupOptions{Unit: "products", DistinctBy: productSubject, Logger: log, Limit: 5, Level: slog.LevelWarn})
+)
+
+// configureLogs applies the configured log format and levels, and writes a
+// rotating hunter-base.log in the configured logs directory, if any. The
+// returned function closes the file.
+func configureLogs() (func() error, error) {
+	return logger.Setup(appConfig.Logs.Options())
+}
+
+// withRequestID takes the request ID from the X-Request-ID header or
+// generates one, returns it in the response and adds it to the request
+// context so every line logged for the request carries it. Finished requests
+// are logged, probes only at debug level.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(api.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(api.RequestIDHeader, id)
+		ctx := logger.WithRequestID(r.Context(), id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		switch r.URL.Path {
+		case "/healthz", "/readyz", "/metrics":
+			level = slog.LevelDebug
+		}
+		log.Log(ctx, level, "Request served", "method", r.Method, "path", r.URL.Path,
+			"status", rec.code(), "duration", time.Since(start).Round(time.Millisecond))
+	})
+}
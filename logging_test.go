@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logger.RequestID(r.Context())
+		api.WriteNotFound(w, "Product not found", r.URL.Path)
+	}))
+
+	req := httptest.NewRequest("GET", "/stores/billa/products/1", nil)
+	req.Header.Set(api.RequestIDHeader, "client-id-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if seen != "client-id-1" || rr.Header().Get(api.RequestIDHeader) != "client-id-1" {
+		t.Errorf("client request ID not used: context %q, header %q", seen, rr.Header().Get(api.RequestIDHeader))
+	}
+	var problem api.ProblemDetails
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.RequestID != "client-id-1" {
+		t.Errorf("problem details request_id = %q", problem.RequestID)
+	}
+
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set(api.RequestIDHeader, "bad id\nwith newline")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get(api.RequestIDHeader); got == "" || got != seen || !requestIDPattern.MatchString(got) {
+		t.Errorf("expected a generated request ID, got header %q, context %q", got, seen)
+	}
+}
@@ -1,60 +1,112 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"hunter-base/pkg/api"
 	"hunter-base/pkg/cache"
-	"hunter-base/pkg/logger"
+	"hunter-base/pkg/config"
+	"hunter-base/pkg/metrics"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/politeness"
+	"hunter-base/pkg/proxy"
+	"hunter-base/pkg/resilience"
 	"hunter-base/pkg/scrapers/apotheke"
 	"hunter-base/pkg/scrapers/billa"
+	"hunter-base/pkg/scrapers/common"
 	"hunter-base/pkg/scrapers/hofer"
 	"hunter-base/pkg/scrapers/lidl"
 	"hunter-base/pkg/scrapers/pharmeo"
 	shopApotheke "hunter-base/pkg/scrapers/shopApotheke"
 	"hunter-base/pkg/scrapers/spar"
-	"log"
+	"hunter-base/pkg/tracing"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	scalargo "github.com/bdpiprava/scalar-go"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
-	scraperSemaphore = make(chan struct{}, 3)
+	appConfig        = config.Default(supportedStores)
+	scraperSemaphore = make(chan struct{}, appConfig.Scraper.Concurrency)
 	productCache     *cache.Cache
+	proxyPools       = map[string]*proxy.Pool{}
+	breakers         = map[string]*resilience.Breaker{}
+	scrapeGroup      singleflight.Group
+	retentionPolicy  cache.RetentionPolicy
+	retryPolicies    = resilience.DefaultPolicies()
 )
 
+var supportedStores = []string{"spar", "billa", "lidl", "hofer", "apotheke", "pharmeo", "shop-apotheke"}
+
 func main() {
-	port := "9090"
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "--help") {
+		name, args = args[0], args[1:]
+	}
+	os.Exit(runCommand(name, args))
+}
 
-	dbPath := os.Getenv("CACHE_DB_PATH")
-	if dbPath == "" {
-		dbPath = "./cache.db"
+// serveCommand starts the HTTP server. It is the default command.
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	loader := config.NewLoader(supportedStores)
+	loader.RegisterFlags(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := useConfig(loader); err != nil {
+		return err
 	}
 
-	ttlMinutes := 1440
-	if val := os.Getenv("CACHE_TTL_MINUTES"); val != "" {
-		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
-			ttlMinutes = parsed
-		}
+	closeLogs, err := configureLogs()
+	if err != nil {
+		return fmt.Errorf("logs: %w", err)
 	}
+	defer closeLogs()
 
-	var err error
-	productCache, err = cache.New(dbPath, time.Duration(ttlMinutes)*time.Minute)
+	flushTraces, err := configureTracing(context.Background())
 	if err != nil {
-		log.Fatalf("Failed to initialize cache: %v", err)
+		return fmt.Errorf("tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := flushTraces(ctx); err != nil {
+			log.Warn("Could not flush traces", "error", err)
+		}
+	}()
+
+	if err := setup(); err != nil {
+		return err
 	}
 	defer productCache.Close()
 
-	log.Printf("Cache initialized at %s with TTL %d minutes", dbPath, ttlMinutes)
+	closeAuth, err := configureAuth()
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	defer closeAuth()
 
-	http.HandleFunc("/", rootHandler)
+	retentionPolicy = configureRetention()
+	if interval := time.Duration(appConfig.Retention.Interval); interval > 0 {
+		goBackground(context.Background(), "", func(ctx context.Context) { runRetention(ctx, interval) })
+	}
+
+	port := strconv.Itoa(appConfig.Server.Port)
+	if appConfig.File != "" {
+		log.Info("Configuration loaded", "file", appConfig.File)
+	}
 
 	ip := GetOutboundIP()
 	if ip != nil {
@@ -67,34 +119,195 @@ func main() {
 
 	server := &http.Server{
 		Addr:              ":" + port,
-		Handler:           nil,
-		ReadHeaderTimeout: 15 * time.Second,
-		IdleTimeout:       120 * time.Second,
+		Handler:           newRouter(),
+		ReadHeaderTimeout: time.Duration(appConfig.Server.ReadHeaderTimeout),
+		IdleTimeout:       time.Duration(appConfig.Server.IdleTimeout),
 	}
 
-	log.Fatal(server.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting.
+	stop()
+
+	shutdown(server, time.Duration(appConfig.Server.ShutdownTimeout))
+	log.Info("Shutdown complete")
+	return nil
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	// API requests go to product handler
-	if strings.HasPrefix(r.URL.Path, "/stores/") {
-		productHandler(w, r)
-		return
+// useConfig loads the configuration and makes it the one every subsystem
+// reads from.
+func useConfig(loader *config.Loader) error {
+	cfg, err := loader.Load()
+	if err != nil {
+		return err
 	}
+	appConfig = cfg
+	return nil
+}
 
-	// Serve Scalar docs on root path
-	html, err := scalargo.NewV2(
-		scalargo.WithSpecDir("./"),
-		scalargo.WithMetaDataOpts(
-			scalargo.WithTitle("Price Deal Hunter API"),
-		),
-	)
+// setup opens the cache and applies the scraper configuration shared by the
+// server and the commands that scrape.
+func setup() error {
+	location, err := openProductCache()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("cache: %w", err)
+	}
+	log.Info("Cache initialized", "location", location, "ttl", productCache.TTL(), "max_stale", appConfig.Cache.MaxStale)
+
+	scraperSemaphore = make(chan struct{}, appConfig.Scraper.Concurrency)
+	metrics.ScraperSlots.Set(float64(appConfig.Scraper.Concurrency))
+	common.Configure(appConfig.ScraperSettings())
+
+	if err := configureProxies(); err != nil {
+		productCache.Close()
+		return fmt.Errorf("proxies: %w", err)
+	}
+
+	configurePoliteness()
+	configureResilience()
+	return nil
+}
+
+// openProductCache opens the configured cache backend and applies the TTL
+// policy, and returns where the cache lives.
+func openProductCache() (string, error) {
+	store, location, err := openCacheStore(appConfig.Cache)
+	if err != nil {
+		return "", err
+	}
+	productCache = cache.NewWithStore(store, time.Duration(appConfig.Cache.TTL))
+	configureCachePolicy()
+	return location, nil
+}
+
+// openCacheStore opens the backend selected by cfg.Backend: sqlite at
+// cfg.Path, memory bounded by cfg.MemoryMaxEntries or redis at cfg.RedisURL.
+// It also returns a description of where the cache lives for logging.
+func openCacheStore(cfg config.Cache) (cache.Store, string, error) {
+	switch cfg.Backend {
+	case config.BackendMemory:
+		return cache.NewMemoryStore(cfg.MemoryMaxEntries), fmt.Sprintf("memory (max %d entries)", cfg.MemoryMaxEntries), nil
+	case config.BackendRedis:
+		store, err := cache.NewRedisStore(cfg.RedisURL, cfg.RedisPrefix)
+		return store, "redis", err
+	default:
+		store, err := cache.NewSQLiteStore(cfg.Path)
+		return store, cfg.Path, err
+	}
+}
+
+// configureCachePolicy applies the configured TTLs, including per-store
+// overrides, to the product cache.
+func configureCachePolicy() {
+	cfg := appConfig.Cache
+	policy := cache.TTLPolicy{
+		Default:    time.Duration(cfg.TTL),
+		Stores:     map[string]time.Duration{},
+		Discounted: time.Duration(cfg.DiscountTTL),
+		Adaptive:   cfg.AdaptiveTTL,
+		Min:        time.Duration(cfg.MinTTL),
+		NotFound:   time.Duration(cfg.NotFoundTTL),
+	}
+
+	for _, store := range supportedStores {
+		if ttl := time.Duration(appConfig.Stores[store].CacheTTL); ttl > 0 {
+			policy.Stores[store] = ttl
+			log.Info("Cache TTL for store", "store", store, "ttl", ttl)
+		}
+	}
+
+	productCache.Policy = policy
+	log.Info("Cache TTL policy", "discounted", policy.Discounted, "min", policy.Min, "adaptive", policy.Adaptive, "not_found", policy.NotFound)
+}
+
+// configureRetention returns the configured retention policy.
+func configureRetention() cache.RetentionPolicy {
+	cfg := appConfig.Retention
+	policy := cache.RetentionPolicy{
+		FullHistory: time.Duration(cfg.History),
+		Unrequested: time.Duration(cfg.Unrequested),
+		Vacuum:      cfg.Vacuum,
+	}
+	log.Info("Retention policy", "full_history", policy.FullHistory, "unrequested", policy.Unrequested, "vacuum", policy.Vacuum, "interval", cfg.Interval)
+	return policy
+}
+
+// runRetention applies the retention policy every interval until ctx is
+// cancelled.
+func runRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := productCache.ApplyRetention(retentionPolicy); err != nil {
+			log.Error("Cache retention failed", "error", err)
+		}
+	}
+}
+
+// configureProxies builds a proxy pool per store from its own proxy list
+// and rotation, falling back to the global ones.
+func configureProxies() error {
+	for _, store := range supportedStores {
+		urls, rotation := appConfig.StoreProxies(store)
+		pool, err := proxy.NewPool(urls, rotation)
+		if err != nil {
+			return fmt.Errorf("%s: %w", store, err)
+		}
+		if pool != nil {
+			proxyPools[store] = pool
+			log.Info("Using proxies", "store", store, "count", pool.Len(), "rotation", pool.Rotation)
+		}
+	}
+	return nil
+}
+
+// configurePoliteness applies the configured pacing to the per-domain
+// limiter shared by all scrapers.
+func configurePoliteness() {
+	cfg := appConfig.Politeness.Config()
+	politeness.Configure(cfg)
+	log.Info("Politeness", "min_interval", cfg.MinInterval, "max_per_minute", cfg.MaxPerMinute, "jitter", cfg.Jitter, "robots_txt", cfg.RespectRobots)
+}
+
+// configureResilience applies the configured retry policies per error class
+// and creates one circuit breaker per store.
+func configureResilience() {
+	retryPolicies = appConfig.Retry.Policies()
+	for _, store := range supportedStores {
+		breakers[store] = resilience.NewBreaker(store, appConfig.Breaker.Threshold, time.Duration(appConfig.Breaker.OpenFor))
+	}
+}
+
+// proxyStatusHandler reports the health of every configured proxy per store.
+func proxyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := make(map[string][]proxy.Status, len(proxyPools))
+	for store, pool := range proxyPools {
+		status[store] = pool.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.ErrorContext(r.Context(), "Error encoding proxy status", "error", err)
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fmt.Fprint(w, html)
+}
+
+// configHandler shows the effective configuration with credentials masked.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, appConfig.Redacted())
 }
 
 func GetOutboundIP() net.IP {
@@ -117,64 +330,80 @@ func GetOutboundIP() net.IP {
 	return localAddr.IP
 }
 
+// productHandler serves a single product:
+//
+//	GET /stores/{store}/products/{id}
 func productHandler(w http.ResponseWriter, r *http.Request) {
-	// Path expected: /stores/{store}/products/{id}
-	parts := strings.Split(r.URL.Path, "/")
-	// parts[0] = ""
-	// parts[1] = "stores"
-	// parts[2] = {store}
-	// parts[3] = "products"
-	// parts[4] = {id} or "batch"
-
-	if len(parts) < 5 || parts[3] != "products" {
-		api.WriteBadRequest(w, "Invalid path. Expected /stores/{store}/products/{id} or /stores/{store}/products/batch", r.URL.Path)
+	store, ok := storeParam(w, r)
+	if !ok {
 		return
 	}
-
-	store := strings.ToLower(parts[2])
-	rawID := parts[4]
-
-	if rawID == "batch" {
-		if r.Method != http.MethodPost {
-			api.WriteBadRequest(w, "Method not allowed for batch endpoint. Use POST.", r.URL.Path)
-			return
-		}
-		handleBatchProducts(w, r, store)
+	productID, ok := productIDParam(w, r)
+	if !ok {
 		return
 	}
 
-	if r.Method != http.MethodGet {
-		api.WriteBadRequest(w, "Method not allowed. Use GET for single product.", r.URL.Path)
+	opts, err := cacheOptionsFromRequest(r)
+	if err != nil {
+		api.WriteBadRequest(w, err.Error(), r.URL.Path)
 		return
 	}
 
-	if store != "spar" && store != "billa" && store != "lidl" && store != "hofer" && store != "apotheke" && store != "pharmeo" && store != "shop-apotheke" {
-		api.WriteBadRequest(w, "Store not supported. Available: spar, billa, lidl, hofer, apotheke, pharmeo, shop-apotheke", r.URL.Path)
-		return
+	// HEAD is answered from the cache only, as a scrape would be wasted on
+	// a response without a body.
+	if r.Method == http.MethodHead {
+		opts.CacheOnly, opts.NoCache = true, false
 	}
 
-	// Acquire semaphore to prevent system overload
-	scraperSemaphore <- struct{}{}
-	defer func() { <-scraperSemaphore }()
-
-	// Filter out non-numeric characters from the ID
-	// e.g. "00-626061" -> "00626061"
-	productID := strings.Map(func(r rune) rune {
-		if r >= '0' && r <= '9' {
-			return r
+	// Keys that may not scrape are answered from the cache without waiting
+	// for a scraper slot.
+	limit := scrapeLimit(r.Context())
+	if limit != nil {
+		opts.CacheOnly = true
+	} else if !opts.CacheOnly {
+		// Acquire semaphore to prevent system overload
+		if !acquireScraper(r.Context()) {
+			return
 		}
-		return -1
-	}, rawID)
-
-	if productID == "" {
-		api.WriteBadRequest(w, fmt.Sprintf("Invalid product ID: %s. Must contain at least one digit.", rawID), r.URL.Path)
-		return
+		defer releaseScraper()
 	}
 
-	product, err := getProduct(store, productID)
+	product, err := getProduct(r.Context(), store, productID, opts)
+	if limit != nil && errors.Is(err, errNotCached) {
+		err = limit
+	}
 
 	if err != nil {
-		log.Printf("Error scraping %s %s: %v", store, productID, err)
+		if errors.Is(err, errQuotaExhausted) {
+			writeQuotaExhausted(w, r)
+			return
+		}
+
+		if errors.Is(err, errNotCached) {
+			api.WriteNotFound(w, "Product not cached", r.URL.Path)
+			return
+		}
+
+		if errors.Is(err, errNegativeHit) {
+			w.Header().Set("X-Cache-Status", cache.StatusNegativeHit)
+			api.WriteProblem(w, &api.ProblemDetails{
+				Type:        "about:blank",
+				Title:       "Not Found",
+				Status:      http.StatusNotFound,
+				Detail:      "Product not found",
+				Instance:    r.URL.Path,
+				CacheStatus: cache.StatusNegativeHit,
+			})
+			return
+		}
+
+		log.WarnContext(r.Context(), "Error scraping", "store", store, "id", productID, "error", err)
+
+		if errors.Is(err, resilience.ErrCircuitOpen) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(breakers[store].RetryAfter().Seconds())+1))
+			api.WriteServiceUnavailable(w, fmt.Sprintf("Scraping %s is suspended after repeated failures and nothing is cached for this product", store), r.URL.Path)
+			return
+		}
 
 		if err == models.ErrProductNotFound || strings.Contains(err.Error(), "product not found") {
 			api.WriteNotFound(w, "Product not found", r.URL.Path)
@@ -190,74 +419,294 @@ func productHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeCacheHeaders(w, product)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(product); err != nil {
-		log.Printf("Error encoding response: %v", err)
+		log.ErrorContext(r.Context(), "Error encoding response", "error", err)
 		api.WriteInternalServerError(w, fmt.Errorf("failed to encode response"), r.URL.Path)
 	}
 }
 
-func scrapeProduct(store, productID string) (*models.Product, error) {
+// scrape runs the scraper of a store. It is replaced in tests.
+var scrape = scrapeProduct
+
+func scrapeProduct(ctx context.Context, store, productID string) (*models.Product, error) {
 	switch store {
 	case "spar":
 		scraper := spar.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	case "billa":
 		scraper := billa.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	case "lidl":
 		scraper := lidl.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	case "hofer":
 		scraper := hofer.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	case "apotheke":
 		scraper := apotheke.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	case "pharmeo":
 		scraper := pharmeo.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	case "shop-apotheke":
 		scraper := shopApotheke.NewScraper()
-		return scraper.Scrape(productID)
+		scraper.Strategies = strategiesFor(store, scraper.Strategies)
+		scraper.Proxies = proxyPools[store]
+		return scraper.Scrape(ctx, productID)
 	default:
 		return nil, fmt.Errorf("store not supported. Available: spar, billa, lidl, hofer, apotheke, pharmeo, shop-apotheke")
 	}
 }
 
-func getProduct(store, productID string) (*models.Product, error) {
-	if cached, ok := productCache.Get(store, productID); ok {
-		logger.Dedup("Cache hit for %s/%s", store, productID)
-		go revalidateCache(store, productID)
-		return cached, nil
+// strategiesFor returns the scrape strategy order configured for store
+// (e.g. SPAR_STRATEGIES=browser), or def when unset.
+func strategiesFor(store string, def []common.Strategy) []common.Strategy {
+	configured := appConfig.Stores[store].Strategies
+	if order := common.ParseStrategies(strings.Join(configured, ",")); len(order) > 0 {
+		return order
+	}
+	return def
+}
+
+// getProduct serves a product from the cache or scrapes it, following the
+// request's cache directives. When a scrape fails an expired entry is served
+// instead as long as it is within opts.MaxStale, or of any age while the
+// store's circuit breaker is open.
+func getProduct(ctx context.Context, store, productID string, opts cacheOptions) (*models.Product, error) {
+	_, span := tracing.Start(ctx, "cache.lookup", tracing.Store(store), tracing.Product(productID))
+	cached, scrapedAt, found := productCache.GetStale(store, productID)
+	if found {
+		productCache.Touch(store, productID)
+	}
+	span.SetAttributes(attribute.Bool("hunter.cache_found", found))
+	span.End()
+	expiredFor := time.Since(scrapedAt) - opts.freshFor(productCache.TTLFor(store, productID, cached))
+
+	if found && !opts.NoCache {
+		if expiredFor <= 0 {
+			cacheHitLog.Log(ctx, "Cache hit", "store", store, "id", productID)
+			productCache.RecordLookup(true)
+			if !opts.CacheOnly && !opts.NoRevalidate {
+				revalidateInBackground(ctx, store, productID)
+			}
+			countCacheStatus(ctx, store, cache.StatusHit)
+			return withCacheStatus(cached, cache.StatusHit, scrapedAt), nil
+		}
+		if (opts.AcceptStale || opts.CacheOnly) && expiredFor <= opts.MaxStale {
+			staleHitLog.Log(ctx, "Serving stale entry as requested", "store", store, "id", productID)
+			productCache.RecordLookup(true)
+			if !opts.CacheOnly && !opts.NoRevalidate {
+				revalidateInBackground(ctx, store, productID)
+			}
+			countCacheStatus(ctx, store, cache.StatusStale)
+			return withCacheStatus(cached, cache.StatusStale, scrapedAt), nil
+		}
+	}
+
+	if !opts.NoCache {
+		_, span := tracing.Start(ctx, "cache.lookup_not_found", tracing.Store(store), tracing.Product(productID))
+		_, ok := productCache.GetNotFound(store, productID)
+		span.End()
+		if ok {
+			negativeHitLog.Log(ctx, "Negative cache hit", "store", store, "id", productID)
+			productCache.RecordLookup(true)
+			countCacheStatus(ctx, store, cache.StatusNegativeHit)
+			return nil, errNegativeHit
+		}
 	}
 
-	product, err := scrapeProduct(store, productID)
+	productCache.RecordLookup(false)
+
+	if opts.CacheOnly {
+		countCacheStatus(ctx, store, cache.StatusMiss)
+		return nil, errNotCached
+	}
+
+	product, err := scrapeShared(ctx, store, productID)
+	if !errors.Is(err, resilience.ErrCircuitOpen) {
+		countScrape(ctx)
+	}
 	if err != nil {
+		if found && !errors.Is(err, models.ErrProductNotFound) {
+			circuitOpen := errors.Is(err, resilience.ErrCircuitOpen)
+			if circuitOpen || (!opts.NoCache || opts.AcceptStale) && expiredFor <= opts.MaxStale {
+				staleFallbackLog.Log(ctx, "Scrape failed, serving stale entry", "store", store, "id", productID, "error", err)
+				countCacheStatus(ctx, store, cache.StatusStale)
+				stale := withCacheStatus(cached, cache.StatusStale, scrapedAt)
+				stale.StaleReason = staleReason(err)
+				return stale, nil
+			}
+		}
+		countCacheStatus(ctx, store, cache.StatusMiss)
 		return nil, err
 	}
 
-	productCache.Set(store, productID, product)
-	return product, nil
+	if found {
+		countCacheStatus(ctx, store, cache.StatusRevalidated)
+		return withCacheStatus(product, cache.StatusRevalidated, product.ScrapedAt), nil
+	}
+	countCacheStatus(ctx, store, cache.StatusMiss)
+	return withCacheStatus(product, cache.StatusMiss, product.ScrapedAt), nil
 }
 
-func revalidateCache(store, productID string) {
-	scraperSemaphore <- struct{}{}
-	defer func() { <-scraperSemaphore }()
-
-	product, err := scrapeProduct(store, productID)
+// scrapeShared scrapes a product and stores it in the cache. Concurrent
+// calls for the same product, whether from requests, batches or background
+// revalidation, share a single scrape. Each caller gets its own copy. The
+// scrape keeps the first caller's request ID but is not cancelled with it,
+// as other callers may be waiting for it; shutdown cancels it.
+func scrapeShared(ctx context.Context, store, productID string) (*models.Product, error) {
+	v, err, _ := scrapeGroup.Do(store+"/"+productID, func() (any, error) {
+		ctx, cancel := detachScrape(ctx)
+		defer cancel()
+		product, err := scrapeWithRetry(ctx, store, productID)
+		if err != nil {
+			if resilience.Classify(err) == resilience.ClassNotFound {
+				productCache.SetNotFound(store, productID)
+			}
+			return nil, err
+		}
+		productCache.Set(store, productID, product)
+		return product, nil
+	})
 	if err != nil {
-		log.Printf("Background revalidation failed for %s/%s: %v", store, productID, err)
+		return nil, err
+	}
+
+	product := *v.(*models.Product)
+	return &product, nil
+}
+
+// scrapeResult labels a scrape attempt in metrics.
+func scrapeResult(err error) string {
+	if err == nil {
+		return metrics.ResultOK
+	}
+	return string(resilience.Classify(err))
+}
+
+// staleReason summarizes why a stale entry had to be served.
+func staleReason(err error) string {
+	switch resilience.Classify(err) {
+	case resilience.ClassTimeout:
+		return "Gateway Timeout"
+	case resilience.ClassBlocked, resilience.ClassCloudflare:
+		return "Blocked by store"
+	}
+	if errors.Is(err, resilience.ErrCircuitOpen) {
+		return "Store temporarily unavailable"
+	}
+	return "Scrape failed"
+}
+
+// scrapeWithRetry scrapes through the store's circuit breaker, retrying
+// transient failures according to retryPolicies. A panicking scraper fails
+// the scrape with errPanic and counts against the breaker. It is recovered
+// here because singleflight re-panics in a fresh goroutine when other
+// callers wait for the result, which no handler could recover from.
+func scrapeWithRetry(ctx context.Context, store, productID string) (product *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "scrape", tracing.Store(store), tracing.Product(productID))
+	defer func() { tracing.End(span, err) }()
+
+	breaker := breakers[store]
+	if err := breaker.Allow(); err != nil {
+		metrics.Scrapes.WithLabelValues(store, "circuit_open").Inc()
+		return nil, err
+	}
+
+	attempts := 0
+	scraped := guard(ctx, store, panicInScrape, func() {
+		product, err = resilience.Retry(ctx, retryPolicies, store+"/"+productID, func() (*models.Product, error) {
+			attempts++
+			start := time.Now()
+			product, err := scrape(ctx, store, productID)
+			metrics.ObserveScrape(store, scrapeResult(err), time.Since(start))
+			return product, err
+		})
+	})
+	if !scraped {
+		product, err = nil, fmt.Errorf("%s scraper: %w", store, errPanic)
+	}
+	span.SetAttributes(attribute.Int("hunter.attempts", attempts))
+	breaker.Record(err)
+	return product, err
+}
+
+// revalidateInBackground refreshes a served product after the response, in
+// background work that carries the request ID of ctx and is traced as its own
+// trace linked to the request's.
+func revalidateInBackground(ctx context.Context, store, productID string) {
+	goBackground(ctx, store, func(bg context.Context) {
+		bg, span := tracing.StartLinked(bg, ctx, "revalidate", tracing.Store(store), tracing.Product(productID))
+		defer span.End()
+		revalidateCache(bg, store, productID)
+	})
+}
+
+func revalidateCache(ctx context.Context, store, productID string) {
+	if !acquireScraper(ctx) {
+		metrics.Revalidations.WithLabelValues(store, "cancelled").Inc()
+		return
+	}
+	defer releaseScraper()
+
+	if _, err := scrapeShared(ctx, store, productID); err != nil {
+		log.WarnContext(ctx, "Background revalidation failed", "store", store, "id", productID, "error", err)
+		metrics.Revalidations.WithLabelValues(store, "failed").Inc()
 		return
 	}
+	metrics.Revalidations.WithLabelValues(store, metrics.ResultOK).Inc()
 
-	productCache.Set(store, productID, product)
-	logger.Dedup("Cache revalidated for %s/%s", store, productID)
+	revalidatedLog.Log(ctx, "Cache revalidated", "store", store, "id", productID)
 }
 
-func handleBatchProducts(w http.ResponseWriter, r *http.Request, store string) {
-	if store != "spar" && store != "billa" && store != "lidl" && store != "hofer" && store != "apotheke" && store != "pharmeo" && store != "shop-apotheke" {
-		api.WriteBadRequest(w, "Store not supported. Available: spar, billa, lidl, hofer, apotheke, pharmeo, shop-apotheke", r.URL.Path)
+// lookupBatchItem looks up one product of a batch. The quota is checked per
+// item, as it may run out during the batch. Unless the key may not scrape,
+// the lookup holds a scraper slot, which is released even if it panics. ok is
+// false when the request ended while waiting for a slot.
+func lookupBatchItem(ctx context.Context, store, productID string, opts cacheOptions) (product *models.Product, ok bool, err error) {
+	limit := scrapeLimit(ctx)
+	if limit != nil {
+		opts.CacheOnly = true
+	} else if !acquireScraper(ctx) {
+		return nil, false, nil
+	} else {
+		defer releaseScraper()
+	}
+
+	product, err = getProduct(ctx, store, productID, opts)
+	if limit != nil && errors.Is(err, errNotCached) {
+		err = limit
+	}
+	return product, true, err
+}
+
+// batchProductsHandler looks up the barcodes of a JSON array of objects and
+// adds the result to each object as store_info:
+//
+//	POST /stores/{store}/products/batch
+func batchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	store, ok := storeParam(w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := cacheOptionsFromRequest(r)
+	if err != nil {
+		api.WriteBadRequest(w, err.Error(), r.URL.Path)
 		return
 	}
 
@@ -298,12 +747,20 @@ func handleBatchProducts(w http.ResponseWriter, r *http.Request, store string) {
 			continue
 		}
 
-		scraperSemaphore <- struct{}{}
-		product, err := getProduct(store, productID)
-		<-scraperSemaphore
-
+		product, ok, err := lookupBatchItem(r.Context(), store, productID, opts)
+		if !ok {
+			return
+		}
 		if err != nil {
-			if err == models.ErrProductNotFound || strings.Contains(err.Error(), "product not found") {
+			if errors.Is(err, errQuotaExhausted) {
+				item["store_info"] = map[string]string{"error": "Daily scrape quota exhausted"}
+			} else if errors.Is(err, errNotCached) {
+				item["store_info"] = map[string]string{"error": "Product not cached"}
+			} else if errors.Is(err, errNegativeHit) {
+				item["store_info"] = map[string]string{"error": "Product not found", "cache_status": cache.StatusNegativeHit}
+			} else if errors.Is(err, resilience.ErrCircuitOpen) {
+				item["store_info"] = map[string]string{"error": "Service Unavailable"}
+			} else if err == models.ErrProductNotFound || strings.Contains(err.Error(), "product not found") {
 				item["store_info"] = map[string]string{"error": "Product not found"}
 			} else if strings.Contains(err.Error(), "context deadline exceeded") || strings.Contains(err.Error(), "Client.Timeout") || strings.Contains(err.Error(), "timeout") {
 				item["store_info"] = map[string]string{"error": "Gateway Timeout"}
@@ -317,7 +774,7 @@ func handleBatchProducts(w http.ResponseWriter, r *http.Request, store string) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(batch); err != nil {
-		log.Printf("Error encoding batch response: %v", err)
+		log.ErrorContext(r.Context(), "Error encoding batch response", "error", err)
 		api.WriteInternalServerError(w, fmt.Errorf("failed to encode response"), r.URL.Path)
 	}
 }
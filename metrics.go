@@ -0,0 +1,83 @@
+package main
+
+import (
+	"hunter-base/pkg/metrics"
+	"hunter-base/pkg/router"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// routeOf is the route r was served by, such as
+// /stores/{store}/products/{id}, so product IDs do not end up in metric
+// labels. Requests no route matched are reported as "other".
+func routeOf(r *http.Request) string {
+	if route := router.Route(r); route != "" {
+		return route
+	}
+	return "other"
+}
+
+// methodLabel keeps arbitrary request methods out of metric labels.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// code returns the status written, which is 200 when the handler wrote
+// nothing.
+func (r *statusRecorder) code() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument records the count and duration of requests served by next,
+// including responses cut off by a panic.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			method, route := methodLabel(r.Method), routeOf(r)
+			metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(rec.code())).Inc()
+			metrics.HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// metricsHandler serves the Prometheus metrics.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/metrics"
+	"hunter-base/pkg/models"
+	"hunter-base/pkg/router"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRouteOf(t *testing.T) {
+	tests := map[string]string{
+		"/":                              "/",
+		"/metrics":                       "/metrics",
+		"/admin/cache/stats":             "/admin/cache/stats",
+		"/admin/cache/billa":             "/admin/cache/{store}",
+		"/admin/cache/billa/00626061":    "/admin/cache/{store}/{id}",
+		"/stores/billa/products/0062606": "/stores/{store}/products/{id}",
+		"/stores/spar/products/batch":    "/stores/{store}/products/batch",
+		"/stores/spar/products/1/extra":  "other",
+		"/favicon.ico":                   "other",
+	}
+	handler := newRouter()
+	for path, want := range tests {
+		// OPTIONS is answered by the router, so no handler runs.
+		status := "204"
+		if want == "other" {
+			status = "404"
+		}
+		counter := metrics.HTTPRequests.WithLabelValues("OPTIONS", want, status)
+		before := testutil.ToFloat64(counter)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("OPTIONS", path, nil))
+		if got := testutil.ToFloat64(counter); got != before+1 {
+			t.Errorf("%s was not counted as route %q with status %s", path, want, status)
+		}
+	}
+}
+
+func TestInstrumentCountsAbortedResponses(t *testing.T) {
+	r := router.New(instrument, withRecovery)
+	r.HandleFunc("GET /broken", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("id,name\n"))
+		panic("broken row")
+	})
+	counter := metrics.HTTPRequests.WithLabelValues("GET", "/broken", "200")
+	before := testutil.ToFloat64(counter)
+
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("got panic %v, want http.ErrAbortHandler", v)
+			}
+		}()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/broken", nil))
+	}()
+	if got := testutil.ToFloat64(counter); got != before+1 {
+		t.Errorf("aborted request: got %v, want %v", got, before+1)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	productCache = newTestCache(t)
+	productCache.Set("billa", "00626061", &models.Product{Source: "BILLA", ID: "00626061", Name: "Milk", ScrapedAt: time.Now()})
+	handler := newRouter()
+
+	hits := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("billa", cache.StatusHit))
+	requests := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/stores/{store}/products/{id}", "200"))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/stores/billa/products/00626061?cache_only=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("product: got status %d", rr.Code)
+	}
+
+	if got := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("billa", cache.StatusHit)); got != hits+1 {
+		t.Errorf("cache hits: got %v, want %v", got, hits+1)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/stores/{store}/products/{id}", "200")); got != requests+1 {
+		t.Errorf("HTTP requests: got %v, want %v", got, requests+1)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("metrics: got status %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`hunter_cache_requests_total{status="hit",store="billa"}`,
+		`hunter_http_requests_total{method="GET",route="/stores/{store}/products/{id}",status="200"}`,
+		"hunter_scraper_slots_busy",
+		"hunter_browsers_running",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output is missing %s", want)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"net/http"
 )
 
+// RequestIDHeader carries the ID of a request in both directions.
+const RequestIDHeader = "X-Request-ID"
+
 // follows RFC 7807: Problem Details for HTTP APIs
 type ProblemDetails struct {
 	Type     string `json:"type"`
@@ -13,6 +16,10 @@ type ProblemDetails struct {
 	Status   int    `json:"status"`
 	Detail   string `json:"detail"`
 	Instance string `json:"instance,omitempty"`
+	// CacheStatus is set when the error itself was served from the cache.
+	CacheStatus string `json:"cache_status,omitempty"`
+	// RequestID identifies the request in the logs.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func (pd *ProblemDetails) Error() string {
@@ -20,16 +27,23 @@ func (pd *ProblemDetails) Error() string {
 }
 
 func WriteError(w http.ResponseWriter, status int, title, detail, instance string) {
-	w.Header().Set("Content-Type", "application/problem+json")
-	w.WriteHeader(status)
-
-	pd := &ProblemDetails{
+	WriteProblem(w, &ProblemDetails{
 		Type:     "about:blank",
 		Title:    title,
 		Status:   status,
 		Detail:   detail,
 		Instance: instance,
+	})
+}
+
+// WriteProblem writes pd as is, for problems with extension members. The
+// request ID is taken from the response header if pd has none.
+func WriteProblem(w http.ResponseWriter, pd *ProblemDetails) {
+	if pd.RequestID == "" {
+		pd.RequestID = w.Header().Get(RequestIDHeader)
 	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(pd.Status)
 
 	json.NewEncoder(w).Encode(pd)
 }
@@ -45,3 +59,7 @@ func WriteBadRequest(w http.ResponseWriter, detail, instance string) {
 func WriteNotFound(w http.ResponseWriter, detail, instance string) {
 	WriteError(w, http.StatusNotFound, "Not Found", detail, instance)
 }
+
+func WriteServiceUnavailable(w http.ResponseWriter, detail, instance string) {
+	WriteError(w, http.StatusServiceUnavailable, "Service Unavailable", detail, instance)
+}
@@ -0,0 +1,157 @@
+// Package auth manages API keys: their scopes, rate limits and daily scrape
+// quotas, and how much each key was used per day.
+//
+// Keys look like "hb_<id>_<secret>". Only a SHA-256 hash of the whole key is
+// stored, so a key is shown once when it is created and cannot be recovered
+// afterwards. The random secret is long enough that a fast hash is safe.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope is a permission granted to a key.
+type Scope string
+
+// Scopes. Product lookups need ScopeRead or ScopeScrape; only keys with
+// ScopeScrape may trigger scrapes, read-only keys are answered from the cache.
+const (
+	ScopeRead   Scope = "read"
+	ScopeScrape Scope = "scrape"
+	ScopeAdmin  Scope = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []Scope{ScopeRead, ScopeScrape, ScopeAdmin}
+
+// Limits applied to a key when none are given.
+const (
+	DefaultRatePerMinute = 60
+	DefaultDailyScrapes  = 200
+)
+
+// keyPrefix starts every key, so leaked keys are easy to search for.
+const keyPrefix = "hb_"
+
+var (
+	// ErrInvalidKey is returned for keys that are malformed, unknown or
+	// revoked.
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrKeyNotFound is returned for unknown key IDs.
+	ErrKeyNotFound = errors.New("API key not found")
+)
+
+// Key is an API key without its secret.
+type Key struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+	// RatePerMinute caps the requests per minute; 0 is unlimited.
+	RatePerMinute int `json:"rate_per_minute"`
+	// DailyScrapes caps the scrapes per UTC day; 0 is unlimited.
+	DailyScrapes int        `json:"daily_scrapes"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	// Today is the usage of the current UTC day, filled in by Store.Keys.
+	Today *Usage `json:"today,omitempty"`
+}
+
+// Has reports whether k was granted scope.
+func (k *Key) Has(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Usage counts what a key did on one UTC day.
+type Usage struct {
+	// Day is the date, e.g. "2026-10-18".
+	Day string `json:"day"`
+	// Requests counts authenticated requests, including rejected ones.
+	Requests int64 `json:"requests"`
+	// Scrapes counts product lookups that scraped a store.
+	Scrapes int64 `json:"scrapes"`
+	// Rejected counts requests refused for the rate limit, quota or scope.
+	Rejected int64 `json:"rejected"`
+}
+
+// ParseScopes parses a comma-separated list of scopes, e.g. "read,admin".
+func ParseScopes(raw string) ([]Scope, error) {
+	var scopes []Scope
+	for _, item := range strings.Split(raw, ",") {
+		scope := Scope(strings.ToLower(strings.TrimSpace(item)))
+		if scope == "" || slices.Contains(scopes, scope) {
+			continue
+		}
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q (use read, scrape or admin)", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	slices.Sort(scopes)
+	return scopes, nil
+}
+
+// newKey returns a random key and its ID.
+func newKey() (id, key string, err error) {
+	raw := make([]byte, 25)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	id = hex.EncodeToString(raw[:4])
+	secret := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw[4:]))
+	return id, keyPrefix + id + "_" + secret, nil
+}
+
+// keyID returns the ID part of key.
+func keyID(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	return id, ok && len(id) == 8 && secret != ""
+}
+
+// hashKey is the stored form of key.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// day is the UTC date of t in Usage.Day format.
+func day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// UntilReset is the time from now until daily quotas reset at UTC midnight.
+func UntilReset(now time.Time) time.Duration {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
+
+type contextKey struct{}
+
+// WithKey returns a context that carries the key a request authenticated
+// with.
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the key of the request, or nil when the request was
+// not authenticated, e.g. because auth is disabled.
+func FromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(contextKey{}).(*Key)
+	return key
+}
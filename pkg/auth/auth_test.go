@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	s := newTestStore(t)
+
+	key, secret, err := s.Create("dashboard", []Scope{ScopeRead, ScopeScrape}, 30, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "hb_"+key.ID+"_") {
+		t.Errorf("secret %q does not carry the key ID %q", secret, key.ID)
+	}
+
+	var stored string
+	if err := s.db.QueryRow(`SELECT hash FROM api_keys WHERE id = ?`, key.ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, secret) || stored != hashKey(secret) {
+		t.Errorf("key is not stored hashed: %q", stored)
+	}
+
+	got, err := s.Authenticate(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "dashboard" || !got.Has(ScopeScrape) || got.Has(ScopeAdmin) || got.RatePerMinute != 30 || got.DailyScrapes != 100 {
+		t.Errorf("unexpected key %+v", got)
+	}
+
+	for _, bad := range []string{"", "secret", "hb_" + key.ID + "_wrong", secret + "x", strings.Replace(secret, key.ID, "00000000", 1)} {
+		if _, err := s.Authenticate(bad); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidKey", bad, err)
+		}
+	}
+
+	if revoked, err := s.Revoke(key.ID); err != nil || !revoked {
+		t.Fatalf("Revoke = %v, %v", revoked, err)
+	}
+	if _, err := s.Authenticate(secret); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("revoked key still authenticates: %v", err)
+	}
+	if revoked, _ := s.Revoke(key.ID); revoked {
+		t.Error("revoking twice reported success")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	key, _, err := s.Create("cron", []Scope{ScopeScrape}, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []Usage{{Requests: 1, Scrapes: 1}, {Requests: 1}, {Requests: 1, Rejected: 1}} {
+		if err := s.Record(key.ID, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if scrapes, _ := s.ScrapesToday(key.ID); scrapes != 1 {
+		t.Errorf("scrapes today = %d, want 1", scrapes)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if scrapes, _ := s.ScrapesToday(key.ID); scrapes != 0 {
+		t.Errorf("scrapes did not reset at midnight: %d", scrapes)
+	}
+	s.Record(key.ID, Usage{Requests: 1, Scrapes: 1})
+
+	usage, err := s.Usage(key.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Usage{{Day: "2026-10-18", Requests: 1, Scrapes: 1}, {Day: "2026-10-17", Requests: 3, Scrapes: 1, Rejected: 1}}
+	if len(usage) != 2 || usage[0] != want[0] || usage[1] != want[1] {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || *keys[0].Today != want[0] || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(now) {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" scrape, READ,scrape ")
+	if err != nil || joinScopes(scopes) != "read,scrape" {
+		t.Errorf("ParseScopes = %v, %v", scopes, err)
+	}
+	for _, bad := range []string{"", " , ", "read,write"} {
+		if _, err := ParseScopes(bad); err == nil {
+			t.Errorf("ParseScopes(%q) should fail", bad)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if ok, _ := l.Allow("a", 3); !ok {
+			t.Fatalf("request %d rejected", i+1)
+		}
+	}
+	now = now.Add(20 * time.Second)
+	if ok, retry := l.Allow("a", 3); ok || retry != 40*time.Second {
+		t.Errorf("fourth request: ok=%v retry=%v", ok, retry)
+	}
+	if ok, _ := l.Allow("b", 3); !ok {
+		t.Error("limits are not per key")
+	}
+	if ok, _ := l.Allow("a", 0); !ok {
+		t.Error("0 should be unlimited")
+	}
+
+	now = now.Add(40 * time.Second)
+	if ok, _ := l.Allow("a", 3); !ok {
+		t.Error("window did not reset after a minute")
+	}
+}
+
+func TestUntilReset(t *testing.T) {
+	if got := UntilReset(time.Date(2026, 10, 18, 22, 30, 0, 0, time.UTC)); got != 90*time.Minute {
+		t.Errorf("UntilReset = %v", got)
+	}
+}
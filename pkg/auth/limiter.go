@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter enforces per-key request rates in fixed one-minute windows. It is
+// kept in memory, so limits start over when the process restarts.
+type Limiter struct {
+	mu      sync.Mutex
+	windows map[string]*window
+	now     func() time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// NewLimiter returns an empty Limiter.
+func NewLimiter() *Limiter {
+	return &Limiter{windows: map[string]*window{}, now: time.Now}
+}
+
+// Allow counts a request of the key and reports whether it is within
+// perMinute, 0 being unlimited. Otherwise it returns how long until the
+// window ends.
+func (l *Limiter) Allow(id string, perMinute int) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	w, ok := l.windows[id]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &window{start: now}
+		l.windows[id] = w
+	}
+	if w.count >= perMinute {
+		return false, w.start.Add(time.Minute).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/logger"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var log = logger.For("auth")
+
+// sqliteTime is the fixed-width UTC layout of timestamps stored as text.
+const sqliteTime = "2006-01-02T15:04:05.000000000Z"
+
+// migration is one step of the key schema, applied in order and never edited
+// once released.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var migrations = []migration{
+	{1, "create api keys", `
+		CREATE TABLE api_keys (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			rate_per_minute INTEGER NOT NULL,
+			daily_scrapes INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			last_used_at TEXT
+		);
+		CREATE TABLE api_key_usage (
+			key_id TEXT NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+			day TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			scrapes INTEGER NOT NULL DEFAULT 0,
+			rejected INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (key_id, day)
+		);
+	`},
+}
+
+// Store keeps API keys and their usage in a SQLite database. It is safe for
+// concurrent use.
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens or creates the key database at path and migrates it to the
+// latest schema.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// migrate applies the missing migrations, each in a transaction with its
+// schema_version row.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("key database schema version %d is newer than supported version %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		log.Info("Applied schema migration", "version", m.version, "name", m.name)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create stores a new key and returns it together with the secret key, which
+// is not stored and cannot be shown again.
+func (s *Store) Create(name string, scopes []Scope, ratePerMinute, dailyScrapes int) (*Key, string, error) {
+	if name == "" {
+		return nil, "", errors.New("a key needs a name")
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.New("a key needs at least one scope")
+	}
+	if ratePerMinute < 0 || dailyScrapes < 0 {
+		return nil, "", errors.New("limits must not be negative")
+	}
+
+	id, secret, err := newKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &Key{
+		ID:            id,
+		Name:          name,
+		Scopes:        scopes,
+		RatePerMinute: ratePerMinute,
+		DailyScrapes:  dailyScrapes,
+		CreatedAt:     s.now().UTC().Truncate(time.Microsecond),
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO api_keys (id, name, hash, scopes, rate_per_minute, daily_scrapes, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, hashKey(secret), joinScopes(scopes), ratePerMinute, dailyScrapes, key.CreatedAt.Format(sqliteTime),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// Authenticate returns the key matching secret, or ErrInvalidKey.
+func (s *Store) Authenticate(secret string) (*Key, error) {
+	id, ok := keyID(secret)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	key, hash, err := s.get(id)
+	if errors.Is(err, ErrKeyNotFound) || (err == nil && subtle.ConstantTimeCompare([]byte(hash), []byte(hashKey(secret))) != 1) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Get returns the key with the given ID, or ErrKeyNotFound.
+func (s *Store) Get(id string) (*Key, error) {
+	key, _, err := s.get(id)
+	return key, err
+}
+
+func (s *Store) get(id string) (*Key, string, error) {
+	row := s.db.QueryRow(
+		`SELECT id, name, scopes, rate_per_minute, daily_scrapes, created_at, last_used_at, hash
+		 FROM api_keys WHERE id = ?`, id)
+	var hash string
+	key, err := scanKey(row, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrKeyNotFound
+	}
+	return key, hash, err
+}
+
+// Keys returns every key with today's usage, oldest first.
+func (s *Store) Keys() ([]Key, error) {
+	rows, err := s.db.Query(
+		`SELECT k.id, k.name, k.scopes, k.rate_per_minute, k.daily_scrapes, k.created_at, k.last_used_at,
+		        COALESCE(u.requests, 0), COALESCE(u.scrapes, 0), COALESCE(u.rejected, 0)
+		 FROM api_keys k LEFT JOIN api_key_usage u ON u.key_id = k.id AND u.day = ?
+		 ORDER BY k.created_at, k.id`, day(s.now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		today := Usage{Day: day(s.now())}
+		key, err := scanKey(rows, &today.Requests, &today.Scrapes, &today.Rejected)
+		if err != nil {
+			return nil, err
+		}
+		key.Today = &today
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke deletes the key with the given ID and its usage, and reports
+// whether it existed.
+func (s *Store) Revoke(id string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Record adds the counts of u to today's usage of the key. Requests also
+// update when the key was last used.
+func (s *Store) Record(id string, u Usage) error {
+	now := s.now()
+	_, err := s.db.Exec(
+		`INSERT INTO api_key_usage (key_id, day, requests, scrapes, rejected) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (key_id, day) DO UPDATE SET
+			requests = requests + excluded.requests,
+			scrapes = scrapes + excluded.scrapes,
+			rejected = rejected + excluded.rejected`,
+		id, day(now), u.Requests, u.Scrapes, u.Rejected,
+	)
+	if err != nil || u.Requests == 0 {
+		return err
+	}
+	_, err = s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now.UTC().Format(sqliteTime), id)
+	return err
+}
+
+// Usage returns the usage of the key over the last days days, including
+// today, newest first. Days without requests are left out.
+func (s *Store) Usage(id string, days int) ([]Usage, error) {
+	since := day(s.now().AddDate(0, 0, 1-days))
+	rows, err := s.db.Query(
+		`SELECT day, requests, scrapes, rejected FROM api_key_usage
+		 WHERE key_id = ? AND day >= ? ORDER BY day DESC`, id, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []Usage{}
+	for rows.Next() {
+		var u Usage
+		if err := rows.Scan(&u.Day, &u.Requests, &u.Scrapes, &u.Rejected); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// ScrapesToday returns how many scrapes the key made on the current UTC day.
+func (s *Store) ScrapesToday(id string) (int64, error) {
+	var scrapes int64
+	err := s.db.QueryRow(`SELECT scrapes FROM api_key_usage WHERE key_id = ? AND day = ?`, id, day(s.now())).Scan(&scrapes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return scrapes, err
+}
+
+// scanKey scans the key columns of a row, followed by extra.
+func scanKey(row interface{ Scan(...any) error }, extra ...any) (*Key, error) {
+	var key Key
+	var scopes, createdAt string
+	var lastUsedAt sql.NullString
+	dest := append([]any{&key.ID, &key.Name, &scopes, &key.RatePerMinute, &key.DailyScrapes, &createdAt, &lastUsedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	for _, scope := range strings.Split(scopes, ",") {
+		key.Scopes = append(key.Scopes, Scope(scope))
+	}
+	var err error
+	if key.CreatedAt, err = time.Parse(sqliteTime, createdAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		t, err := time.Parse(sqliteTime, lastUsedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &t
+	}
+	return &key, nil
+}
+
+func joinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, ",")
+}
@@ -1,88 +1,278 @@
 package cache
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
-	"log"
 	"time"
+)
+
+var log = logger.For("cache")
 
-	_ "modernc.org/sqlite"
+// Cache statuses reported to clients alongside a product.
+const (
+	StatusHit         = "hit"
+	StatusMiss        = "miss"
+	StatusStale       = "stale"
+	StatusRevalidated = "revalidated"
+	StatusNegativeHit = "negative-hit"
 )
 
-type Cache struct {
-	db  *sql.DB
-	ttl time.Duration
+// Store is a cache backend. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns a cached product and when it was scraped.
+	Get(store, productID string) (*models.Product, time.Time, bool, error)
+	// Set stores a product and drops any not-found marker for it.
+	Set(store, productID string, product *models.Product) error
+	// Delete removes a product and its not-found marker and reports whether
+	// anything was removed.
+	Delete(store, productID string) (bool, error)
+	// DeleteStore removes every product and not-found marker of a store and
+	// returns how many products were removed.
+	DeleteStore(store string) (int64, error)
+	// List returns the products of store, or of every store when store is
+	// empty, ordered from oldest to newest.
+	List(store string) ([]Record, error)
+	// ListPage returns at most limit products of store, or of every store
+	// when store is empty, ordered from oldest to newest after skipping
+	// offset, and how many products match in total. A non-nil before keeps
+	// only products scraped before the cutoff of their store. A limit of
+	// zero returns every match.
+	ListPage(store string, before *Cutoffs, limit, offset int) ([]Record, int, error)
+	// CountEntries counts the products of each store, those scraped before
+	// the cutoff of their store and, for each of times, those scraped before
+	// that time.
+	CountEntries(before Cutoffs, times []time.Time) (map[string]EntryCounts, error)
+	// Touch records that a client requested the product at the given time.
+	// Newly stored products count as requested when they are stored.
+	Touch(store, productID string, at time.Time) error
+	// EvictUnrequested removes products last requested before the given
+	// time and returns how many were removed.
+	EvictUnrequested(before time.Time) (int64, error)
+
+	// GetNotFound returns when the product was last found missing.
+	GetNotFound(store, productID string) (time.Time, bool, error)
+	// SetNotFound remembers that the product was missing at checkedAt.
+	SetNotFound(store, productID string, checkedAt time.Time) error
+	// ClearNotFound removes the not-found markers of store, or of every store
+	// when store is empty, and returns how many were removed.
+	ClearNotFound(store string) (int64, error)
+	// CountNotFound returns the number of not-found markers per store.
+	CountNotFound() (map[string]int, error)
+
+	// RecordPrice appends a price observation to the product's history.
+	RecordPrice(store, productID string, price float64, at time.Time) error
+	// PriceChanges returns when the price of a product changed since the
+	// given time, oldest first. The first observation in that range counts
+	// as a change.
+	PriceChanges(store, productID string, since time.Time) ([]time.Time, error)
+	// DownsampleHistory drops observations before the given time that repeat
+	// the previous price on the same UTC day, keeping every change and one
+	// observation per day. It returns how many were dropped.
+	DownsampleHistory(before time.Time) (int64, error)
+	// History returns the price observations of store, or of every store
+	// when store is empty, recorded in [from, to), oldest first. A zero from
+	// or to leaves that end open.
+	History(store string, from, to time.Time) ([]PriceRecord, error)
+	// ImportPrice adds a price observation unless the product already has
+	// one recorded at the same time, and reports whether it was added.
+	ImportPrice(store, productID string, price float64, at time.Time) (bool, error)
+
+	// AddWatch adds a product to the watchlist, or updates its target price
+	// and note when it is already watched.
+	AddWatch(watch Watch) error
+	// RemoveWatch removes a product from the watchlist and reports whether
+	// it was watched.
+	RemoveWatch(store, productID string) (bool, error)
+	// Watches returns the watchlist ordered by store and product ID.
+	Watches() ([]Watch, error)
+
+	// Size returns the storage used in bytes, or an estimate of it.
+	Size() (int64, error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	Close() error
 }
 
-func New(dbPath string, ttl time.Duration) (*Cache, error) {
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, err
+// Vacuumer is implemented by stores that can compact their storage.
+type Vacuumer interface {
+	Vacuum() error
+}
+
+// Record is a cached product as returned by Store.List.
+type Record struct {
+	Store     string
+	ProductID string
+	Product   *models.Product
+	ScrapedAt time.Time
+}
+
+// Cutoffs is a point in time per store for Store.ListPage and
+// Store.CountEntries. Stores without their own cutoff use Default.
+type Cutoffs struct {
+	Default time.Time
+	Stores  map[string]time.Time
+}
+
+// For returns the cutoff of store.
+func (c Cutoffs) For(store string) time.Time {
+	if cutoff, ok := c.Stores[store]; ok {
+		return cutoff
 	}
+	return c.Default
+}
+
+// EntryCounts is what Store.CountEntries counts for one store.
+type EntryCounts struct {
+	// Entries is the number of products.
+	Entries int
+	// Before is the number of products scraped before the store's cutoff.
+	Before int
+	// Older holds, for each of the requested times, the number of products
+	// scraped before it.
+	Older []int
+}
+
+// PriceRecord is a price observation as returned by Store.History.
+type PriceRecord struct {
+	Store      string
+	ProductID  string
+	Price      float64
+	RecordedAt time.Time
+}
+
+// Cache applies TTL policies and bookkeeping on top of a Store.
+type Cache struct {
+	// Policy decides per entry how long it stays fresh.
+	Policy TTLPolicy
+
+	store   Store
+	lookups lookups
+}
 
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS products (
-			store TEXT NOT NULL,
-			product_id TEXT NOT NULL,
-			data TEXT NOT NULL,
-			scraped_at DATETIME NOT NULL,
-			PRIMARY KEY (store, product_id)
-		)
-	`)
+// New opens the SQLite cache at dbPath. See NewSQLiteStore.
+func New(dbPath string, ttl time.Duration) (*Cache, error) {
+	store, err := NewSQLiteStore(dbPath)
 	if err != nil {
-		db.Close()
 		return nil, err
 	}
+	return NewWithStore(store, ttl), nil
+}
 
-	return &Cache{db: db, ttl: ttl}, nil
+// NewWithStore creates a cache on top of store with a default TTL of ttl.
+func NewWithStore(store Store, ttl time.Duration) *Cache {
+	return &Cache{store: store, Policy: TTLPolicy{Default: ttl}}
 }
 
 func (c *Cache) Get(store, productID string) (*models.Product, bool) {
-	var data string
-	var scrapedAt time.Time
-
-	err := c.db.QueryRow(
-		`SELECT data, scraped_at FROM products WHERE store = ? AND product_id = ?`,
-		store, productID,
-	).Scan(&data, &scrapedAt)
+	product, scrapedAt, ok := c.GetStale(store, productID)
+	if !ok || time.Since(scrapedAt) > c.TTLFor(store, productID, product) {
+		return nil, false
+	}
+	return product, true
+}
 
+// GetStale returns the cached product regardless of the TTL, together with
+// the time it was scraped.
+func (c *Cache) GetStale(store, productID string) (*models.Product, time.Time, bool) {
+	product, scrapedAt, ok, err := c.store.Get(store, productID)
 	if err != nil {
-		return nil, false
+		log.Error("Failed to read product", "store", store, "id", productID, "error", err)
+		return nil, time.Time{}, false
 	}
+	return product, scrapedAt, ok
+}
 
-	if time.Since(scrapedAt) > c.ttl {
-		return nil, false
+func (c *Cache) Set(store, productID string, product *models.Product) {
+	if err := c.store.Set(store, productID, product); err != nil {
+		log.Error("Failed to store product", "store", store, "id", productID, "error", err)
+		return
 	}
 
-	var product models.Product
-	if err := json.Unmarshal([]byte(data), &product); err != nil {
-		log.Printf("Cache: failed to unmarshal product %s/%s: %v", store, productID, err)
-		return nil, false
+	// Prices of zero (unavailable or unparsed) would count as changes.
+	if product.Price == 0 {
+		return
 	}
+	if err := c.store.RecordPrice(store, productID, product.Price, product.ScrapedAt); err != nil {
+		log.Error("Failed to record price history", "store", store, "id", productID, "error", err)
+	}
+}
 
-	return &product, true
+// Touch records that a client requested the product, which keeps it from
+// being evicted by retention.
+func (c *Cache) Touch(store, productID string) {
+	if err := c.store.Touch(store, productID, time.Now()); err != nil {
+		log.Error("Failed to record request", "store", store, "id", productID, "error", err)
+	}
 }
 
-func (c *Cache) Set(store, productID string, product *models.Product) {
-	data, err := json.Marshal(product)
-	if err != nil {
-		log.Printf("Cache: failed to marshal product %s/%s: %v", store, productID, err)
-		return
+// GetNotFound reports whether the product was recently found missing at the
+// store, within the policy's NotFound TTL, and when that was checked.
+func (c *Cache) GetNotFound(store, productID string) (time.Time, bool) {
+	if c.Policy.NotFound <= 0 {
+		return time.Time{}, false
 	}
 
-	_, err = c.db.Exec(
-		`INSERT INTO products (store, product_id, data, scraped_at)
-		 VALUES (?, ?, ?, ?)
-		 ON CONFLICT(store, product_id)
-		 DO UPDATE SET data = excluded.data, scraped_at = excluded.scraped_at`,
-		store, productID, string(data), product.ScrapedAt,
-	)
+	checkedAt, ok, err := c.store.GetNotFound(store, productID)
 	if err != nil {
-		log.Printf("Cache: failed to store product %s/%s: %v", store, productID, err)
+		log.Error("Failed to read not-found entry", "store", store, "id", productID, "error", err)
+		return time.Time{}, false
+	}
+	if !ok || time.Since(checkedAt) > c.Policy.NotFound {
+		return time.Time{}, false
+	}
+	return checkedAt, true
+}
+
+// SetNotFound remembers that the store has no such product.
+func (c *Cache) SetNotFound(store, productID string) {
+	if c.Policy.NotFound <= 0 {
+		return
+	}
+	if err := c.store.SetNotFound(store, productID, time.Now()); err != nil {
+		log.Error("Failed to store not-found entry", "store", store, "id", productID, "error", err)
 	}
 }
 
+// ClearNotFound removes the not-found entries of store, or of every store
+// when store is empty, and returns how many were removed.
+func (c *Cache) ClearNotFound(store string) (int64, error) {
+	return c.store.ClearNotFound(store)
+}
+
+// Delete removes a cached product and any not-found entry for it. It reports
+// whether anything was removed.
+func (c *Cache) Delete(store, productID string) (bool, error) {
+	return c.store.Delete(store, productID)
+}
+
+// DeleteStore removes every cached product of store and returns how many
+// were removed. Not-found entries are cleared as well.
+func (c *Cache) DeleteStore(store string) (int64, error) {
+	return c.store.DeleteStore(store)
+}
+
+// Size returns the storage used by the backend in bytes.
+func (c *Cache) Size() (int64, error) {
+	return c.store.Size()
+}
+
+// TTL returns the default time an entry is considered fresh.
+func (c *Cache) TTL() time.Duration {
+	return c.Policy.Default
+}
+
+// Ping checks that the store is reachable, for readiness probes.
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.store.Ping(ctx)
+}
+
 func (c *Cache) Close() error {
-	return c.db.Close()
+	return c.store.Close()
 }
+
+var (
+	_ Store = (*SQLiteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*RedisStore)(nil)
+)
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"hunter-base/pkg/models"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T) *Cache {
+	t.Helper()
+	c, err := New(filepath.Join(t.TempDir(), "cache.db"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestTTLForPolicies(t *testing.T) {
+	c := newTestCache(t)
+	c.Policy = TTLPolicy{
+		Default:    24 * time.Hour,
+		Stores:     map[string]time.Duration{"apotheke": 72 * time.Hour},
+		Discounted: 6 * time.Hour,
+		Min:        30 * time.Minute,
+	}
+
+	now := time.Now()
+	soon := now.Add(2 * time.Hour)
+	tooSoon := now.Add(5 * time.Minute)
+
+	tests := []struct {
+		name    string
+		store   string
+		product models.Product
+		want    time.Duration
+	}{
+		{"default", "billa", models.Product{ScrapedAt: now}, 24 * time.Hour},
+		{"store override", "apotheke", models.Product{ScrapedAt: now}, 72 * time.Hour},
+		{"discounted", "billa", models.Product{ScrapedAt: now, IsDiscounted: true}, 6 * time.Hour},
+		{"promotion ends soon", "billa", models.Product{ScrapedAt: now, PriceValidUntil: &soon}, 2 * time.Hour},
+		{"promotion floor", "billa", models.Product{ScrapedAt: now, PriceValidUntil: &tooSoon}, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := c.TTLFor(tt.store, "1", &tt.product); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTTLForAdaptive(t *testing.T) {
+	c := newTestCache(t)
+	c.Policy = TTLPolicy{Default: 24 * time.Hour, Adaptive: true, Min: time.Hour}
+
+	start := time.Now().Add(-12 * time.Hour)
+	for i, price := range []float64{1.99, 1.99, 1.49, 1.99, 1.49} {
+		c.Set("billa", "1", &models.Product{Price: price, ScrapedAt: start.Add(time.Duration(i) * 3 * time.Hour)})
+	}
+
+	// Four recorded prices (the repeat is skipped) spanning 12h: one change every 4h.
+	product, _, _ := c.GetStale("billa", "1")
+	if got := c.TTLFor("billa", "1", product); got != 2*time.Hour {
+		t.Errorf("adaptive TTL: got %s, want 2h", got)
+	}
+
+	if got := c.TTLFor("billa", "2", product); got != 24*time.Hour {
+		t.Errorf("product without history: got %s, want 24h", got)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	c := newTestCache(t)
+	c.Policy.NotFound = time.Hour
+
+	c.SetNotFound("billa", "1")
+	c.SetNotFound("spar", "2")
+	if _, ok := c.GetNotFound("billa", "1"); !ok {
+		t.Fatal("expected negative entry for billa/1")
+	}
+
+	c.Set("billa", "1", &models.Product{Price: 1.99, ScrapedAt: time.Now()})
+	if _, ok := c.GetNotFound("billa", "1"); ok {
+		t.Error("negative entry should be cleared once the product is found")
+	}
+
+	if n, err := c.ClearNotFound(""); err != nil || n != 1 {
+		t.Errorf("ClearNotFound: got %d, %v", n, err)
+	}
+	if _, ok := c.GetNotFound("spar", "2"); ok {
+		t.Error("negative entry for spar/2 should be cleared")
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	c := newTestCache(t)
+	now := time.Now()
+
+	// Keep all observations on one UTC day, which downsampling keeps one of.
+	day := now.Add(-60 * 24 * time.Hour).Truncate(24 * time.Hour)
+	for i := range 200 {
+		c.store.RecordPrice("billa", "1", 1.49, day.Add(time.Duration(i)*time.Minute))
+	}
+	c.Set("billa", "1", &models.Product{Name: "Milk", Price: 1.49, ScrapedAt: now})
+
+	report, err := c.ApplyRetention(RetentionPolicy{FullHistory: 30 * 24 * time.Hour, Unrequested: time.Hour, Vacuum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HistoryRowsRemoved != 199 || report.EntriesEvicted != 0 || !report.Vacuumed {
+		t.Errorf("got %+v", report)
+	}
+	if report.ReclaimedBytes != max(report.SizeBeforeBytes-report.SizeAfterBytes, 0) {
+		t.Errorf("reclaimed %d bytes does not match sizes %d -> %d", report.ReclaimedBytes, report.SizeBeforeBytes, report.SizeAfterBytes)
+	}
+
+	report, err = NewWithStore(NewMemoryStore(0), time.Hour).Vacuum()
+	if err != nil || report.Vacuumed {
+		t.Errorf("memory store should not vacuum: got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,574 @@
+package cache
+
+import (
+	"cmp"
+	"container/list"
+	"context"
+	"encoding/json"
+	"hunter-base/pkg/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMemoryEntries bounds a MemoryStore created with a limit of zero.
+	DefaultMemoryEntries = 10000
+	// maxMemoryHistory bounds the recorded prices kept per product.
+	maxMemoryHistory = 256
+)
+
+type memoryEntry struct {
+	key         string
+	store       string
+	productID   string
+	data        []byte
+	scrapedAt   time.Time
+	requestedAt time.Time
+}
+
+type pricePoint struct {
+	Price float64   `json:"price"`
+	At    time.Time `json:"at"`
+}
+
+// MemoryStore keeps the cache in process memory and evicts the least
+// recently used product once it holds maxEntries. Price histories and
+// not-found markers go with their product and are bounded by maxEntries as
+// well. Nothing survives a restart, which suits tests and ephemeral
+// deployments.
+type MemoryStore struct {
+	maxEntries int
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	notFound map[string]map[string]time.Time
+	history  map[string][]pricePoint
+	watches  map[string]Watch
+}
+
+// NewMemoryStore creates an empty store holding up to maxEntries products,
+// or DefaultMemoryEntries when maxEntries is zero.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMemoryEntries
+	}
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		notFound:   make(map[string]map[string]time.Time),
+		history:    make(map[string][]pricePoint),
+		watches:    make(map[string]Watch),
+	}
+}
+
+func memoryKey(store, productID string) string {
+	return store + "/" + productID
+}
+
+func (s *MemoryStore) Get(store, productID string) (*models.Product, time.Time, bool, error) {
+	s.mu.Lock()
+	el, ok := s.entries[memoryKey(store, productID)]
+	if !ok {
+		s.mu.Unlock()
+		return nil, time.Time{}, false, nil
+	}
+	s.lru.MoveToFront(el)
+	entry := el.Value.(*memoryEntry)
+	s.mu.Unlock()
+
+	var product models.Product
+	if err := json.Unmarshal(entry.data, &product); err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return &product, entry.scrapedAt, true, nil
+}
+
+func (s *MemoryStore) Set(store, productID string, product *models.Product) error {
+	// Products are kept marshaled so callers cannot mutate cached entries.
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(store, productID)
+	entry := &memoryEntry{key: key, store: store, productID: productID, data: data, scrapedAt: product.ScrapedAt, requestedAt: time.Now()}
+	if el, ok := s.entries[key]; ok {
+		entry.requestedAt = el.Value.(*memoryEntry).requestedAt
+		el.Value = entry
+		s.lru.MoveToFront(el)
+	} else {
+		s.entries[key] = s.lru.PushFront(entry)
+	}
+
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+
+	delete(s.notFound[store], productID)
+	return nil
+}
+
+func (s *MemoryStore) Delete(store, productID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := false
+	if el, ok := s.entries[memoryKey(store, productID)]; ok {
+		s.remove(el)
+		removed = true
+	}
+	if _, ok := s.notFound[store][productID]; ok {
+		delete(s.notFound[store], productID)
+		removed = true
+	}
+	return removed, nil
+}
+
+func (s *MemoryStore) DeleteStore(store string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for _, el := range s.entries {
+		if el.Value.(*memoryEntry).store == store {
+			s.remove(el)
+			removed++
+		}
+	}
+	for key := range s.history {
+		if strings.HasPrefix(key, store+"/") {
+			delete(s.history, key)
+		}
+	}
+	delete(s.notFound, store)
+	return removed, nil
+}
+
+// remove drops a product together with its price history and not-found
+// marker. The caller holds s.mu.
+func (s *MemoryStore) remove(el *list.Element) {
+	entry := el.Value.(*memoryEntry)
+	s.lru.Remove(el)
+	delete(s.entries, entry.key)
+	delete(s.history, entry.key)
+	delete(s.notFound[entry.store], entry.productID)
+}
+
+func (s *MemoryStore) List(store string) ([]Record, error) {
+	s.mu.Lock()
+	var entries []*memoryEntry
+	for _, el := range s.entries {
+		entry := el.Value.(*memoryEntry)
+		if store == "" || entry.store == store {
+			entries = append(entries, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	records := make([]Record, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, entry.record())
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (s *MemoryStore) ListPage(store string, before *Cutoffs, limit, offset int) ([]Record, int, error) {
+	s.mu.Lock()
+	var entries []*memoryEntry
+	for _, el := range s.entries {
+		entry := el.Value.(*memoryEntry)
+		if (store == "" || entry.store == store) && (before == nil || entry.scrapedAt.Before(before.For(entry.store))) {
+			entries = append(entries, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b *memoryEntry) int {
+		return cmp.Or(
+			a.scrapedAt.Compare(b.scrapedAt),
+			strings.Compare(a.store, b.store),
+			strings.Compare(a.productID, b.productID),
+		)
+	})
+	var records []Record
+	for _, entry := range page(entries, limit, offset) {
+		records = append(records, entry.record())
+	}
+	return records, len(entries), nil
+}
+
+func (s *MemoryStore) CountEntries(before Cutoffs, times []time.Time) (map[string]EntryCounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := map[string]EntryCounts{}
+	for _, el := range s.entries {
+		entry := el.Value.(*memoryEntry)
+		c, ok := counts[entry.store]
+		if !ok {
+			c.Older = make([]int, len(times))
+		}
+		c.Entries++
+		if entry.scrapedAt.Before(before.For(entry.store)) {
+			c.Before++
+		}
+		for i, t := range times {
+			if entry.scrapedAt.Before(t) {
+				c.Older[i]++
+			}
+		}
+		counts[entry.store] = c
+	}
+	return counts, nil
+}
+
+// record decodes the entry. A product that cannot be decoded is left nil.
+func (e *memoryEntry) record() Record {
+	record := Record{Store: e.store, ProductID: e.productID, ScrapedAt: e.scrapedAt}
+	var product models.Product
+	if err := json.Unmarshal(e.data, &product); err == nil {
+		record.Product = &product
+	}
+	return record
+}
+
+func (s *MemoryStore) Touch(store, productID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[memoryKey(store, productID)]; ok {
+		el.Value.(*memoryEntry).requestedAt = at
+	}
+	return nil
+}
+
+func (s *MemoryStore) EvictUnrequested(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var evicted int64
+	for _, el := range s.entries {
+		if el.Value.(*memoryEntry).requestedAt.Before(before) {
+			s.remove(el)
+			evicted++
+		}
+	}
+	return evicted, nil
+}
+
+func (s *MemoryStore) GetNotFound(store, productID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkedAt, ok := s.notFound[store][productID]
+	return checkedAt, ok, nil
+}
+
+func (s *MemoryStore) SetNotFound(store, productID string, checkedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.notFound[store] == nil {
+		s.notFound[store] = make(map[string]time.Time)
+	}
+	s.notFound[store][productID] = checkedAt
+
+	markers := 0
+	for _, entries := range s.notFound {
+		markers += len(entries)
+	}
+	if markers > s.maxEntries {
+		s.dropOldestNotFound()
+	}
+	return nil
+}
+
+// dropOldestNotFound removes the marker checked longest ago. The caller holds
+// s.mu.
+func (s *MemoryStore) dropOldestNotFound() {
+	var oldestStore, oldestID string
+	var oldest time.Time
+	for store, entries := range s.notFound {
+		for productID, checkedAt := range entries {
+			if oldestID == "" || checkedAt.Before(oldest) {
+				oldestStore, oldestID, oldest = store, productID, checkedAt
+			}
+		}
+	}
+	delete(s.notFound[oldestStore], oldestID)
+}
+
+func (s *MemoryStore) ClearNotFound(store string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cleared int64
+	for name, entries := range s.notFound {
+		if store == "" || name == store {
+			cleared += int64(len(entries))
+			delete(s.notFound, name)
+		}
+	}
+	return cleared, nil
+}
+
+func (s *MemoryStore) CountNotFound() (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := map[string]int{}
+	for store, entries := range s.notFound {
+		if len(entries) > 0 {
+			counts[store] = len(entries)
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) RecordPrice(store, productID string, price float64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(store, productID)
+	points := append(s.history[key], pricePoint{Price: price, At: at})
+	if len(points) > maxMemoryHistory {
+		points = points[len(points)-maxMemoryHistory:]
+	}
+	s.history[key] = points
+	s.trimHistory()
+	return nil
+}
+
+// trimHistory drops the histories of products that are not cached, stalest
+// first, while more than maxEntries products have one. The caller holds s.mu.
+func (s *MemoryStore) trimHistory() {
+	for len(s.history) > s.maxEntries {
+		var stalest string
+		var last time.Time
+		for key, points := range s.history {
+			if _, cached := s.entries[key]; cached {
+				continue
+			}
+			var at time.Time
+			if len(points) > 0 {
+				at = points[len(points)-1].At
+			}
+			if stalest == "" || at.Before(last) {
+				stalest, last = key, at
+			}
+		}
+		if stalest == "" {
+			return
+		}
+		delete(s.history, stalest)
+	}
+}
+
+func (s *MemoryStore) PriceChanges(store, productID string, since time.Time) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return priceChanges(s.history[memoryKey(store, productID)], since), nil
+}
+
+func (s *MemoryStore) DownsampleHistory(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dropped int64
+	for key, points := range s.history {
+		kept := downsample(points, before)
+		dropped += int64(len(points) - len(kept))
+		s.history[key] = kept
+	}
+	return dropped, nil
+}
+
+func (s *MemoryStore) History(store string, from, to time.Time) ([]PriceRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []PriceRecord
+	for key, points := range s.history {
+		name, productID, _ := strings.Cut(key, "/")
+		if store != "" && name != store {
+			continue
+		}
+		records = appendHistory(records, name, productID, points, from, to)
+	}
+	sortHistory(records)
+	return records, nil
+}
+
+func (s *MemoryStore) ImportPrice(store, productID string, price float64, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(store, productID)
+	points, added := insertPoint(s.history[key], pricePoint{Price: price, At: at})
+	if len(points) > maxMemoryHistory {
+		points = points[len(points)-maxMemoryHistory:]
+	}
+	s.history[key] = points
+	s.trimHistory()
+	return added, nil
+}
+
+func (s *MemoryStore) AddWatch(watch Watch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(watch.Store, watch.ProductID)
+	if existing, ok := s.watches[key]; ok {
+		watch.AddedAt = existing.AddedAt
+	}
+	s.watches[key] = watch
+	return nil
+}
+
+func (s *MemoryStore) RemoveWatch(store, productID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey(store, productID)
+	_, ok := s.watches[key]
+	delete(s.watches, key)
+	return ok, nil
+}
+
+func (s *MemoryStore) Watches() ([]Watch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watches := make([]Watch, 0, len(s.watches))
+	for _, watch := range s.watches {
+		watches = append(watches, watch)
+	}
+	sortWatches(watches)
+	return watches, nil
+}
+
+// Size estimates the memory used by cached product data.
+func (s *MemoryStore) Size() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var size int64
+	for _, el := range s.entries {
+		size += int64(len(el.Value.(*memoryEntry).data))
+	}
+	return size, nil
+}
+
+func (s *MemoryStore) Ping(context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sortRecords orders records like the SQLite store: oldest first, then by
+// store and product ID.
+func sortRecords(records []Record) {
+	slices.SortFunc(records, func(a, b Record) int {
+		return cmp.Or(
+			a.ScrapedAt.Compare(b.ScrapedAt),
+			strings.Compare(a.Store, b.Store),
+			strings.Compare(a.ProductID, b.ProductID),
+		)
+	})
+}
+
+// page returns at most limit items after skipping offset, or every remaining
+// item when limit is zero.
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// sortHistory orders price records like the SQLite store: oldest first, then
+// by store and product ID.
+func sortHistory(records []PriceRecord) {
+	slices.SortFunc(records, func(a, b PriceRecord) int {
+		return cmp.Or(
+			a.RecordedAt.Compare(b.RecordedAt),
+			strings.Compare(a.Store, b.Store),
+			strings.Compare(a.ProductID, b.ProductID),
+		)
+	})
+}
+
+// appendHistory appends the points recorded in [from, to) to records. A zero
+// from or to leaves that end open.
+func appendHistory(records []PriceRecord, store, productID string, points []pricePoint, from, to time.Time) []PriceRecord {
+	for _, point := range points {
+		if point.At.Before(from) || (!to.IsZero() && !point.At.Before(to)) {
+			continue
+		}
+		records = append(records, PriceRecord{Store: store, ProductID: productID, Price: point.Price, RecordedAt: point.At})
+	}
+	return records
+}
+
+// insertPoint adds point in chronological order unless a point with the same
+// time exists, and reports whether it was added.
+func insertPoint(points []pricePoint, point pricePoint) ([]pricePoint, bool) {
+	i, found := slices.BinarySearchFunc(points, point.At, func(p pricePoint, at time.Time) int {
+		return p.At.Compare(at)
+	})
+	if found {
+		return points, false
+	}
+	return slices.Insert(points, i, point), true
+}
+
+func sortWatches(watches []Watch) {
+	slices.SortFunc(watches, func(a, b Watch) int {
+		return cmp.Or(strings.Compare(a.Store, b.Store), strings.Compare(a.ProductID, b.ProductID))
+	})
+}
+
+// priceChanges returns when the price changed among the points since the
+// given time. The first point in that range counts as a change.
+func priceChanges(points []pricePoint, since time.Time) []time.Time {
+	var changes []time.Time
+	var previous *pricePoint
+	for i := range points {
+		point := &points[i]
+		if point.At.Before(since) {
+			continue
+		}
+		if previous == nil || previous.Price != point.Price {
+			changes = append(changes, point.At)
+		}
+		previous = point
+	}
+	return changes
+}
+
+// downsample drops points before the given time that repeat the previous
+// price on the same UTC day.
+func downsample(points []pricePoint, before time.Time) []pricePoint {
+	kept := make([]pricePoint, 0, len(points))
+	for i, point := range points {
+		if i > 0 && point.At.Before(before) {
+			previous := points[i-1]
+			if previous.Price == point.Price && previous.At.UTC().Format(time.DateOnly) == point.At.UTC().Format(time.DateOnly) {
+				continue
+			}
+		}
+		kept = append(kept, point)
+	}
+	return kept
+}
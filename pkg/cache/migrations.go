@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one step of the cache schema. Steps are applied in order and
+// never edited once released; schema changes get a new step instead. Steps
+// that rewrite data SQL cannot express run data after sql.
+type migration struct {
+	version int
+	name    string
+	sql     string
+	data    func(*sql.Tx) error
+}
+
+// migrations starts with IF NOT EXISTS statements so databases created before
+// versioning was introduced are adopted as they are.
+var migrations = []migration{
+	{1, "create products", `
+		CREATE TABLE IF NOT EXISTS products (
+			store TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			data TEXT NOT NULL,
+			scraped_at DATETIME NOT NULL,
+			PRIMARY KEY (store, product_id)
+		);
+	`, nil},
+	{2, "create price history", `
+		CREATE TABLE IF NOT EXISTS price_history (
+			store TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			price REAL NOT NULL,
+			recorded_at TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_price_history_product
+			ON price_history (store, product_id, recorded_at);
+	`, nil},
+	{3, "create not found", `
+		CREATE TABLE IF NOT EXISTS not_found (
+			store TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			checked_at DATETIME NOT NULL,
+			PRIMARY KEY (store, product_id)
+		);
+	`, nil},
+	{4, "index scrape and history times", `
+		CREATE INDEX IF NOT EXISTS idx_products_scraped_at ON products (scraped_at);
+		CREATE INDEX IF NOT EXISTS idx_price_history_recorded_at ON price_history (recorded_at);
+		CREATE INDEX IF NOT EXISTS idx_not_found_checked_at ON not_found (checked_at);
+	`, nil},
+	{5, "track product requests", `
+		ALTER TABLE products ADD COLUMN requested_at TEXT;
+		UPDATE products SET requested_at = strftime('%Y-%m-%dT%H:%M:%f', 'now') || '000000Z';
+		CREATE INDEX IF NOT EXISTS idx_products_requested_at ON products (requested_at);
+	`, nil},
+	{6, "create watchlist", `
+		CREATE TABLE IF NOT EXISTS watchlist (
+			store TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			target_price REAL NOT NULL DEFAULT 0,
+			note TEXT NOT NULL DEFAULT '',
+			added_at TEXT NOT NULL,
+			PRIMARY KEY (store, product_id)
+		);
+	`, nil},
+	{7, "store scrape times as sortable text", "", normalizeTimes("products", "scraped_at")},
+	{8, "store not-found check times as sortable text", "", normalizeTimes("not_found", "checked_at")},
+}
+
+// SchemaVersion returns the latest schema version known to this build.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate brings the database up to the latest schema version. Each step runs
+// in its own transaction together with its schema_version row, so a failed
+// step leaves the database at the previous version.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return err
+	}
+	if current > SchemaVersion() {
+		return fmt.Errorf("cache schema version %d is newer than supported version %d", current, SchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if m.sql != "" {
+			if _, err := tx.Exec(m.sql); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if m.data != nil {
+			if err := m.data(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now(),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		log.Info("Applied schema migration", "version", m.version, "name", m.name)
+	}
+	return nil
+}
+
+// normalizeTimes returns a migration rewriting the times in column, which the
+// driver used to store in the format of time.Time.String, as sqliteTime so
+// they sort and compare as text. Values the driver cannot read as times are
+// left alone.
+func normalizeTimes(table, column string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT rowid, ` + column + ` FROM ` + table)
+		if err != nil {
+			return err
+		}
+		times := map[int64]time.Time{}
+		for rows.Next() {
+			var rowid int64
+			var value any
+			if err := rows.Scan(&rowid, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			if t, ok := value.(time.Time); ok {
+				times[rowid] = t
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for rowid, t := range times {
+			if _, err := tx.Exec(`UPDATE `+table+` SET `+column+` = ? WHERE rowid = ?`, t.UTC().Format(sqliteTime), rowid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
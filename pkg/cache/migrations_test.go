@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func schemaVersion(t *testing.T, c *Cache) int {
+	t.Helper()
+	var version int
+	if err := c.store.(*SQLiteStore).db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+// unversionedDatabase creates a database as created before migrations
+// existed, holding one product, and returns its path.
+func unversionedDatabase(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE products (
+			store TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			data TEXT NOT NULL,
+			scraped_at DATETIME NOT NULL,
+			PRIMARY KEY (store, product_id)
+		);
+		INSERT INTO products VALUES ('billa', '1', '{"name":"Milk","price":1.49}', CURRENT_TIMESTAMP);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateAdoptsUnversionedDatabase(t *testing.T) {
+	path := unversionedDatabase(t)
+
+	c, err := New(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(t, c); v != SchemaVersion() {
+		t.Errorf("schema version: got %d, want %d", v, SchemaVersion())
+	}
+	if product, _, ok := c.GetStale("billa", "1"); !ok || product.Name != "Milk" {
+		t.Errorf("existing entry lost: %+v", product)
+	}
+	// Legacy scrape times sort below any text timestamp until rewritten.
+	if _, total, err := c.store.ListPage("", &Cutoffs{Default: time.Now().Add(-time.Hour)}, 0, 0); err != nil || total != 0 {
+		t.Errorf("existing entry scraped before an hour ago: got %d, %v", total, err)
+	}
+	if _, total, err := c.store.ListPage("", &Cutoffs{Default: time.Now().Add(time.Minute)}, 0, 0); err != nil || total != 1 {
+		t.Errorf("existing entry not scraped before now: got %d, %v", total, err)
+	}
+
+	var mode string
+	if err := c.store.(*SQLiteStore).db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal mode: got %q, %v", mode, err)
+	}
+	c.Close()
+
+	// Reopening must not re-apply anything.
+	c, err = New(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var rows int
+	if err := c.store.(*SQLiteStore).db.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&rows); err != nil || rows != len(migrations) {
+		t.Errorf("schema_version rows: got %d, %v", rows, err)
+	}
+}
+
+func TestMigrateBackfillsRequestTimes(t *testing.T) {
+	c, err := New(unversionedDatabase(t), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var value string
+	if err := c.store.(*SQLiteStore).db.QueryRow(`SELECT requested_at FROM products`).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	requestedAt, err := time.Parse(sqliteTime, value)
+	if err != nil {
+		t.Fatalf("backfilled request time %q: %v", value, err)
+	}
+
+	if n, err := c.store.EvictUnrequested(requestedAt); err != nil || n != 0 {
+		t.Errorf("evicting before the request time: got %d, %v", n, err)
+	}
+	if n, err := c.store.EvictUnrequested(requestedAt.Add(time.Nanosecond)); err != nil || n != 1 {
+		t.Errorf("evicting after the request time: got %d, %v", n, err)
+	}
+}
+
+func TestMigrateRewritesNotFoundTimes(t *testing.T) {
+	path := unversionedDatabase(t)
+	c, err := New(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write a marker the way SetNotFound used to and roll back the migration.
+	checkedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	db := c.store.(*SQLiteStore).db
+	if _, err := db.Exec(`INSERT INTO not_found VALUES ('billa', '1', ?)`, checkedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM schema_version WHERE version = 8`); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	c, err = New(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var value string
+	if err := c.store.(*SQLiteStore).db.QueryRow(`SELECT checked_at || '' FROM not_found`).Scan(&value); err != nil || value != checkedAt.Format(sqliteTime) {
+		t.Errorf("checked_at: got %q, %v", value, err)
+	}
+	if got, ok, err := c.store.GetNotFound("billa", "1"); !ok || err != nil || !got.Equal(checkedAt) {
+		t.Errorf("GetNotFound: got %s, ok=%t err=%v", got, ok, err)
+	}
+}
+
+func TestNewRecoversFromCorruptedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.db")
+	if err := os.WriteFile(path, []byte(strings.Repeat("not a database ", 512)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(path, time.Hour)
+	if err != nil {
+		t.Fatalf("expected recovery, got %v", err)
+	}
+	defer c.Close()
+
+	if v := schemaVersion(t, c); v != SchemaVersion() {
+		t.Errorf("schema version: got %d, want %d", v, SchemaVersion())
+	}
+
+	moved, _ := filepath.Glob(filepath.Join(dir, "cache.db.corrupt-*"))
+	if len(moved) == 0 {
+		t.Error("corrupted file was not kept")
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"hunter-base/pkg/models"
+	"time"
+)
+
+// historyWindow is how far back price changes are considered for adaptive TTLs.
+const historyWindow = 30 * 24 * time.Hour
+
+// TTLPolicy decides how long a cached product counts as fresh.
+type TTLPolicy struct {
+	// Default applies to stores without their own TTL.
+	Default time.Duration
+	// Stores overrides Default per store key (e.g. "lidl").
+	Stores map[string]time.Duration
+	// Discounted caps the TTL of discounted products. Zero disables the cap.
+	Discounted time.Duration
+	// Adaptive shortens the TTL of products whose price changed often,
+	// to half the average interval between recorded changes.
+	Adaptive bool
+	// Min is the lower bound for discount, promotion and adaptive TTLs.
+	Min time.Duration
+	// NotFound is how long a missing product is remembered. Zero disables
+	// negative caching.
+	NotFound time.Duration
+}
+
+// storeTTL returns the base TTL for store.
+func (p TTLPolicy) storeTTL(store string) time.Duration {
+	if ttl, ok := p.Stores[store]; ok && ttl > 0 {
+		return ttl
+	}
+	return p.Default
+}
+
+// TTLFor returns how long product, cached under store and productID, stays
+// fresh after it was scraped. The store TTL is shortened for discounted
+// products, promotions ending before it runs out and, with Adaptive set,
+// products whose price changes often. Shortened TTLs never drop below Min.
+func (c *Cache) TTLFor(store, productID string, product *models.Product) time.Duration {
+	policy := c.Policy
+	base := policy.storeTTL(store)
+	if product == nil {
+		return base
+	}
+
+	ttl := base
+	if product.IsDiscounted && policy.Discounted > 0 && policy.Discounted < ttl {
+		ttl = policy.Discounted
+	}
+
+	if product.PriceValidUntil != nil && product.PriceValidUntil.After(product.ScrapedAt) {
+		if untilEnd := product.PriceValidUntil.Sub(product.ScrapedAt); untilEnd < ttl {
+			ttl = untilEnd
+		}
+	}
+
+	if policy.Adaptive {
+		if interval, ok := c.changeInterval(store, productID); ok && interval/2 < ttl {
+			ttl = interval / 2
+		}
+	}
+
+	if ttl < policy.Min {
+		ttl = min(policy.Min, base)
+	}
+	return ttl
+}
+
+// changeInterval returns the average time between recorded price changes of
+// a product within historyWindow. It needs at least two changes.
+func (c *Cache) changeInterval(store, productID string) (time.Duration, bool) {
+	changes, err := c.store.PriceChanges(store, productID, time.Now().Add(-historyWindow))
+	if err != nil || len(changes) < 3 {
+		return 0, false
+	}
+
+	first, last := changes[0], changes[len(changes)-1]
+	if !last.After(first) {
+		return 0, false
+	}
+	return last.Sub(first) / time.Duration(len(changes)-1), true
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"time"
+)
+
+// RetentionPolicy bounds how much the cache and its price history grow.
+type RetentionPolicy struct {
+	// FullHistory keeps every price observation for this long. Older
+	// observations are downsampled to every change plus one per day. Zero
+	// disables downsampling.
+	FullHistory time.Duration
+	// Unrequested evicts products no client asked for within this long.
+	// Zero disables eviction.
+	Unrequested time.Duration
+	// Vacuum compacts the storage afterwards when the backend supports it.
+	Vacuum bool
+}
+
+// RetentionReport describes what a retention run removed and reclaimed.
+type RetentionReport struct {
+	HistoryRowsRemoved int64 `json:"history_rows_removed"`
+	EntriesEvicted     int64 `json:"entries_evicted"`
+	Vacuumed           bool  `json:"vacuumed"`
+	SizeBeforeBytes    int64 `json:"size_before_bytes"`
+	SizeAfterBytes     int64 `json:"size_after_bytes"`
+	ReclaimedBytes     int64 `json:"reclaimed_bytes"`
+	DurationMS         int64 `json:"duration_ms"`
+}
+
+// ApplyRetention downsamples old history, evicts unrequested products and
+// optionally vacuums, in that order so the vacuum reclaims what was removed.
+func (c *Cache) ApplyRetention(policy RetentionPolicy) (*RetentionReport, error) {
+	start := time.Now()
+	report := &RetentionReport{}
+
+	var err error
+	if report.SizeBeforeBytes, err = c.store.Size(); err != nil {
+		return nil, err
+	}
+
+	if policy.FullHistory > 0 {
+		if report.HistoryRowsRemoved, err = c.store.DownsampleHistory(start.Add(-policy.FullHistory)); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy.Unrequested > 0 {
+		if report.EntriesEvicted, err = c.store.EvictUnrequested(start.Add(-policy.Unrequested)); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy.Vacuum {
+		if report.Vacuumed, err = c.vacuum(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.finishReport(report, start); err != nil {
+		return nil, err
+	}
+	log.Info("Retention finished",
+		"history_rows_removed", report.HistoryRowsRemoved, "entries_evicted", report.EntriesEvicted,
+		"reclaimed_bytes", report.ReclaimedBytes, "duration_ms", report.DurationMS)
+	return report, nil
+}
+
+// Vacuum compacts the storage, if the backend supports it, and reports the
+// reclaimed space.
+func (c *Cache) Vacuum() (*RetentionReport, error) {
+	start := time.Now()
+	report := &RetentionReport{}
+
+	var err error
+	if report.SizeBeforeBytes, err = c.store.Size(); err != nil {
+		return nil, err
+	}
+	if report.Vacuumed, err = c.vacuum(); err != nil {
+		return nil, err
+	}
+	if err := c.finishReport(report, start); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *Cache) vacuum() (bool, error) {
+	v, ok := c.store.(Vacuumer)
+	if !ok {
+		return false, nil
+	}
+	return true, v.Vacuum()
+}
+
+func (c *Cache) finishReport(report *RetentionReport, start time.Time) error {
+	var err error
+	if report.SizeAfterBytes, err = c.store.Size(); err != nil {
+		return err
+	}
+	report.ReclaimedBytes = max(report.SizeBeforeBytes-report.SizeAfterBytes, 0)
+	report.DurationMS = time.Since(start).Milliseconds()
+	return nil
+}
@@ -0,0 +1,572 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/models"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+const (
+	// busyTimeout lets writers wait for each other instead of failing with
+	// SQLITE_BUSY when background revalidations overlap.
+	busyTimeout = 5 * time.Second
+	// maxOpenConns bounds the pool. WAL allows concurrent readers next to the
+	// single writer, the busy timeout serializes writers.
+	maxOpenConns    = 8
+	maxIdleConns    = 4
+	connMaxIdleTime = 5 * time.Minute
+)
+
+// SQLite result codes that mean the file itself is damaged.
+const (
+	sqliteCorrupt = 11
+	sqliteNotADB  = 26
+)
+
+// sqliteTime is the fixed-width UTC layout of timestamps stored as text, so
+// they sort chronologically as strings.
+const sqliteTime = "2006-01-02T15:04:05.000000000Z"
+
+// errCorrupt marks a database file that failed to open or the integrity check.
+var errCorrupt = errors.New("cache database is corrupted")
+
+// SQLiteStore keeps the cache in a local SQLite database. It is the default
+// backend and the only one that survives restarts without external services.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the database at path. See openDB.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Get(store, productID string) (*models.Product, time.Time, bool, error) {
+	var data string
+	var scrapedAt time.Time
+
+	err := s.db.QueryRow(
+		`SELECT data, scraped_at FROM products WHERE store = ? AND product_id = ?`,
+		store, productID,
+	).Scan(&data, &scrapedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	var product models.Product
+	if err := json.Unmarshal([]byte(data), &product); err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return &product, scrapedAt, true, nil
+}
+
+func (s *SQLiteStore) Set(store, productID string, product *models.Product) error {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO products (store, product_id, data, scraped_at, requested_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(store, product_id)
+		 DO UPDATE SET data = excluded.data, scraped_at = excluded.scraped_at`,
+		store, productID, string(data), product.ScrapedAt.UTC().Format(sqliteTime), time.Now().UTC().Format(sqliteTime),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`DELETE FROM not_found WHERE store = ? AND product_id = ?`, store, productID)
+	return err
+}
+
+func (s *SQLiteStore) Delete(store, productID string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM products WHERE store = ? AND product_id = ?`, store, productID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	res, err = s.db.Exec(`DELETE FROM not_found WHERE store = ? AND product_id = ?`, store, productID)
+	if err != nil {
+		return false, err
+	}
+	negative, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return removed+negative > 0, nil
+}
+
+func (s *SQLiteStore) DeleteStore(store string) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM products WHERE store = ?`, store)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.ClearNotFound(store); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) List(store string) ([]Record, error) {
+	rows, err := s.db.Query(
+		`SELECT store, product_id, data, scraped_at FROM products
+		 WHERE ? = '' OR store = ?
+		 ORDER BY scraped_at, store, product_id`,
+		store, store,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (s *SQLiteStore) ListPage(store string, before *Cutoffs, limit, offset int) ([]Record, int, error) {
+	where, args := `(? = '' OR store = ?)`, []any{store, store}
+	if before != nil {
+		cutoff, cutoffArgs := cutoffSQL(*before)
+		where += ` AND scraped_at < ` + cutoff
+		args = append(args, cutoffArgs...)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM products WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.Query(
+		`SELECT store, product_id, data, scraped_at FROM products WHERE `+where+`
+		 ORDER BY scraped_at, store, product_id LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	records, err := scanRecords(rows)
+	return records, total, err
+}
+
+func (s *SQLiteStore) CountEntries(before Cutoffs, times []time.Time) (map[string]EntryCounts, error) {
+	cutoff, args := cutoffSQL(before)
+	query := `SELECT store, COUNT(*), COUNT(CASE WHEN scraped_at < ` + cutoff + ` THEN 1 END)`
+	for _, t := range times {
+		query += `, COUNT(CASE WHEN scraped_at < ? THEN 1 END)`
+		args = append(args, t.UTC().Format(sqliteTime))
+	}
+	rows, err := s.db.Query(query+` FROM products GROUP BY store`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]EntryCounts{}
+	for rows.Next() {
+		var store string
+		c := EntryCounts{Older: make([]int, len(times))}
+		dest := []any{&store, &c.Entries, &c.Before}
+		for i := range c.Older {
+			dest = append(dest, &c.Older[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		counts[store] = c
+	}
+	return counts, rows.Err()
+}
+
+// scanRecords reads and closes rows of store, product_id, data and
+// scraped_at.
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var record Record
+		var data string
+		if err := rows.Scan(&record.Store, &record.ProductID, &data, &record.ScrapedAt); err != nil {
+			return nil, err
+		}
+		var product models.Product
+		if err := json.Unmarshal([]byte(data), &product); err == nil {
+			record.Product = &product
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// cutoffSQL returns an expression for the cutoff of the row's store and its
+// arguments.
+func cutoffSQL(c Cutoffs) (string, []any) {
+	if len(c.Stores) == 0 {
+		return "?", []any{c.Default.UTC().Format(sqliteTime)}
+	}
+	expr, args := "CASE store", []any{}
+	for _, store := range slices.Sorted(maps.Keys(c.Stores)) {
+		expr += " WHEN ? THEN ?"
+		args = append(args, store, c.Stores[store].UTC().Format(sqliteTime))
+	}
+	return expr + " ELSE ? END", append(args, c.Default.UTC().Format(sqliteTime))
+}
+
+func (s *SQLiteStore) GetNotFound(store, productID string) (time.Time, bool, error) {
+	var checkedAt time.Time
+	err := s.db.QueryRow(
+		`SELECT checked_at FROM not_found WHERE store = ? AND product_id = ?`,
+		store, productID,
+	).Scan(&checkedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return checkedAt, true, nil
+}
+
+func (s *SQLiteStore) SetNotFound(store, productID string, checkedAt time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO not_found (store, product_id, checked_at)
+		 VALUES (?, ?, ?)
+		 ON CONFLICT(store, product_id)
+		 DO UPDATE SET checked_at = excluded.checked_at`,
+		store, productID, checkedAt.UTC().Format(sqliteTime),
+	)
+	return err
+}
+
+func (s *SQLiteStore) ClearNotFound(store string) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM not_found WHERE ? = '' OR store = ?`, store, store)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) CountNotFound() (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT store, COUNT(*) FROM not_found GROUP BY store`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var store string
+		var count int
+		if err := rows.Scan(&store, &count); err != nil {
+			return nil, err
+		}
+		counts[store] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLiteStore) Touch(store, productID string, at time.Time) error {
+	_, err := s.db.Exec(
+		`UPDATE products SET requested_at = ? WHERE store = ? AND product_id = ?`,
+		at.UTC().Format(sqliteTime), store, productID,
+	)
+	return err
+}
+
+func (s *SQLiteStore) EvictUnrequested(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM products WHERE requested_at < ?`, before.UTC().Format(sqliteTime))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) RecordPrice(store, productID string, price float64, at time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO price_history (store, product_id, price, recorded_at) VALUES (?, ?, ?, ?)`,
+		store, productID, price, at.UTC().Format(sqliteTime),
+	)
+	return err
+}
+
+func (s *SQLiteStore) PriceChanges(store, productID string, since time.Time) ([]time.Time, error) {
+	rows, err := s.db.Query(
+		`SELECT recorded_at FROM (
+			SELECT recorded_at, price, LAG(price) OVER (ORDER BY recorded_at) AS previous
+			FROM price_history
+			WHERE store = ? AND product_id = ? AND recorded_at >= ?
+		 )
+		 WHERE previous IS NULL OR previous != price
+		 ORDER BY recorded_at`,
+		store, productID, since.UTC().Format(sqliteTime),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []time.Time
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if at, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			changes = append(changes, at)
+		}
+	}
+	return changes, rows.Err()
+}
+
+// DownsampleHistory deletes observations before the cutoff that repeat the
+// previous price on the same UTC day, leaving the first observation of each
+// day and every change.
+func (s *SQLiteStore) DownsampleHistory(before time.Time) (int64, error) {
+	res, err := s.db.Exec(
+		`DELETE FROM price_history WHERE rowid IN (
+			SELECT rowid FROM (
+				SELECT rowid, price, recorded_at,
+					LAG(price) OVER w AS previous_price,
+					LAG(recorded_at) OVER w AS previous_at
+				FROM price_history
+				WINDOW w AS (PARTITION BY store, product_id ORDER BY recorded_at)
+			)
+			WHERE recorded_at < ?
+				AND previous_price = price
+				AND substr(previous_at, 1, 10) = substr(recorded_at, 1, 10)
+		)`,
+		before.UTC().Format(sqliteTime),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) History(store string, from, to time.Time) ([]PriceRecord, error) {
+	upper := "9999"
+	if !to.IsZero() {
+		upper = to.UTC().Format(sqliteTime)
+	}
+
+	rows, err := s.db.Query(
+		`SELECT store, product_id, price, recorded_at FROM price_history
+		 WHERE (? = '' OR store = ?) AND recorded_at >= ? AND recorded_at < ?
+		 ORDER BY recorded_at, store, product_id`,
+		store, store, from.UTC().Format(sqliteTime), upper,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PriceRecord
+	for rows.Next() {
+		var record PriceRecord
+		var raw string
+		if err := rows.Scan(&record.Store, &record.ProductID, &record.Price, &raw); err != nil {
+			return nil, err
+		}
+		if record.RecordedAt, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLiteStore) ImportPrice(store, productID string, price float64, at time.Time) (bool, error) {
+	recordedAt := at.UTC().Format(sqliteTime)
+	res, err := s.db.Exec(
+		`INSERT INTO price_history (store, product_id, price, recorded_at)
+		 SELECT ?, ?, ?, ?
+		 WHERE NOT EXISTS (
+			SELECT 1 FROM price_history WHERE store = ? AND product_id = ? AND recorded_at = ?
+		 )`,
+		store, productID, price, recordedAt, store, productID, recordedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	added, err := res.RowsAffected()
+	return added > 0, err
+}
+
+func (s *SQLiteStore) AddWatch(watch Watch) error {
+	_, err := s.db.Exec(
+		`INSERT INTO watchlist (store, product_id, target_price, note, added_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(store, product_id)
+		 DO UPDATE SET target_price = excluded.target_price, note = excluded.note`,
+		watch.Store, watch.ProductID, watch.TargetPrice, watch.Note, watch.AddedAt.UTC().Format(sqliteTime),
+	)
+	return err
+}
+
+func (s *SQLiteStore) RemoveWatch(store, productID string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM watchlist WHERE store = ? AND product_id = ?`, store, productID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := res.RowsAffected()
+	return removed > 0, err
+}
+
+func (s *SQLiteStore) Watches() ([]Watch, error) {
+	rows, err := s.db.Query(
+		`SELECT store, product_id, target_price, note, added_at FROM watchlist ORDER BY store, product_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var watches []Watch
+	for rows.Next() {
+		var watch Watch
+		var raw string
+		if err := rows.Scan(&watch.Store, &watch.ProductID, &watch.TargetPrice, &watch.Note, &raw); err != nil {
+			return nil, err
+		}
+		watch.AddedAt, _ = time.Parse(time.RFC3339Nano, raw)
+		watches = append(watches, watch)
+	}
+	return watches, rows.Err()
+}
+
+// Vacuum rebuilds the database file to return free pages to the filesystem.
+func (s *SQLiteStore) Vacuum() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// Size returns the size of the database in bytes.
+func (s *SQLiteStore) Size() (int64, error) {
+	var pageCount, pageSize int64
+	if err := s.db.QueryRow(`PRAGMA page_count`).Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	var one int
+	return s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// openDB opens the SQLite database at path with WAL journaling, checks its
+// integrity and migrates it to the latest schema. A corrupted file is moved
+// aside and replaced by an empty database so the service can still start.
+func openDB(path string) (*sql.DB, error) {
+	db, err := openSQLite(path)
+	if !errors.Is(err, errCorrupt) {
+		return db, err
+	}
+
+	moved, qerr := quarantine(path)
+	if qerr != nil {
+		return nil, fmt.Errorf("%w, and moving it aside failed: %v", err, qerr)
+	}
+	log.Warn("Moved unreadable cache aside, starting with an empty cache", "error", err, "moved_to", moved)
+	return openSQLite(path)
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxIdleTime(connMaxIdleTime)
+
+	if err := checkIntegrity(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		if isCorruption(err) {
+			return nil, fmt.Errorf("%w: %v", errCorrupt, err)
+		}
+		return nil, err
+	}
+	return db, nil
+}
+
+// dsn applies the connection pragmas to every pooled connection.
+func dsn(path string) string {
+	return fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)",
+		path, busyTimeout.Milliseconds())
+}
+
+// checkIntegrity runs SQLite's quick_check, which covers page and index
+// structure without the full cost of integrity_check.
+func checkIntegrity(db *sql.DB) error {
+	var result string
+	if err := db.QueryRow(`PRAGMA quick_check`).Scan(&result); err != nil {
+		if isCorruption(err) {
+			return fmt.Errorf("%w: %v", errCorrupt, err)
+		}
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", errCorrupt, result)
+	}
+	return nil
+}
+
+func isCorruption(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqliteCorrupt || code == sqliteNotADB
+}
+
+// quarantine renames a damaged database and its WAL files so they can be
+// inspected later, and returns the new name of the database file.
+func quarantine(path string) (string, error) {
+	moved := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, moved); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(path+suffix, moved+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return moved, nil
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Entry describes one cached product for administration.
+type Entry struct {
+	Store      string    `json:"store"`
+	ProductID  string    `json:"product_id"`
+	Name       string    `json:"name,omitempty"`
+	Price      float64   `json:"price"`
+	ScrapedAt  time.Time `json:"scraped_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+	TTLSeconds int64     `json:"ttl_seconds"`
+	Stale      bool      `json:"stale"`
+}
+
+// AgeBucket counts entries whose age falls below MaxAge.
+type AgeBucket struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+	// maxAge is zero for the open-ended last bucket.
+	maxAge time.Duration
+}
+
+// StoreStats summarizes the entries of a single store.
+type StoreStats struct {
+	Entries  int `json:"entries"`
+	Stale    int `json:"stale"`
+	NotFound int `json:"not_found"`
+}
+
+// Stats summarizes the cache contents and lookups since startup.
+type Stats struct {
+	Entries     int                   `json:"entries"`
+	Stale       int                   `json:"stale"`
+	NotFound    int                   `json:"not_found"`
+	Stores      map[string]StoreStats `json:"stores"`
+	Ages        []AgeBucket           `json:"age_distribution"`
+	Hits        int64                 `json:"hits"`
+	Misses      int64                 `json:"misses"`
+	HitRatio    float64               `json:"hit_ratio"`
+	DBSizeBytes int64                 `json:"db_size_bytes"`
+}
+
+// lookups counts cache hits and misses since startup.
+type lookups struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// RecordLookup counts a request answered from the cache (hit) or one that
+// needed a scrape.
+func (c *Cache) RecordLookup(hit bool) {
+	if hit {
+		c.lookups.hits.Add(1)
+	} else {
+		c.lookups.misses.Add(1)
+	}
+}
+
+// Entries lists cached products ordered from oldest to newest. An empty store
+// lists every store; staleOnly keeps only entries older than the TTL of their
+// store. It returns one page of at most limit entries after skipping offset,
+// and the number of matching entries in total. The store filters and pages,
+// so TTLs are only worked out for the returned page; entries that expire
+// sooner because of discounts or frequent price changes are listed as stale
+// but not selected by staleOnly.
+func (c *Cache) Entries(store string, staleOnly bool, limit, offset int) ([]Entry, int, error) {
+	var before *Cutoffs
+	if staleOnly {
+		cutoffs := c.staleCutoffs(time.Now())
+		before = &cutoffs
+	}
+	records, total, err := c.store.ListPage(store, before, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]Entry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, c.entry(record))
+	}
+	return entries, total, nil
+}
+
+// staleCutoffs returns, per store, the scrape time before which entries are
+// older than the store TTL.
+func (c *Cache) staleCutoffs(now time.Time) Cutoffs {
+	cutoffs := Cutoffs{Default: now.Add(-c.Policy.Default), Stores: map[string]time.Time{}}
+	for store := range c.Policy.Stores {
+		cutoffs.Stores[store] = now.Add(-c.Policy.storeTTL(store))
+	}
+	return cutoffs
+}
+
+func (c *Cache) entry(record Record) Entry {
+	entry := Entry{
+		Store:     record.Store,
+		ProductID: record.ProductID,
+		ScrapedAt: record.ScrapedAt,
+	}
+	if record.Product != nil {
+		entry.Name = record.Product.Name
+		entry.Price = record.Product.Price
+	}
+
+	age := time.Since(record.ScrapedAt)
+	ttl := c.TTLFor(record.Store, record.ProductID, record.Product)
+	entry.AgeSeconds = int64(age.Seconds())
+	entry.TTLSeconds = int64(ttl.Seconds())
+	entry.Stale = age > ttl
+	return entry
+}
+
+// Stats returns entry counts per store, the age distribution, the hit ratio
+// since startup and the size of the database. The store does the counting;
+// Stale counts entries older than the TTL of their store.
+func (c *Cache) Stats() (*Stats, error) {
+	stats := &Stats{
+		Stores: map[string]StoreStats{},
+		Ages: []AgeBucket{
+			{Label: "<1h", maxAge: time.Hour},
+			{Label: "1h-6h", maxAge: 6 * time.Hour},
+			{Label: "6h-24h", maxAge: 24 * time.Hour},
+			{Label: "1d-7d", maxAge: 7 * 24 * time.Hour},
+			{Label: ">7d"},
+		},
+		Hits:   c.lookups.hits.Load(),
+		Misses: c.lookups.misses.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+
+	now := time.Now()
+	bounds := make([]time.Time, len(stats.Ages)-1)
+	for i := range bounds {
+		bounds[i] = now.Add(-stats.Ages[i].maxAge)
+	}
+	counts, err := c.store.CountEntries(c.staleCutoffs(now), bounds)
+	if err != nil {
+		return nil, err
+	}
+	for store, count := range counts {
+		stats.Stores[store] = StoreStats{Entries: count.Entries, Stale: count.Before}
+		stats.Entries += count.Entries
+		stats.Stale += count.Before
+
+		// Older counts entries past each bucket's upper bound, so a bucket
+		// holds the difference to the previous one.
+		younger := count.Entries
+		for i, older := range count.Older {
+			stats.Ages[i].Count += younger - older
+			younger = older
+		}
+		stats.Ages[len(stats.Ages)-1].Count += younger
+	}
+
+	notFound, err := c.store.CountNotFound()
+	if err != nil {
+		return nil, err
+	}
+	for store, count := range notFound {
+		s := stats.Stores[store]
+		s.NotFound = count
+		stats.Stores[store] = s
+		stats.NotFound += count
+	}
+
+	stats.DBSizeBytes, err = c.Size()
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
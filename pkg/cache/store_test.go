@@ -0,0 +1,343 @@
+package cache
+
+import (
+	"context"
+	"hunter-base/pkg/models"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// backends returns a fresh instance of every Store implementation.
+func backends(t *testing.T) map[string]Store {
+	t.Helper()
+
+	sqliteStore, err := NewSQLiteStore(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := miniredis.RunT(t)
+	redisStore, err := NewRedisStore("redis://"+server.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]Store{
+		"sqlite": sqliteStore,
+		"memory": NewMemoryStore(0),
+		"redis":  redisStore,
+	}
+	for _, s := range stores {
+		t.Cleanup(func() { s.Close() })
+	}
+	return stores
+}
+
+func TestStoreBackends(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().Truncate(time.Millisecond)
+
+			if err := s.Ping(context.Background()); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+			if _, _, ok, err := s.Get("billa", "1"); ok || err != nil {
+				t.Fatalf("empty store: got ok=%t err=%v", ok, err)
+			}
+
+			if err := s.SetNotFound("billa", "1", now); err != nil {
+				t.Fatal(err)
+			}
+			if checkedAt, ok, err := s.GetNotFound("billa", "1"); !ok || err != nil || !checkedAt.Equal(now) {
+				t.Errorf("GetNotFound: got %s, ok=%t err=%v", checkedAt, ok, err)
+			}
+
+			s.Set("billa", "1", &models.Product{Name: "Milk", Price: 1.49, ScrapedAt: now.Add(-time.Hour)})
+			s.Set("billa", "2", &models.Product{Name: "Bread", Price: 2.99, ScrapedAt: now})
+			s.Set("spar", "3", &models.Product{Name: "Butter", Price: 3.49, ScrapedAt: now.Add(-2 * time.Hour)})
+
+			product, scrapedAt, ok, err := s.Get("billa", "1")
+			if err != nil || !ok || product.Name != "Milk" || !scrapedAt.Equal(now.Add(-time.Hour)) {
+				t.Errorf("Get: got %+v at %s, ok=%t err=%v", product, scrapedAt, ok, err)
+			}
+			if _, ok, _ := s.GetNotFound("billa", "1"); ok {
+				t.Error("Set should clear the not-found marker")
+			}
+
+			records, err := s.List("")
+			if err != nil || len(records) != 3 || records[0].ProductID != "3" || records[2].ProductID != "2" {
+				t.Errorf("List: got %+v, %v", records, err)
+			}
+			if records, _ := s.List("billa"); len(records) != 2 {
+				t.Errorf("List(billa): got %d records", len(records))
+			}
+			page, total, err := s.ListPage("", nil, 1, 1)
+			if err != nil || total != 3 || len(page) != 1 || page[0].ProductID != "1" || page[0].Product.Name != "Milk" {
+				t.Errorf("ListPage: got %+v of %d, %v", page, total, err)
+			}
+			before := &Cutoffs{Default: now.Add(-30 * time.Minute), Stores: map[string]time.Time{"spar": now.Add(-3 * time.Hour)}}
+			if page, total, _ := s.ListPage("", before, 0, 0); total != 1 || len(page) != 1 || page[0].ProductID != "1" {
+				t.Errorf("ListPage(before): got %+v of %d", page, total)
+			}
+			counts, err := s.CountEntries(*before, []time.Time{now.Add(-90 * time.Minute)})
+			if err != nil || counts["billa"].Entries != 2 || counts["billa"].Before != 1 || counts["billa"].Older[0] != 0 ||
+				counts["spar"].Entries != 1 || counts["spar"].Before != 0 || counts["spar"].Older[0] != 1 {
+				t.Errorf("CountEntries: got %+v, %v", counts, err)
+			}
+
+			for _, price := range []float64{1.49, 1.49, 1.29} {
+				if err := s.RecordPrice("billa", "1", price, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if changes, err := s.PriceChanges("billa", "1", now.Add(-time.Minute)); err != nil || len(changes) != 2 {
+				t.Errorf("PriceChanges: got %v, %v", changes, err)
+			}
+
+			s.SetNotFound("spar", "9", now)
+			if counts, err := s.CountNotFound(); err != nil || counts["spar"] != 1 {
+				t.Errorf("CountNotFound: got %v, %v", counts, err)
+			}
+
+			if removed, err := s.Delete("billa", "2"); err != nil || !removed {
+				t.Errorf("Delete: got %t, %v", removed, err)
+			}
+			if removed, _ := s.Delete("billa", "2"); removed {
+				t.Error("Delete of a missing product should report false")
+			}
+			if n, err := s.DeleteStore("spar"); err != nil || n != 1 {
+				t.Errorf("DeleteStore: got %d, %v", n, err)
+			}
+			if counts, _ := s.CountNotFound(); counts["spar"] != 0 {
+				t.Error("DeleteStore should clear not-found markers")
+			}
+			if records, _ := s.List(""); len(records) != 1 {
+				t.Errorf("after deletes: got %d records", len(records))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewMemoryStore(2)
+	now := time.Now()
+
+	s.Set("billa", "1", &models.Product{ScrapedAt: now})
+	s.Set("billa", "2", &models.Product{ScrapedAt: now})
+	s.RecordPrice("billa", "2", 1.49, now)
+	s.Get("billa", "1")
+	s.Set("billa", "3", &models.Product{ScrapedAt: now})
+
+	if _, _, ok, _ := s.Get("billa", "2"); ok {
+		t.Error("least recently used product should be evicted")
+	}
+	if changes, _ := s.PriceChanges("billa", "2", time.Time{}); len(changes) != 0 {
+		t.Error("evicted product should lose its price history")
+	}
+	for _, id := range []string{"1", "3"} {
+		if _, _, ok, _ := s.Get("billa", id); !ok {
+			t.Errorf("product %s should still be cached", id)
+		}
+	}
+}
+
+func TestMemoryStoreBoundsHistoryAndNotFound(t *testing.T) {
+	s := NewMemoryStore(2)
+	now := time.Now()
+
+	s.Set("billa", "1", &models.Product{ScrapedAt: now})
+	s.RecordPrice("billa", "1", 1.49, now)
+	s.EvictUnrequested(now.Add(time.Minute))
+	if changes, _ := s.PriceChanges("billa", "1", time.Time{}); len(changes) != 0 {
+		t.Error("evicted product should lose its price history")
+	}
+
+	for i, id := range []string{"7", "8", "9"} {
+		at := now.Add(time.Duration(i) * time.Minute)
+		s.SetNotFound("billa", id, at)
+		s.RecordPrice("spar", id, 1.49, at)
+	}
+	if counts, _ := s.CountNotFound(); counts["billa"] != 2 {
+		t.Errorf("not-found markers: got %d, want 2", counts["billa"])
+	}
+	if _, ok, _ := s.GetNotFound("billa", "7"); ok {
+		t.Error("oldest not-found marker should be dropped")
+	}
+	if history, _ := s.History("", time.Time{}, time.Time{}); len(history) != 2 || history[0].ProductID != "8" {
+		t.Errorf("history of uncached products: got %+v", history)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			day := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+			history := []struct {
+				price float64
+				at    time.Time
+			}{
+				{1.49, day},
+				{1.49, day.Add(4 * time.Hour)}, // unchanged, same day: dropped
+				{1.29, day.Add(8 * time.Hour)},
+				{1.29, day.Add(24 * time.Hour)}, // first of the day: kept
+				{1.29, day.Add(28 * time.Hour)}, // unchanged, same day: dropped
+				{1.29, day.Add(10 * 24 * time.Hour)},
+				{1.29, day.Add(10*24*time.Hour + time.Hour)}, // after the cutoff: kept
+			}
+			for _, h := range history {
+				if err := s.RecordPrice("billa", "1", h.price, h.at); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dropped, err := s.DownsampleHistory(day.Add(5 * 24 * time.Hour))
+			if err != nil || dropped != 2 {
+				t.Errorf("DownsampleHistory: got %d, %v", dropped, err)
+			}
+			if changes, _ := s.PriceChanges("billa", "1", day.Add(-time.Hour)); len(changes) != 2 {
+				t.Errorf("downsampling should keep every change, got %v", changes)
+			}
+			if dropped, _ := s.DownsampleHistory(day.Add(5 * 24 * time.Hour)); dropped != 0 {
+				t.Errorf("second DownsampleHistory: got %d", dropped)
+			}
+
+			now := time.Now()
+			s.Set("billa", "1", &models.Product{Name: "Milk", ScrapedAt: now})
+			s.Set("billa", "2", &models.Product{Name: "Bread", ScrapedAt: now})
+			if err := s.Touch("billa", "1", now.Add(2*time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+
+			evicted, err := s.EvictUnrequested(now.Add(time.Minute))
+			if err != nil || evicted != 1 {
+				t.Errorf("EvictUnrequested: got %d, %v", evicted, err)
+			}
+			if _, _, ok, _ := s.Get("billa", "2"); ok {
+				t.Error("unrequested product should be evicted")
+			}
+			if _, _, ok, _ := s.Get("billa", "1"); !ok {
+				t.Error("requested product should be kept")
+			}
+		})
+	}
+}
+
+func TestRedisStoreHistoryRewrites(t *testing.T) {
+	s := backends(t)["redis"].(*RedisStore)
+	day := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	key := s.key("history", "billa", "1")
+	s.RecordPrice("billa", "1", 1.49, day)
+	s.RecordPrice("billa", "1", 1.49, day.Add(time.Hour))
+
+	// A price recorded while the list is rewritten makes the rewrite start
+	// over instead of being lost.
+	calls := 0
+	err := s.updateHistory(key, func(points []pricePoint) ([]pricePoint, bool) {
+		calls++
+		if calls == 1 {
+			s.RecordPrice("billa", "1", 1.29, day.Add(2*time.Hour))
+		}
+		return downsample(points, day.Add(24*time.Hour)), true
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("updateHistory: %d calls, %v", calls, err)
+	}
+	if points, _ := s.history(s.client, key); len(points) != 2 || points[1].Price != 1.29 {
+		t.Errorf("history after rewrite: got %+v", points)
+	}
+
+	for i := range maxRedisHistory {
+		s.RecordPrice("billa", "1", 1.29, day.Add(time.Duration(i+3)*time.Hour))
+	}
+	if n, _ := s.client.LLen(context.Background(), key).Result(); n != maxRedisHistory {
+		t.Errorf("history length: got %d, want %d", n, maxRedisHistory)
+	}
+}
+
+func TestStoreHistoryImport(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			day := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+			s.RecordPrice("billa", "1", 1.49, day)
+			s.RecordPrice("billa", "1", 1.29, day.Add(48*time.Hour))
+			s.RecordPrice("spar", "2", 2.99, day.Add(time.Hour))
+
+			if added, err := s.ImportPrice("billa", "1", 1.49, day); err != nil || added {
+				t.Errorf("ImportPrice of an existing observation: got %t, %v", added, err)
+			}
+			if added, err := s.ImportPrice("billa", "1", 1.39, day.Add(24*time.Hour)); err != nil || !added {
+				t.Errorf("ImportPrice of an older observation: got %t, %v", added, err)
+			}
+
+			records, err := s.History("", time.Time{}, time.Time{})
+			if err != nil || len(records) != 4 {
+				t.Fatalf("History: got %+v, %v", records, err)
+			}
+			if records[1].Store != "spar" || records[2].Price != 1.39 || records[3].Price != 1.29 {
+				t.Errorf("History should be ordered by time: got %+v", records)
+			}
+
+			records, _ = s.History("billa", day.Add(time.Hour), day.Add(48*time.Hour))
+			if len(records) != 1 || records[0].Price != 1.39 {
+				t.Errorf("History(billa, range): got %+v", records)
+			}
+		})
+	}
+}
+
+func TestStoreConcurrentImports(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			day := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+			s.RecordPrice("billa", "1", 1.49, day.Add(24*time.Hour))
+
+			var wg sync.WaitGroup
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := s.ImportPrice("billa", "1", 1.29, day.Add(time.Duration(i)*time.Minute)); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if records, _ := s.History("billa", time.Time{}, time.Time{}); len(records) != 11 {
+				t.Errorf("concurrent imports: got %d records, want 11", len(records))
+			}
+		})
+	}
+}
+
+func TestStoreWatchlist(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			added := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+			s.AddWatch(Watch{Store: "spar", ProductID: "2", AddedAt: added})
+			s.AddWatch(Watch{Store: "billa", ProductID: "1", TargetPrice: 1.49, AddedAt: added})
+			if err := s.AddWatch(Watch{Store: "billa", ProductID: "1", TargetPrice: 1.29, Note: "milk", AddedAt: added.Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+
+			watches, err := s.Watches()
+			if err != nil || len(watches) != 2 {
+				t.Fatalf("Watches: got %+v, %v", watches, err)
+			}
+			if w := watches[0]; w.Store != "billa" || w.TargetPrice != 1.29 || w.Note != "milk" || !w.AddedAt.Equal(added) {
+				t.Errorf("updated watch: got %+v", w)
+			}
+
+			if removed, err := s.RemoveWatch("spar", "2"); err != nil || !removed {
+				t.Errorf("RemoveWatch: got %t, %v", removed, err)
+			}
+			if removed, _ := s.RemoveWatch("spar", "2"); removed {
+				t.Error("RemoveWatch of a missing product should report false")
+			}
+		})
+	}
+}
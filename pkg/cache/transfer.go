@@ -0,0 +1,54 @@
+package cache
+
+import "time"
+
+// Records returns the cached products of store, or of every store when store
+// is empty, scraped in [from, to), oldest first. A zero from or to leaves
+// that end open.
+func (c *Cache) Records(store string, from, to time.Time) ([]Record, error) {
+	records, err := c.store.List(store)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := records[:0]
+	for _, record := range records {
+		if record.Product == nil || record.ScrapedAt.Before(from) || (!to.IsZero() && !record.ScrapedAt.Before(to)) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered, nil
+}
+
+// History returns the price observations of store, or of every store when
+// store is empty, recorded in [from, to), oldest first.
+func (c *Cache) History(store string, from, to time.Time) ([]PriceRecord, error) {
+	return c.store.History(store, from, to)
+}
+
+// ImportRecord stores an exported product unless the cache already holds the
+// same or a newer scrape of it, so importing an export twice changes nothing.
+// It reports whether the product was stored.
+func (c *Cache) ImportRecord(record Record) (bool, error) {
+	_, scrapedAt, ok, err := c.store.Get(record.Store, record.ProductID)
+	if err != nil {
+		return false, err
+	}
+	if ok && !scrapedAt.Before(record.ScrapedAt) {
+		return false, nil
+	}
+
+	product := *record.Product
+	product.ScrapedAt = record.ScrapedAt
+	if err := c.store.Set(record.Store, record.ProductID, &product); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ImportPrice adds an exported price observation unless the product already
+// has one recorded at the same time. It reports whether it was added.
+func (c *Cache) ImportPrice(record PriceRecord) (bool, error) {
+	return c.store.ImportPrice(record.Store, record.ProductID, record.Price, record.RecordedAt)
+}
@@ -0,0 +1,30 @@
+package cache
+
+import "time"
+
+// Watch is a product on the watchlist. TargetPrice, when set, is the price
+// at or below which the product counts as a deal.
+type Watch struct {
+	Store       string    `json:"store"`
+	ProductID   string    `json:"product_id"`
+	TargetPrice float64   `json:"target_price,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// AddWatch puts a product on the watchlist, or updates its target price and
+// note when it is already there.
+func (c *Cache) AddWatch(store, productID string, targetPrice float64, note string) error {
+	return c.store.AddWatch(Watch{Store: store, ProductID: productID, TargetPrice: targetPrice, Note: note, AddedAt: time.Now()})
+}
+
+// RemoveWatch takes a product off the watchlist and reports whether it was
+// on it.
+func (c *Cache) RemoveWatch(store, productID string) (bool, error) {
+	return c.store.RemoveWatch(store, productID)
+}
+
+// Watches returns the watchlist ordered by store and product ID.
+func (c *Cache) Watches() ([]Watch, error) {
+	return c.store.Watches()
+}
@@ -0,0 +1,524 @@
+// Package config holds the settings of hunter-base. They are merged from
+// defaults, a YAML file, environment variables and command line flags, each
+// overriding the previous, and validated before anything starts.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/logger"
+	"hunter-base/pkg/politeness"
+	"hunter-base/pkg/proxy"
+	"hunter-base/pkg/resilience"
+	"hunter-base/pkg/scrapers/common"
+	"hunter-base/pkg/tracing"
+	"log/slog"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the effective configuration. Its YAML form is the config file
+// format and its JSON form is served by GET /admin/config.
+type Config struct {
+	// File is the config file that was loaded, if any.
+	File string `yaml:"-" json:"file,omitempty"`
+
+	Server     Server           `yaml:"server" json:"server"`
+	Logs       Logs             `yaml:"logs" json:"logs"`
+	Tracing    Tracing          `yaml:"tracing" json:"tracing"`
+	Auth       Auth             `yaml:"auth" json:"auth"`
+	Cache      Cache            `yaml:"cache" json:"cache"`
+	Retention  Retention        `yaml:"retention" json:"retention"`
+	Scraper    Scraper          `yaml:"scraper" json:"scraper"`
+	Proxies    Proxies          `yaml:"proxies" json:"proxies"`
+	Politeness Politeness       `yaml:"politeness" json:"politeness"`
+	Retry      Retry            `yaml:"retry" json:"retry"`
+	Breaker    Breaker          `yaml:"breaker" json:"breaker"`
+	Stores     map[string]Store `yaml:"stores" json:"stores"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Port              int      `yaml:"port" json:"port"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	// ShutdownTimeout bounds how long running requests and background
+	// scrapes may take to finish on SIGTERM.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	// CORSOrigins are the origins browsers may call the API from, or "*"
+	// for any. Empty sends no CORS headers.
+	CORSOrigins []string `yaml:"cors_origins" json:"cors_origins"`
+}
+
+// Logs configures the log format, levels and the rotating log file.
+type Logs struct {
+	// Path is a directory for log files. Empty logs to stderr only.
+	Path string `yaml:"path" json:"path"`
+	// Format is "text" or "json".
+	Format string `yaml:"format" json:"format"`
+	Level  string `yaml:"level" json:"level"`
+	// Levels overrides Level per package, e.g. {"scrapers": "debug"}.
+	Levels     map[string]string `yaml:"levels" json:"levels,omitempty"`
+	MaxSizeMB  int               `yaml:"max_size_mb" json:"max_size_mb"`
+	MaxBackups int               `yaml:"max_backups" json:"max_backups"`
+	MaxAge     Duration          `yaml:"max_age" json:"max_age"`
+}
+
+// Auth configures API key authentication.
+type Auth struct {
+	// Enabled requires an API key on every endpoint but the docs, health
+	// checks, version and metrics.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Path is the SQLite file holding the hashed keys and their usage.
+	Path string `yaml:"path" json:"path"`
+}
+
+// Tracing configures the export of OpenTelemetry spans.
+type Tracing struct {
+	// Exporter is "none", "otlp" or "stdout".
+	Exporter string `yaml:"exporter" json:"exporter"`
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://localhost:4318.
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// SampleRatio is the share of requests traced, from 0 to 1.
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio"`
+}
+
+// Cache configures the product cache and its TTL policy.
+type Cache struct {
+	Backend          string   `yaml:"backend" json:"backend"`
+	Path             string   `yaml:"path" json:"path"`
+	TTL              Duration `yaml:"ttl" json:"ttl"`
+	MaxStale         Duration `yaml:"max_stale" json:"max_stale"`
+	DiscountTTL      Duration `yaml:"discount_ttl" json:"discount_ttl"`
+	MinTTL           Duration `yaml:"min_ttl" json:"min_ttl"`
+	NotFoundTTL      Duration `yaml:"not_found_ttl" json:"not_found_ttl"`
+	AdaptiveTTL      bool     `yaml:"adaptive_ttl" json:"adaptive_ttl"`
+	MemoryMaxEntries int      `yaml:"memory_max_entries" json:"memory_max_entries"`
+	RedisURL         string   `yaml:"redis_url" json:"redis_url"`
+	RedisPrefix      string   `yaml:"redis_prefix" json:"redis_prefix"`
+}
+
+// Retention configures how long history and unrequested products are kept.
+type Retention struct {
+	History     Duration `yaml:"history" json:"history"`
+	Unrequested Duration `yaml:"unrequested" json:"unrequested"`
+	Vacuum      bool     `yaml:"vacuum" json:"vacuum"`
+	// Interval between retention runs; zero only runs it on demand.
+	Interval Duration `yaml:"interval" json:"interval"`
+}
+
+// Scraper configures all scrapers. BrowserTimeout bounds every browser
+// scrape, including Hofer's, which had its own 45s limit before.
+type Scraper struct {
+	// Concurrency is the number of scrapes running at once.
+	Concurrency    int      `yaml:"concurrency" json:"concurrency"`
+	UserAgent      string   `yaml:"user_agent" json:"user_agent"`
+	HTTPTimeout    Duration `yaml:"http_timeout" json:"http_timeout"`
+	BrowserTimeout Duration `yaml:"browser_timeout" json:"browser_timeout"`
+}
+
+// Proxies are used by stores without their own list.
+type Proxies struct {
+	URLs     []string `yaml:"urls" json:"urls"`
+	Rotation string   `yaml:"rotation" json:"rotation"`
+}
+
+// Politeness configures the per-domain request pacing.
+type Politeness struct {
+	MinInterval  Duration `yaml:"min_interval" json:"min_interval"`
+	Jitter       Duration `yaml:"jitter" json:"jitter"`
+	MaxPerMinute int      `yaml:"max_per_minute" json:"max_per_minute"`
+	BackoffBase  Duration `yaml:"backoff_base" json:"backoff_base"`
+	BackoffMax   Duration `yaml:"backoff_max" json:"backoff_max"`
+	Robots       bool     `yaml:"robots" json:"robots"`
+}
+
+// Retry holds the retry policy of every error class.
+type Retry struct {
+	NotFound   RetryPolicy `yaml:"not_found" json:"not_found"`
+	Timeout    RetryPolicy `yaml:"timeout" json:"timeout"`
+	Cloudflare RetryPolicy `yaml:"cloudflare" json:"cloudflare"`
+	Blocked    RetryPolicy `yaml:"blocked" json:"blocked"`
+	Browser    RetryPolicy `yaml:"browser" json:"browser"`
+	Other      RetryPolicy `yaml:"other" json:"other"`
+}
+
+// RetryPolicy mirrors resilience.Policy.
+type RetryPolicy struct {
+	Attempts int      `yaml:"attempts" json:"attempts"`
+	Delay    Duration `yaml:"delay" json:"delay"`
+	MaxDelay Duration `yaml:"max_delay" json:"max_delay"`
+}
+
+// Breaker configures the circuit breaker of every store.
+type Breaker struct {
+	Threshold int      `yaml:"threshold" json:"threshold"`
+	OpenFor   Duration `yaml:"open_for" json:"open_for"`
+}
+
+// Store holds per-store overrides. Empty fields fall back to the global
+// settings or the scraper's defaults.
+type Store struct {
+	CacheTTL      Duration `yaml:"cache_ttl" json:"cache_ttl"`
+	Strategies    []string `yaml:"strategies" json:"strategies"`
+	Proxies       []string `yaml:"proxies" json:"proxies"`
+	ProxyRotation string   `yaml:"proxy_rotation" json:"proxy_rotation"`
+}
+
+// Cache backends.
+const (
+	BackendSQLite = "sqlite"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Default returns the built-in configuration for the given stores.
+func Default(stores []string) *Config {
+	pacing := politeness.DefaultConfig()
+	scraper := common.DefaultSettings()
+
+	cfg := &Config{
+		Server: Server{
+			Port:              9090,
+			ReadHeaderTimeout: Duration(15 * time.Second),
+			IdleTimeout:       Duration(120 * time.Second),
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		Logs: Logs{
+			Format:     logger.FormatText,
+			Level:      "info",
+			MaxSizeMB:  50,
+			MaxBackups: 5,
+			MaxAge:     Duration(30 * 24 * time.Hour),
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.ExporterNone,
+			Endpoint:    tracing.DefaultEndpoint,
+			SampleRatio: 1,
+		},
+		Auth: Auth{
+			Path: "./api_keys.db",
+		},
+		Cache: Cache{
+			Backend:          BackendSQLite,
+			Path:             "./cache.db",
+			TTL:              Duration(24 * time.Hour),
+			MaxStale:         Duration(7 * 24 * time.Hour),
+			DiscountTTL:      Duration(6 * time.Hour),
+			MinTTL:           Duration(30 * time.Minute),
+			NotFoundTTL:      Duration(time.Hour),
+			AdaptiveTTL:      true,
+			MemoryMaxEntries: cache.DefaultMemoryEntries,
+			RedisURL:         "redis://localhost:6379/0",
+		},
+		Retention: Retention{
+			History:     Duration(30 * 24 * time.Hour),
+			Unrequested: Duration(90 * 24 * time.Hour),
+			Vacuum:      true,
+			Interval:    Duration(24 * time.Hour),
+		},
+		Scraper: Scraper{
+			Concurrency:    3,
+			UserAgent:      scraper.UserAgent,
+			HTTPTimeout:    Duration(scraper.HTTPTimeout),
+			BrowserTimeout: Duration(scraper.BrowserTimeout),
+		},
+		Proxies: Proxies{Rotation: string(proxy.RoundRobin)},
+		Politeness: Politeness{
+			MinInterval:  Duration(pacing.MinInterval),
+			Jitter:       Duration(pacing.Jitter),
+			MaxPerMinute: pacing.MaxPerMinute,
+			BackoffBase:  Duration(pacing.BackoffBase),
+			BackoffMax:   Duration(pacing.BackoffMax),
+			Robots:       pacing.RespectRobots,
+		},
+		Breaker: Breaker{Threshold: 5, OpenFor: Duration(2 * time.Minute)},
+		Stores:  make(map[string]Store, len(stores)),
+	}
+
+	for class, policy := range resilience.DefaultPolicies() {
+		*cfg.Retry.policy(class) = RetryPolicy{
+			Attempts: policy.MaxAttempts,
+			Delay:    Duration(policy.BaseDelay),
+			MaxDelay: Duration(policy.MaxDelay),
+		}
+	}
+	for _, store := range stores {
+		cfg.Stores[store] = Store{}
+	}
+	return cfg
+}
+
+// policy returns the policy of class.
+func (r *Retry) policy(class resilience.Class) *RetryPolicy {
+	switch class {
+	case resilience.ClassNotFound:
+		return &r.NotFound
+	case resilience.ClassTimeout:
+		return &r.Timeout
+	case resilience.ClassCloudflare:
+		return &r.Cloudflare
+	case resilience.ClassBlocked:
+		return &r.Blocked
+	case resilience.ClassBrowser:
+		return &r.Browser
+	default:
+		return &r.Other
+	}
+}
+
+// Policies converts the retry settings for resilience.Retry.
+func (r Retry) Policies() map[resilience.Class]resilience.Policy {
+	policies := make(map[resilience.Class]resilience.Policy, len(resilience.Classes))
+	for _, class := range resilience.Classes {
+		p := r.policy(class)
+		policies[class] = resilience.Policy{
+			MaxAttempts: p.Attempts,
+			BaseDelay:   time.Duration(p.Delay),
+			MaxDelay:    time.Duration(p.MaxDelay),
+		}
+	}
+	return policies
+}
+
+// Options converts the log settings for logger.Setup. Levels must have
+// passed Validate.
+func (l Logs) Options() logger.Options {
+	opts := logger.Options{
+		Format:     l.Format,
+		Dir:        l.Path,
+		MaxSizeMB:  l.MaxSizeMB,
+		MaxBackups: l.MaxBackups,
+		MaxAgeDays: int(time.Duration(l.MaxAge) / (24 * time.Hour)),
+		Levels:     map[string]slog.Level{},
+	}
+	opts.Level, _ = logger.ParseLevel(l.Level)
+	for component, name := range l.Levels {
+		opts.Levels[component], _ = logger.ParseLevel(name)
+	}
+	return opts
+}
+
+// Options converts the tracing settings for tracing.Setup.
+func (t Tracing) Options() tracing.Options {
+	return tracing.Options{
+		Exporter:    t.Exporter,
+		Endpoint:    t.Endpoint,
+		SampleRatio: t.SampleRatio,
+	}
+}
+
+// Politeness converts the pacing settings for politeness.Configure.
+func (p Politeness) Config() politeness.Config {
+	return politeness.Config{
+		MinInterval:   time.Duration(p.MinInterval),
+		MaxPerMinute:  p.MaxPerMinute,
+		Jitter:        time.Duration(p.Jitter),
+		RespectRobots: p.Robots,
+		BackoffBase:   time.Duration(p.BackoffBase),
+		BackoffMax:    time.Duration(p.BackoffMax),
+	}
+}
+
+// ScraperSettings converts the scraper settings for common.Configure. Failed
+// browser scrapes are captured in the log directory.
+func (c *Config) ScraperSettings() common.Settings {
+	return common.Settings{
+		UserAgent:      c.Scraper.UserAgent,
+		HTTPTimeout:    time.Duration(c.Scraper.HTTPTimeout),
+		BrowserTimeout: time.Duration(c.Scraper.BrowserTimeout),
+		DebugDir:       c.Logs.Path,
+	}
+}
+
+// StoreProxies returns the proxy list and rotation of store, falling back to
+// the global ones.
+func (c *Config) StoreProxies(store string) ([]string, proxy.Rotation) {
+	s := c.Stores[store]
+	urls, rotation := s.Proxies, s.ProxyRotation
+	if len(urls) == 0 {
+		urls = c.Proxies.URLs
+	}
+	if rotation == "" {
+		rotation = c.Proxies.Rotation
+	}
+	return urls, proxy.Rotation(rotation)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port: %d is not a valid port", c.Server.Port)
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout: must be positive")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout: must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	for _, origin := range c.Server.CORSOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || (err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == ""),
+			"server.cors_origins: %q is not an origin like https://example.com", origin)
+	}
+
+	check(c.Logs.Format == logger.FormatText || c.Logs.Format == logger.FormatJSON,
+		"logs.format: unknown format %q (use text or json)", c.Logs.Format)
+	_, err := logger.ParseLevel(c.Logs.Level)
+	check(err == nil, "logs.level: %v", err)
+	for _, component := range slices.Sorted(maps.Keys(c.Logs.Levels)) {
+		_, err := logger.ParseLevel(c.Logs.Levels[component])
+		check(err == nil, "logs.levels.%s: %v", component, err)
+	}
+	check(c.Logs.MaxSizeMB > 0, "logs.max_size_mb: must be positive")
+	check(c.Logs.MaxBackups >= 0, "logs.max_backups: must not be negative")
+
+	check(slices.Contains([]string{tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout}, c.Tracing.Exporter),
+		"tracing.exporter: unknown exporter %q (use none, otlp or stdout)", c.Tracing.Exporter)
+	check(c.Tracing.Exporter != tracing.ExporterOTLP || c.Tracing.Endpoint != "", "tracing.endpoint: required for the otlp exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+	check(!c.Auth.Enabled || c.Auth.Path != "", "auth.path: required when auth is enabled")
+
+	check(slices.Contains([]string{BackendSQLite, BackendMemory, BackendRedis}, c.Cache.Backend),
+		"cache.backend: unknown backend %q (use sqlite, memory or redis)", c.Cache.Backend)
+	check(c.Cache.Backend != BackendSQLite || c.Cache.Path != "", "cache.path: required for the sqlite backend")
+	check(c.Cache.Backend != BackendRedis || c.Cache.RedisURL != "", "cache.redis_url: required for the redis backend")
+	check(c.Cache.MemoryMaxEntries > 0, "cache.memory_max_entries: must be positive")
+	check(c.Cache.TTL > 0, "cache.ttl: must be positive")
+	for name, d := range map[string]Duration{
+		"cache.max_stale":         c.Cache.MaxStale,
+		"cache.discount_ttl":      c.Cache.DiscountTTL,
+		"cache.min_ttl":           c.Cache.MinTTL,
+		"cache.not_found_ttl":     c.Cache.NotFoundTTL,
+		"logs.max_age":            c.Logs.MaxAge,
+		"retention.history":       c.Retention.History,
+		"retention.unrequested":   c.Retention.Unrequested,
+		"retention.interval":      c.Retention.Interval,
+		"politeness.min_interval": c.Politeness.MinInterval,
+		"politeness.jitter":       c.Politeness.Jitter,
+		"politeness.backoff_base": c.Politeness.BackoffBase,
+		"politeness.backoff_max":  c.Politeness.BackoffMax,
+	} {
+		check(d >= 0, "%s: must not be negative", name)
+	}
+
+	check(c.Scraper.Concurrency > 0, "scraper.concurrency: must be positive")
+	check(strings.TrimSpace(c.Scraper.UserAgent) != "", "scraper.user_agent: must not be empty")
+	check(c.Scraper.HTTPTimeout > 0, "scraper.http_timeout: must be positive")
+	check(c.Scraper.BrowserTimeout > 0, "scraper.browser_timeout: must be positive")
+
+	check(c.Politeness.MaxPerMinute >= 0, "politeness.max_per_minute: must not be negative")
+
+	for _, class := range resilience.Classes {
+		p := c.Retry.policy(class)
+		check(p.Attempts > 0, "retry.%s.attempts: must be at least 1", class)
+		check(p.Delay >= 0, "retry.%s.delay: must not be negative", class)
+		check(p.MaxDelay >= 0, "retry.%s.max_delay: must not be negative", class)
+	}
+
+	check(c.Breaker.Threshold > 0, "breaker.threshold: must be at least 1")
+	check(c.Breaker.OpenFor > 0, "breaker.open_for: must be positive")
+
+	errs = append(errs, validateProxies("proxies", c.Proxies.URLs, c.Proxies.Rotation)...)
+	for _, store := range slices.Sorted(maps.Keys(c.Stores)) {
+		s := c.Stores[store]
+		check(s.CacheTTL >= 0, "stores.%s.cache_ttl: must not be negative", store)
+		for _, strategy := range s.Strategies {
+			check(len(common.ParseStrategies(strategy)) == 1, "stores.%s.strategies: unknown strategy %q (use api, html or browser)", store, strategy)
+		}
+		errs = append(errs, validateProxies("stores."+store, s.Proxies, s.ProxyRotation)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateProxies(path string, urls []string, rotation string) []error {
+	var errs []error
+	for _, raw := range urls {
+		if _, err := proxy.Parse(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s.urls: %w", path, err))
+		}
+	}
+	switch proxy.Rotation(rotation) {
+	case "", proxy.RoundRobin, proxy.Sticky, proxy.Failover:
+	default:
+		errs = append(errs, fmt.Errorf("%s.rotation: unknown rotation %q (use round-robin, sticky or failover)", path, rotation))
+	}
+	return errs
+}
+
+// Redacted returns a copy of c with the credentials in proxy and Redis URLs
+// masked, for display.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Cache.RedisURL = redactURL(c.Cache.RedisURL)
+	out.Tracing.Endpoint = redactURL(c.Tracing.Endpoint)
+	out.Proxies.URLs = redactURLs(c.Proxies.URLs)
+	out.Stores = make(map[string]Store, len(c.Stores))
+	for name, s := range c.Stores {
+		s.Proxies = redactURLs(s.Proxies)
+		out.Stores[name] = s
+	}
+	return &out
+}
+
+func redactURLs(urls []string) []string {
+	if urls == nil {
+		return nil
+	}
+	out := make([]string, len(urls))
+	for i, raw := range urls {
+		out[i] = redactURL(raw)
+	}
+	return out
+}
+
+// redactURL masks the password of raw, or the user name when it is the only
+// credential, as some providers put the token there.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		if strings.Contains(raw, "@") {
+			return "xxxxx"
+		}
+		return raw
+	}
+	if u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	} else {
+		u.User = url.User("xxxxx")
+	}
+	return u.String()
+}
+
+// Duration is a time.Duration written as a Go duration string such as "90s"
+// in YAML and JSON.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
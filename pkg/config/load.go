@@ -0,0 +1,337 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"hunter-base/pkg/resilience"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is loaded when it exists and no other file is given. It lives
+// in the /config volume of the Docker image.
+const DefaultFile = "/config/hunter-base.yaml"
+
+// FileEnv names the environment variable that selects the config file.
+const FileEnv = "HUNTER_CONFIG_FILE"
+
+// Loader merges the configuration sources. Flags only take effect if they
+// were registered on the flag set that parsed the command line.
+type Loader struct {
+	stores []string
+	getenv func(string) string
+	file   string
+	flags  []flagValue
+}
+
+type flagValue struct {
+	name, raw string
+}
+
+// NewLoader returns a Loader for the given stores reading the process
+// environment.
+func NewLoader(stores []string) *Loader {
+	return &Loader{stores: stores, getenv: os.Getenv}
+}
+
+// RegisterFlags adds --config to fs, and with all a flag for every global
+// setting, named after its environment variable without the HUNTER_ prefix
+// (CACHE_TTL_MINUTES becomes --cache-ttl-minutes).
+func (l *Loader) RegisterFlags(fs *flag.FlagSet, all bool) {
+	fs.StringVar(&l.file, "config", "", "YAML config file (default: $"+FileEnv+" or "+DefaultFile+" if it exists)")
+	if !all {
+		return
+	}
+	for _, b := range bindings(Default(l.stores), nil) {
+		name := flagName(b.env)
+		fs.Func(name, b.usage, func(raw string) error {
+			l.flags = append(l.flags, flagValue{name, raw})
+			return nil
+		})
+	}
+}
+
+// Load returns the merged, validated configuration.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default(l.stores)
+
+	if err := l.loadFile(cfg); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	byFlag := map[string]binding{}
+	for _, b := range bindings(cfg, l.stores) {
+		if b.flag {
+			byFlag[flagName(b.env)] = b
+		}
+		if raw := l.getenv(b.env); raw != "" {
+			if err := b.set(raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", b.env, err))
+			}
+		}
+	}
+	for _, f := range l.flags {
+		if err := byFlag[f.name].set(f.raw); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", f.name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the YAML file onto cfg. Only an explicitly chosen file
+// has to exist; unknown keys are rejected so typos do not go unnoticed.
+func (l *Loader) loadFile(cfg *Config) error {
+	path, explicit := l.file, true
+	if path == "" {
+		path = l.getenv(FileEnv)
+	}
+	if path == "" {
+		path, explicit = DefaultFile, false
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	for store := range cfg.Stores {
+		if !slices.Contains(l.stores, store) {
+			return fmt.Errorf("config file %s: unknown store %q in stores", path, store)
+		}
+	}
+	cfg.File = path
+	return nil
+}
+
+// binding ties an environment variable, and optionally a flag, to a setting.
+type binding struct {
+	env   string
+	usage string
+	flag  bool
+	set   func(raw string) error
+}
+
+func flagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(env, "HUNTER_"), "_", "-"))
+}
+
+// bindings lists the environment variables of cfg. Global settings also get
+// a flag; per-store settings of the given stores only exist as variables.
+func bindings(cfg *Config, stores []string) []binding {
+	global := func(env, usage string, set func(string) error) binding {
+		return binding{env: env, usage: usage, flag: true, set: set}
+	}
+
+	bs := []binding{
+		global("HUNTER_PORT", "port to listen on", setInt(&cfg.Server.Port)),
+		global("HUNTER_READ_HEADER_TIMEOUT", "time allowed to read request headers", setDuration(&cfg.Server.ReadHeaderTimeout)),
+		global("HUNTER_IDLE_TIMEOUT", "how long idle keep-alive connections stay open", setDuration(&cfg.Server.IdleTimeout)),
+		global("HUNTER_SHUTDOWN_TIMEOUT", "how long running scrapes may finish on shutdown", setDuration(&cfg.Server.ShutdownTimeout)),
+		global("HUNTER_CORS_ORIGINS", "comma-separated origins allowed to call the API from a browser, or *", setList(&cfg.Server.CORSOrigins)),
+		global("HUNTER_LOGS_PATH", "directory to write the rotating log file to", setString(&cfg.Logs.Path)),
+		global("HUNTER_LOG_FORMAT", "log format: text or json", setString(&cfg.Logs.Format)),
+		global("HUNTER_LOG_LEVEL", "minimum log level: debug, info, warn or error", setString(&cfg.Logs.Level)),
+		global("HUNTER_LOG_LEVELS", "log levels per package, e.g. scrapers=debug,cache=warn", setMap(&cfg.Logs.Levels)),
+		global("HUNTER_LOG_MAX_SIZE_MB", "size in megabytes at which the log file is rotated", setInt(&cfg.Logs.MaxSizeMB)),
+		global("HUNTER_LOG_MAX_BACKUPS", "rotated log files kept (0 keeps all)", setInt(&cfg.Logs.MaxBackups)),
+		global("HUNTER_LOG_MAX_AGE_DAYS", "days rotated log files are kept (0 keeps them forever)", setDays(&cfg.Logs.MaxAge)),
+
+		global("HUNTER_TRACING_EXPORTER", "span exporter: none, otlp or stdout", setString(&cfg.Tracing.Exporter)),
+		global("HUNTER_TRACING_ENDPOINT", "OTLP/HTTP collector URL", setString(&cfg.Tracing.Endpoint)),
+		global("HUNTER_TRACING_SAMPLE_RATIO", "share of requests traced, from 0 to 1", setFloat(&cfg.Tracing.SampleRatio)),
+
+		global("HUNTER_AUTH_ENABLED", "require API keys, see the keys command", setBool(&cfg.Auth.Enabled)),
+		global("HUNTER_AUTH_DB_PATH", "SQLite file of the API keys", setString(&cfg.Auth.Path)),
+
+		global("CACHE_BACKEND", "cache backend: sqlite, memory or redis", setString(&cfg.Cache.Backend)),
+		global("CACHE_DB_PATH", "SQLite cache file", setString(&cfg.Cache.Path)),
+		global("CACHE_TTL_MINUTES", "minutes a scraped product stays fresh", setMinutes(&cfg.Cache.TTL)),
+		global("CACHE_MAX_STALE_MINUTES", "minutes an expired product may still be served when scraping fails", setMinutes(&cfg.Cache.MaxStale)),
+		global("CACHE_DISCOUNT_TTL_MINUTES", "TTL of discounted products in minutes", setMinutes(&cfg.Cache.DiscountTTL)),
+		global("CACHE_MIN_TTL_MINUTES", "lower bound of the adaptive TTL in minutes", setMinutes(&cfg.Cache.MinTTL)),
+		global("CACHE_NOT_FOUND_TTL_MINUTES", "minutes a not-found result is remembered", setMinutes(&cfg.Cache.NotFoundTTL)),
+		global("CACHE_ADAPTIVE_TTL", "shorten the TTL of products whose price changes often", setBool(&cfg.Cache.AdaptiveTTL)),
+		global("CACHE_MEMORY_MAX_ENTRIES", "entries kept by the memory backend", setInt(&cfg.Cache.MemoryMaxEntries)),
+		global("CACHE_REDIS_URL", "Redis URL of the redis backend", setString(&cfg.Cache.RedisURL)),
+		global("CACHE_REDIS_PREFIX", "prefix of Redis keys", setString(&cfg.Cache.RedisPrefix)),
+
+		global("RETENTION_HISTORY_DAYS", "days of full price history kept", setDays(&cfg.Retention.History)),
+		global("RETENTION_UNREQUESTED_DAYS", "days after which unrequested products are evicted (0 keeps them)", setDays(&cfg.Retention.Unrequested)),
+		global("RETENTION_VACUUM", "vacuum the cache after retention", setBool(&cfg.Retention.Vacuum)),
+		global("RETENTION_INTERVAL", "interval between retention runs (0 runs it on demand only)", setDuration(&cfg.Retention.Interval)),
+
+		global("SCRAPER_CONCURRENCY", "scrapes running at once", setInt(&cfg.Scraper.Concurrency)),
+		global("SCRAPER_USER_AGENT", "user agent sent by scrapers", setString(&cfg.Scraper.UserAgent)),
+		global("SCRAPER_HTTP_TIMEOUT", "timeout of a plain HTTP request", setDuration(&cfg.Scraper.HTTPTimeout)),
+		global("SCRAPER_BROWSER_TIMEOUT", "timeout of a browser scrape", setDuration(&cfg.Scraper.BrowserTimeout)),
+
+		global("HUNTER_PROXIES", "comma-separated proxy URLs", setList(&cfg.Proxies.URLs)),
+		global("HUNTER_PROXY_ROTATION", "proxy rotation: round-robin, sticky or failover", setString(&cfg.Proxies.Rotation)),
+
+		global("POLITENESS_MIN_INTERVAL", "minimum gap between requests to a domain", setDuration(&cfg.Politeness.MinInterval)),
+		global("POLITENESS_JITTER", "random delay added to every interval", setDuration(&cfg.Politeness.Jitter)),
+		global("POLITENESS_MAX_PER_MINUTE", "requests per domain and minute (0 disables the cap)", setInt(&cfg.Politeness.MaxPerMinute)),
+		global("POLITENESS_BACKOFF_BASE", "first pause after a domain throttles us", setDuration(&cfg.Politeness.BackoffBase)),
+		global("POLITENESS_BACKOFF_MAX", "longest pause after repeated throttling", setDuration(&cfg.Politeness.BackoffMax)),
+		global("POLITENESS_ROBOTS", "respect robots.txt", setBool(&cfg.Politeness.Robots)),
+
+		global("BREAKER_THRESHOLD", "consecutive failures that open a store's circuit", setInt(&cfg.Breaker.Threshold)),
+		global("BREAKER_OPEN_FOR", "how long an open circuit skips scraping", setDuration(&cfg.Breaker.OpenFor)),
+	}
+
+	for _, class := range resilience.Classes {
+		prefix := "RETRY_" + strings.ToUpper(string(class))
+		policy := cfg.Retry.policy(class)
+		bs = append(bs,
+			global(prefix+"_ATTEMPTS", fmt.Sprintf("attempts for %s errors, including the first", class), setInt(&policy.Attempts)),
+			global(prefix+"_DELAY", fmt.Sprintf("first retry delay for %s errors", class), setDuration(&policy.Delay)),
+			global(prefix+"_MAX_DELAY", fmt.Sprintf("longest retry delay for %s errors", class), setDuration(&policy.MaxDelay)),
+		)
+	}
+
+	for _, store := range stores {
+		prefix := strings.ToUpper(strings.ReplaceAll(store, "-", "_"))
+		setStore := func(update func(*Store, string) error) func(string) error {
+			return func(raw string) error {
+				s := cfg.Stores[store]
+				if err := update(&s, raw); err != nil {
+					return err
+				}
+				cfg.Stores[store] = s
+				return nil
+			}
+		}
+		bs = append(bs,
+			binding{env: prefix + "_CACHE_TTL_MINUTES", set: setStore(func(s *Store, raw string) error { return setMinutes(&s.CacheTTL)(raw) })},
+			binding{env: prefix + "_STRATEGIES", set: setStore(func(s *Store, raw string) error { return setList(&s.Strategies)(raw) })},
+			binding{env: prefix + "_PROXIES", set: setStore(func(s *Store, raw string) error { return setList(&s.Proxies)(raw) })},
+			binding{env: prefix + "_PROXY_ROTATION", set: setStore(func(s *Store, raw string) error { return setString(&s.ProxyRotation)(raw) })},
+		)
+	}
+	return bs
+}
+
+func setString(dst *string) func(string) error {
+	return func(raw string) error {
+		*dst = raw
+		return nil
+	}
+}
+
+// setList splits a comma-separated list, dropping empty elements.
+func setList(dst *[]string) func(string) error {
+	return func(raw string) error {
+		*dst = nil
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+		return nil
+	}
+}
+
+// setMap parses comma-separated key=value pairs.
+func setMap(dst *map[string]string) func(string) error {
+	return func(raw string) error {
+		*dst = map[string]string{}
+		for _, item := range strings.Split(raw, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid pair %q, expected key=value", item)
+			}
+			(*dst)[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(raw string) error {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		*dst = parsed
+		return nil
+	}
+}
+
+func setFloat(dst *float64) func(string) error {
+	return func(raw string) error {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		*dst = parsed
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(raw string) error {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		*dst = parsed
+		return nil
+	}
+}
+
+func setDuration(dst *Duration) func(string) error {
+	return func(raw string) error {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		*dst = Duration(parsed)
+		return nil
+	}
+}
+
+func setMinutes(dst *Duration) func(string) error {
+	return setUnits(dst, time.Minute, "minutes")
+}
+
+func setDays(dst *Duration) func(string) error {
+	return setUnits(dst, 24*time.Hour, "days")
+}
+
+func setUnits(dst *Duration, unit time.Duration, name string) func(string) error {
+	return func(raw string) error {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid number of %s %q", name, raw)
+		}
+		*dst = Duration(time.Duration(parsed) * unit)
+		return nil
+	}
+}
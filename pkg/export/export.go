@@ -0,0 +1,274 @@
+// Package export writes cached products and their price history as CSV, JSON
+// or Parquet, and merges such exports back into a cache.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/models"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported formats.
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "json"
+	FormatParquet = "parquet"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{FormatCSV, FormatJSON, FormatParquet}
+
+// Table names in the table column of CSV and Parquet exports.
+const (
+	tableProducts = "products"
+	tableHistory  = "history"
+)
+
+// parquetBatch is the number of rows buffered per Parquet write.
+const parquetBatch = 1000
+
+// ErrUnknownFormat is returned for formats other than those in Formats.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Filter limits an export to one store and a time range. Products are matched
+// by scrape time, history by record time. Zero values match everything.
+type Filter struct {
+	Store string
+	From  time.Time
+	To    time.Time
+}
+
+// Report counts what an import added and what it skipped because the cache
+// already had it.
+type Report struct {
+	ProductsImported int `json:"products_imported"`
+	ProductsSkipped  int `json:"products_skipped"`
+	HistoryImported  int `json:"history_imported"`
+	HistorySkipped   int `json:"history_skipped"`
+}
+
+// row is one line of a CSV or Parquet export: a cached product or a price
+// observation, told apart by Table. Products carry their full JSON in Data so
+// they import without loss; the other columns are for spreadsheets.
+type row struct {
+	Table        string    `parquet:"table"`
+	Store        string    `parquet:"store"`
+	ProductID    string    `parquet:"product_id"`
+	Timestamp    time.Time `parquet:"timestamp,timestamp(nanosecond)"`
+	Price        float64   `parquet:"price"`
+	Currency     string    `parquet:"currency"`
+	Name         string    `parquet:"name"`
+	Brand        string    `parquet:"brand"`
+	GTIN13       string    `parquet:"gtin13"`
+	IsDiscounted bool      `parquet:"is_discounted"`
+	Data         string    `parquet:"data"`
+}
+
+var csvHeader = []string{"table", "store", "product_id", "timestamp", "price", "currency", "name", "brand", "gtin13", "is_discounted", "data"}
+
+// jsonProduct and jsonPrice are the elements of a JSON export.
+type jsonProduct struct {
+	Store     string          `json:"store"`
+	ProductID string          `json:"product_id"`
+	ScrapedAt time.Time       `json:"scraped_at"`
+	Product   *models.Product `json:"product"`
+}
+
+type jsonPrice struct {
+	Store      string    `json:"store"`
+	ProductID  string    `json:"product_id"`
+	Price      float64   `json:"price"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/json"
+	}
+}
+
+// ParseTime accepts an RFC 3339 timestamp or a plain date (midnight UTC).
+// An empty string gives the zero time.
+func ParseTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+// Write exports the products and price history of c matching filter to w.
+func Write(w io.Writer, format string, c *cache.Cache, filter Filter) error {
+	records, err := c.Records(filter.Store, filter.From, filter.To)
+	if err != nil {
+		return err
+	}
+	history, err := c.History(filter.Store, filter.From, filter.To)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, records, history)
+	case FormatJSON:
+		return writeJSON(w, records, history)
+	case FormatParquet:
+		return writeParquet(w, records, history)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+func writeCSV(w io.Writer, records []cache.Record, history []cache.PriceRecord) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+
+	write := func(r row) error {
+		return out.Write([]string{
+			r.Table, r.Store, r.ProductID, r.Timestamp.UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(r.Price, 'f', -1, 64), r.Currency, r.Name, r.Brand, r.GTIN13,
+			strconv.FormatBool(r.IsDiscounted), r.Data,
+		})
+	}
+	for _, record := range records {
+		r, err := productRow(record)
+		if err != nil {
+			return err
+		}
+		if err := write(r); err != nil {
+			return err
+		}
+	}
+	for _, price := range history {
+		if err := write(priceRow(price)); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// writeJSON streams {"products": [...], "history": [...]} element by element
+// so large exports are not built in memory twice.
+func writeJSON(w io.Writer, records []cache.Record, history []cache.PriceRecord) error {
+	out := bufio.NewWriter(w)
+
+	writeElem := func(i int, v any) error {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+
+	out.WriteString(`{"products":[`)
+	for i, record := range records {
+		if err := writeElem(i, jsonProduct{record.Store, record.ProductID, record.ScrapedAt, record.Product}); err != nil {
+			return err
+		}
+	}
+	out.WriteString(`],"history":[`)
+	for i, price := range history {
+		if err := writeElem(i, jsonPrice{price.Store, price.ProductID, price.Price, price.RecordedAt}); err != nil {
+			return err
+		}
+	}
+	out.WriteString("]}\n")
+	return out.Flush()
+}
+
+func writeParquet(w io.Writer, records []cache.Record, history []cache.PriceRecord) error {
+	out := parquet.NewGenericWriter[row](w)
+
+	batch := make([]row, 0, parquetBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := out.Write(batch)
+		batch = batch[:0]
+		return err
+	}
+	add := func(r row) error {
+		batch = append(batch, r)
+		if len(batch) == parquetBatch {
+			return flush()
+		}
+		return nil
+	}
+
+	for _, record := range records {
+		r, err := productRow(record)
+		if err != nil {
+			return err
+		}
+		if err := add(r); err != nil {
+			return err
+		}
+	}
+	for _, price := range history {
+		if err := add(priceRow(price)); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func productRow(record cache.Record) (row, error) {
+	data, err := json.Marshal(record.Product)
+	if err != nil {
+		return row{}, err
+	}
+	p := record.Product
+	return row{
+		Table:        tableProducts,
+		Store:        record.Store,
+		ProductID:    record.ProductID,
+		Timestamp:    record.ScrapedAt,
+		Price:        p.Price,
+		Currency:     p.Currency,
+		Name:         p.Name,
+		Brand:        p.Brand,
+		GTIN13:       p.GTIN13,
+		IsDiscounted: p.IsDiscounted,
+		Data:         string(data),
+	}, nil
+}
+
+func priceRow(price cache.PriceRecord) row {
+	return row{
+		Table:     tableHistory,
+		Store:     price.Store,
+		ProductID: price.ProductID,
+		Timestamp: price.RecordedAt,
+		Price:     price.Price,
+	}
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"bytes"
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T) *cache.Cache {
+	t.Helper()
+	c := cache.NewWithStore(cache.NewMemoryStore(0), time.Hour)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	scrapedAt := time.Date(2026, 3, 1, 8, 30, 0, 123456789, time.UTC)
+
+	src := newTestCache(t)
+	src.Set("billa", "1", &models.Product{Name: "Milk, 1L", Price: 1.49, Currency: "EUR", ScrapedAt: scrapedAt.Add(-24 * time.Hour)})
+	src.Set("billa", "1", &models.Product{Name: "Milk, 1L", Price: 1.29, Currency: "EUR", IsDiscounted: true, ScrapedAt: scrapedAt})
+	src.Set("spar", "2", &models.Product{Name: `Bread "Classic"`, Price: 2.99, Currency: "EUR", ScrapedAt: scrapedAt})
+
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, format, src, Filter{}); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := newTestCache(t)
+			report, err := Import(dst, bytes.NewReader(buf.Bytes()), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *report != (Report{ProductsImported: 2, HistoryImported: 3}) {
+				t.Errorf("first import: got %+v", *report)
+			}
+
+			report, err = Import(dst, bytes.NewReader(buf.Bytes()), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *report != (Report{ProductsSkipped: 2, HistorySkipped: 3}) {
+				t.Errorf("second import should skip everything: got %+v", *report)
+			}
+
+			product, got, ok := dst.GetStale("billa", "1")
+			if !ok || !got.Equal(scrapedAt) || product.Price != 1.29 || !product.IsDiscounted || product.Name != "Milk, 1L" {
+				t.Errorf("imported product: got %+v at %s", product, got)
+			}
+		})
+	}
+}
+
+func TestWriteFilter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	c := newTestCache(t)
+	c.Set("billa", "1", &models.Product{Price: 1.49, ScrapedAt: now.Add(-48 * time.Hour)})
+	c.Set("billa", "2", &models.Product{Price: 2.49, ScrapedAt: now})
+	c.Set("spar", "3", &models.Product{Price: 3.49, ScrapedAt: now})
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, c, Filter{Store: "billa", From: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "products,billa,2,") || !strings.HasPrefix(lines[2], "history,billa,2,") {
+		t.Errorf("got:\n%s", buf.String())
+	}
+}
+
+func TestImportKeepsNewerScrape(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	old := newTestCache(t)
+	old.Set("billa", "1", &models.Product{Price: 1.49, ScrapedAt: now.Add(-time.Hour)})
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, old, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestCache(t)
+	c.Set("billa", "1", &models.Product{Price: 1.29, ScrapedAt: now})
+	report, err := Import(c, &buf, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ProductsSkipped != 1 || report.HistoryImported != 1 {
+		t.Errorf("got %+v", *report)
+	}
+	if product, _, _ := c.GetStale("billa", "1"); product.Price != 1.29 {
+		t.Errorf("newer scrape was overwritten: got %.2f", product.Price)
+	}
+}
+
+func TestImportRejectsInvalidInput(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		input  string
+	}{
+		"bad header":    {FormatCSV, "a,b,c\n"},
+		"bad timestamp": {FormatCSV, strings.Join(csvHeader, ",") + "\nhistory,billa,1,yesterday,1.49,,,,,false,\n"},
+		"missing store": {FormatJSON, `{"history":[{"product_id":"1","price":1.49,"recorded_at":"2026-03-01T00:00:00Z"}]}`},
+		"bad format":    {"xml", ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t)
+			if _, err := Import(c, strings.NewReader(tt.input), tt.format); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/cache"
+	"hunter-base/pkg/models"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Import merges an export read from r into c. Products are keyed on
+// (store, product_id, scraped_at) and only replace older scrapes; history is
+// keyed on (store, product_id, recorded_at). Importing the same export twice
+// therefore changes nothing the second time. The whole input is validated
+// before anything is written.
+func Import(c *cache.Cache, r io.Reader, format string) (*Report, error) {
+	records, history, err := read(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	for _, record := range records {
+		imported, err := c.ImportRecord(record)
+		if err != nil {
+			return report, err
+		}
+		if imported {
+			report.ProductsImported++
+		} else {
+			report.ProductsSkipped++
+		}
+	}
+	for _, price := range history {
+		imported, err := c.ImportPrice(price)
+		if err != nil {
+			return report, err
+		}
+		if imported {
+			report.HistoryImported++
+		} else {
+			report.HistorySkipped++
+		}
+	}
+	return report, nil
+}
+
+func read(r io.Reader, format string) ([]cache.Record, []cache.PriceRecord, error) {
+	switch format {
+	case FormatCSV:
+		rows, err := readCSV(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fromRows(rows)
+	case FormatJSON:
+		return readJSON(r)
+	case FormatParquet:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows, err := parquet.Read[row](bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid parquet file: %w", err)
+		}
+		return fromRows(rows)
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+func readCSV(r io.Reader) ([]row, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = len(csvHeader)
+
+	header, err := in.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+	if !slices.Equal(header, csvHeader) {
+		return nil, fmt.Errorf("invalid csv header: expected %v", csvHeader)
+	}
+
+	var rows []row
+	for line := 2; ; line++ {
+		fields, err := in.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r := row{Table: fields[0], Store: fields[1], ProductID: fields[2], Data: fields[10]}
+		if r.Timestamp, err = time.Parse(time.RFC3339Nano, fields[3]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp %q", line, fields[3])
+		}
+		if r.Price, err = strconv.ParseFloat(fields[4], 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, fields[4])
+		}
+		rows = append(rows, r)
+	}
+}
+
+func readJSON(r io.Reader) ([]cache.Record, []cache.PriceRecord, error) {
+	var doc struct {
+		Products []jsonProduct `json:"products"`
+		History  []jsonPrice   `json:"history"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	records := make([]cache.Record, 0, len(doc.Products))
+	for i, p := range doc.Products {
+		if err := validate(p.Store, p.ProductID, p.ScrapedAt); err != nil {
+			return nil, nil, fmt.Errorf("products[%d]: %w", i, err)
+		}
+		if p.Product == nil {
+			return nil, nil, fmt.Errorf("products[%d]: missing product", i)
+		}
+		records = append(records, cache.Record{Store: p.Store, ProductID: p.ProductID, Product: p.Product, ScrapedAt: p.ScrapedAt})
+	}
+
+	history := make([]cache.PriceRecord, 0, len(doc.History))
+	for i, p := range doc.History {
+		if err := validate(p.Store, p.ProductID, p.RecordedAt); err != nil {
+			return nil, nil, fmt.Errorf("history[%d]: %w", i, err)
+		}
+		history = append(history, cache.PriceRecord{Store: p.Store, ProductID: p.ProductID, Price: p.Price, RecordedAt: p.RecordedAt})
+	}
+	return records, history, nil
+}
+
+// fromRows splits CSV or Parquet rows into products and history.
+func fromRows(rows []row) ([]cache.Record, []cache.PriceRecord, error) {
+	var records []cache.Record
+	var history []cache.PriceRecord
+
+	for i, r := range rows {
+		if err := validate(r.Store, r.ProductID, r.Timestamp); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+
+		switch r.Table {
+		case tableProducts:
+			var product models.Product
+			if err := json.Unmarshal([]byte(r.Data), &product); err != nil {
+				return nil, nil, fmt.Errorf("row %d: invalid product data: %w", i+1, err)
+			}
+			records = append(records, cache.Record{Store: r.Store, ProductID: r.ProductID, Product: &product, ScrapedAt: r.Timestamp})
+		case tableHistory:
+			history = append(history, cache.PriceRecord{Store: r.Store, ProductID: r.ProductID, Price: r.Price, RecordedAt: r.Timestamp})
+		default:
+			return nil, nil, fmt.Errorf("row %d: unknown table %q", i+1, r.Table)
+		}
+	}
+	return records, history, nil
+}
+
+func validate(store, productID string, at time.Time) error {
+	switch {
+	case store == "":
+		return errors.New("missing store")
+	case productID == "":
+		return errors.New("missing product_id")
+	case at.IsZero():
+		return errors.New("missing timestamp")
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDistinct bounds the subjects a Deduper remembers per message and window.
+// Summaries report at least this many once it is reached.
+const maxDistinct = 10000
+
+// Clock is the time source of a Deduper. Tests replace it with a fake one.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending Clock.AfterFunc call.
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// DedupOptions configure a Deduper. The zero value logs each message once a
+// minute and summarizes the rest at info level.
+type DedupOptions struct {
+	// Window is how long repeats are collapsed before a summary is written.
+	Window time.Duration
+	// Limit is how many lines of the same message are written as-is per
+	// window before further ones are only counted.
+	Limit int
+	// Level is the level lines and summaries are written at.
+	Level slog.Level
+	// Unit names the distinct subjects in summaries, e.g. "products".
+	Unit string
+	// DistinctBy lists the attributes that tell subjects apart, e.g. store
+	// and id. By default all attributes do.
+	DistinctBy []string
+	// Logger writes the lines, by default the root logger.
+	Logger *slog.Logger
+	// Clock is the time source, by default the system clock.
+	Clock Clock
+}
+
+// Deduper collapses repeated log lines of one category, such as cache hits,
+// into periodic summaries:
+//
+//	cache hits: 412 across 37 products in last 1m0s
+//
+// Lines are grouped by their message, not by their attributes, so "Cache hit"
+// for billa/1 and billa/2 count as repeats of each other. The first Limit
+// lines of each message in a window are written as-is. When the window ends,
+// a summary is written for every message that had lines held back, and the
+// next line starts a new window.
+type Deduper struct {
+	name string
+	opts DedupOptions
+
+	mu       sync.Mutex
+	start    time.Time
+	timer    Timer
+	window   int
+	messages map[string]*dedupEntry
+	order    []string
+}
+
+// dedupEntry counts the lines of one message in the current window.
+type dedupEntry struct {
+	count    int
+	distinct map[string]struct{}
+}
+
+var (
+	dedupersMu sync.Mutex
+	dedupers   []*Deduper
+)
+
+// NewDeduper returns a Deduper for the category name, which opens its
+// summaries. Flush writes out the pending summaries of every Deduper.
+func NewDeduper(name string, opts DedupOptions) *Deduper {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 1
+	}
+	if opts.Unit == "" {
+		opts.Unit = "subjects"
+	}
+	if opts.Logger == nil {
+		opts.Logger = For("")
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+
+	d := &Deduper{name: name, opts: opts, messages: map[string]*dedupEntry{}}
+
+	dedupersMu.Lock()
+	dedupers = append(dedupers, d)
+	dedupersMu.Unlock()
+	return d
+}
+
+// Log writes msg with the given attributes, as slog.Logger.Log does, unless
+// the message already reached its limit in the current window, in which case
+// it is only counted towards the summary.
+func (d *Deduper) Log(ctx context.Context, msg string, args ...any) {
+	d.mu.Lock()
+	if d.timer == nil {
+		window := d.window
+		d.start = d.opts.Clock.Now()
+		d.timer = d.opts.Clock.AfterFunc(d.opts.Window, func() { d.expire(window) })
+	}
+
+	entry, ok := d.messages[msg]
+	if !ok {
+		entry = &dedupEntry{distinct: map[string]struct{}{}}
+		d.messages[msg] = entry
+		d.order = append(d.order, msg)
+	}
+	entry.count++
+	if len(entry.distinct) < maxDistinct {
+		entry.distinct[d.subject(args)] = struct{}{}
+	}
+	write := entry.count <= d.opts.Limit
+	d.mu.Unlock()
+
+	if write {
+		d.opts.Logger.Log(ctx, d.opts.Level, msg, args...)
+	}
+}
+
+// subject identifies what a line is about from its DistinctBy attributes.
+func (d *Deduper) subject(args []any) string {
+	var b strings.Builder
+	for _, attr := range slog.Group("", args...).Value.Group() {
+		if len(d.opts.DistinctBy) > 0 && !slices.Contains(d.opts.DistinctBy, attr.Key) {
+			continue
+		}
+		fmt.Fprintf(&b, "%s=%s ", attr.Key, attr.Value)
+	}
+	return b.String()
+}
+
+// expire ends window unless Flush already ended it.
+func (d *Deduper) expire(window int) {
+	d.mu.Lock()
+	if d.window != window {
+		d.mu.Unlock()
+		return
+	}
+	d.end()
+}
+
+// Flush ends the current window and writes the summaries of messages that
+// had lines held back.
+func (d *Deduper) Flush() {
+	d.mu.Lock()
+	d.end()
+}
+
+// end resets the window and writes its summaries. It is called with d.mu
+// held and releases it before writing.
+func (d *Deduper) end() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.window++
+	elapsed := d.opts.Clock.Now().Sub(d.start).Round(time.Second)
+	messages, order := d.messages, d.order
+	d.messages, d.order = map[string]*dedupEntry{}, nil
+	d.mu.Unlock()
+
+	for _, msg := range order {
+		entry := messages[msg]
+		if entry.count <= d.opts.Limit {
+			continue
+		}
+		d.opts.Logger.Log(context.Background(), d.opts.Level,
+			fmt.Sprintf("%s: %d across %d %s in last %s", d.name, entry.count, len(entry.distinct), d.opts.Unit, elapsed),
+			"message", msg, "suppressed", entry.count-d.opts.Limit)
+	}
+}
+
+// Flush writes out the pending summaries of all Dedupers right away, e.g.
+// before the process exits.
+func Flush() {
+	dedupersMu.Lock()
+	all := append([]*Deduper(nil), dedupers...)
+	dedupersMu.Unlock()
+
+	for _, d := range all {
+		d.Flush()
+	}
+}
@@ -0,0 +1,222 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock runs AfterFunc callbacks when Advance passes their deadline.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	f     func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by d and runs the timers that became due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// newTestDeduper returns a Deduper writing text lines without timestamps to
+// the returned buffer.
+func newTestDeduper(name string, clock Clock, opts DedupOptions) (*Deduper, *bytes.Buffer) {
+	var buf bytes.Buffer
+	opts.Clock = clock
+	opts.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	return NewDeduper(name, opts), &buf
+}
+
+func lines(buf *bytes.Buffer) []string {
+	out := strings.TrimSpace(buf.String())
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func TestDeduperByMessage(t *testing.T) {
+	clock := newFakeClock()
+	d, buf := newTestDeduper("cache hits", clock, DedupOptions{Unit: "products", DistinctBy: []string{"store", "id"}})
+	ctx := context.Background()
+
+	for i := range 412 {
+		d.Log(ctx, "Cache hit", "store", "billa", "id", i%37, "took", i)
+		if i%100 == 0 {
+			d.Log(ctx, "Cache revalidated", "store", "billa", "id", i)
+		}
+	}
+
+	got := lines(buf)
+	if len(got) != 2 || !strings.Contains(got[0], `msg="Cache hit" store=billa id=0`) || !strings.Contains(got[1], `msg="Cache revalidated"`) {
+		t.Fatalf("expected the first line of each message, got:\n%s", buf)
+	}
+
+	clock.Advance(59 * time.Second)
+	if len(lines(buf)) != 2 {
+		t.Fatalf("summary written before the window ended:\n%s", buf)
+	}
+
+	clock.Advance(time.Second)
+	got = lines(buf)
+	if len(got) != 4 {
+		t.Fatalf("expected a summary per message, got:\n%s", buf)
+	}
+	if want := `msg="cache hits: 412 across 37 products in last 1m0s" message="Cache hit" suppressed=411`; !strings.Contains(got[2], want) {
+		t.Errorf("got summary %q, want %q", got[2], want)
+	}
+	if want := `msg="cache hits: 5 across 5 products in last 1m0s" message="Cache revalidated" suppressed=4`; !strings.Contains(got[3], want) {
+		t.Errorf("got summary %q, want %q", got[3], want)
+	}
+
+	// The next line opens a new window and is written again.
+	d.Log(ctx, "Cache hit", "store", "spar", "id", 1)
+	if got := lines(buf); len(got) != 5 || !strings.Contains(got[4], "store=spar") {
+		t.Errorf("expected the first line of the new window, got:\n%s", buf)
+	}
+}
+
+func TestDeduperNoSummaryWithoutRepeats(t *testing.T) {
+	clock := newFakeClock()
+	d, buf := newTestDeduper("revalidations", clock, DedupOptions{})
+
+	d.Log(context.Background(), "Cache revalidated", "store", "billa", "id", "1")
+	clock.Advance(time.Minute)
+
+	if got := lines(buf); len(got) != 1 {
+		t.Errorf("expected only the line itself, got:\n%s", buf)
+	}
+}
+
+func TestDeduperLimit(t *testing.T) {
+	clock := newFakeClock()
+	d, buf := newTestDeduper("stale fallbacks", clock, DedupOptions{Window: 10 * time.Second, Limit: 3, Level: slog.LevelWarn})
+
+	for i := range 10 {
+		d.Log(context.Background(), "Scrape failed", "id", i)
+	}
+	if got := lines(buf); len(got) != 3 || !strings.Contains(got[2], "level=WARN") {
+		t.Fatalf("expected 3 lines at the limit, got:\n%s", buf)
+	}
+
+	clock.Advance(10 * time.Second)
+	got := lines(buf)
+	if len(got) != 4 || !strings.Contains(got[3], `"stale fallbacks: 10 across 10 subjects in last 10s" message="Scrape failed" suppressed=7`) {
+		t.Errorf("expected a summary of the held back lines, got:\n%s", buf)
+	}
+}
+
+func TestDeduperIndependentWindows(t *testing.T) {
+	clock := newFakeClock()
+	fast, fastBuf := newTestDeduper("fast", clock, DedupOptions{Window: 10 * time.Second})
+	slow, slowBuf := newTestDeduper("slow", clock, DedupOptions{Window: time.Minute})
+	ctx := context.Background()
+
+	for range 3 {
+		fast.Log(ctx, "Repeated")
+		slow.Log(ctx, "Repeated")
+	}
+
+	clock.Advance(10 * time.Second)
+	if !strings.Contains(fastBuf.String(), "fast: 3 across 1 subjects in last 10s") {
+		t.Errorf("fast window did not end:\n%s", fastBuf)
+	}
+	if strings.Contains(slowBuf.String(), "slow:") {
+		t.Errorf("slow window ended with the fast one:\n%s", slowBuf)
+	}
+
+	clock.Advance(50 * time.Second)
+	if !strings.Contains(slowBuf.String(), "slow: 3 across 1 subjects in last 1m0s") {
+		t.Errorf("slow window did not end:\n%s", slowBuf)
+	}
+}
+
+func TestDeduperFlush(t *testing.T) {
+	clock := newFakeClock()
+	d, buf := newTestDeduper("cache hits", clock, DedupOptions{})
+
+	d.Log(context.Background(), "Cache hit", "id", 1)
+	d.Log(context.Background(), "Cache hit", "id", 2)
+	clock.Advance(12 * time.Second)
+	Flush()
+
+	if !strings.Contains(buf.String(), "cache hits: 2 across 2 subjects in last 12s") {
+		t.Fatalf("Flush did not write the summary:\n%s", buf)
+	}
+
+	// The timer of the flushed window must not end the next one early.
+	d.Log(context.Background(), "Cache hit", "id", 3)
+	d.Log(context.Background(), "Cache hit", "id", 4)
+	clock.Advance(48 * time.Second)
+	if strings.Count(buf.String(), "cache hits:") != 1 {
+		t.Errorf("new window ended early:\n%s", buf)
+	}
+	clock.Advance(12 * time.Second)
+	if !strings.Contains(buf.String(), "cache hits: 2 across 2 subjects in last 1m0s") {
+		t.Errorf("new window did not end after a minute:\n%s", buf)
+	}
+}
@@ -1,62 +1,180 @@
+// Package logger sets up structured logging with log/slog: text or JSON
+// lines on stderr and optionally in a rotating log file, levels per
+// component and request IDs carried through contexts.
+//
+// Packages log through a logger named after them, e.g.
+//
+//	var log = logger.For("scrapers/spar")
+//
+// and pass the request context where they have one, so every line written
+// while serving a request carries its request_id, and its trace_id when the
+// request is traced.
 package logger
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"sync"
-	"time"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
-var dedup = &deduplicator{
-	flushDelay: 2 * time.Second,
+// FileName is the name of the log file in Options.Dir. Rotated files keep
+// this name with a timestamp added.
+const FileName = "hunter-base.log"
+
+// Options configures Setup.
+type Options struct {
+	// Format is FormatText or FormatJSON.
+	Format string
+	// Level is the minimum level logged by components without an override.
+	Level slog.Level
+	// Levels overrides Level per component. An entry also covers the
+	// component's children, so "scrapers" applies to "scrapers/spar".
+	Levels map[string]slog.Level
+	// Dir is a directory for FileName. Empty logs to stderr only.
+	Dir string
+	// MaxSizeMB is the size at which the log file is rotated.
+	MaxSizeMB int
+	// MaxBackups is how many rotated files are kept; 0 keeps all.
+	MaxBackups int
+	// MaxAgeDays is how long rotated files are kept; 0 keeps them forever.
+	MaxAgeDays int
 }
 
-type deduplicator struct {
-	mu         sync.Mutex
-	lastMsg    string
-	count      int
-	flushDelay time.Duration
-	timer      *time.Timer
+// state is the output every component logger writes to. Setup replaces it,
+// so loggers created at package initialization pick up the configuration.
+type state struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
 }
 
-func (d *deduplicator) flush() {
-	if d.count == 0 {
-		return
-	}
-	if d.count == 1 {
-		log.Print(d.lastMsg)
-	} else {
-		log.Printf("%s (%d)", d.lastMsg, d.count)
+var current atomic.Pointer[state]
+
+func init() {
+	current.Store(&state{handler: newHandler(FormatText, os.Stderr), level: slog.LevelInfo})
+}
+
+func newHandler(format string, w io.Writer) slog.Handler {
+	// Levels are filtered per component before records get here.
+	opts := &slog.HandlerOptions{Level: slog.Level(-100)}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
 	}
-	d.count = 0
-	d.lastMsg = ""
+	return slog.NewTextHandler(w, opts)
 }
 
-func Dedup(format string, args ...any) {
-	msg := fmt.Sprintf(format, args...)
+// Setup directs all loggers, the slog default logger and the standard
+// library's log package to the configured output. The returned function
+// closes the log file.
+func Setup(opts Options) (func() error, error) {
+	var out io.Writer = os.Stderr
+	closeFile := func() error { return nil }
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, err
+		}
+		file := &lumberjack.Logger{
+			Filename:   filepath.Join(opts.Dir, FileName),
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+		}
+		out = io.MultiWriter(os.Stderr, file)
+		closeFile = file.Close
+	}
 
-	dedup.mu.Lock()
-	defer dedup.mu.Unlock()
+	use(opts, out)
+	return closeFile, nil
+}
 
-	if msg == dedup.lastMsg {
-		dedup.count++
-		if dedup.timer != nil {
-			dedup.timer.Stop()
+// use makes every logger write to out.
+func use(opts Options, out io.Writer) {
+	current.Store(&state{handler: newHandler(opts.Format, out), level: opts.Level, levels: opts.Levels})
+	slog.SetDefault(For(""))
+}
+
+// levelFor returns the minimum level of component, taken from the most
+// specific override.
+func (s *state) levelFor(component string) slog.Level {
+	level, matched := s.level, -1
+	for name, l := range s.levels {
+		if (component == name || strings.HasPrefix(component, name+"/")) && len(name) > matched {
+			level, matched = l, len(name)
 		}
-		dedup.timer = time.AfterFunc(dedup.flushDelay, func() {
-			dedup.mu.Lock()
-			defer dedup.mu.Unlock()
-			dedup.flush()
-		})
-		return
-	}
-
-	dedup.flush()
-	dedup.lastMsg = msg
-	dedup.count = 1
-	dedup.timer = time.AfterFunc(dedup.flushDelay, func() {
-		dedup.mu.Lock()
-		defer dedup.mu.Unlock()
-		dedup.flush()
-	})
+	}
+	return level
+}
+
+// For returns the logger of component, such as "cache" or "scrapers/spar".
+// Its lines carry a component attribute unless component is empty.
+func For(component string) *slog.Logger {
+	return slog.New(&handler{component: component})
+}
+
+// handler resolves the current output on every record and adds the
+// component, and the request ID and trace ID of the record's context.
+type handler struct {
+	component string
+	// with replays WithAttrs and WithGroup calls on the current output.
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.Load().levelFor(h.component)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	out := current.Load().handler
+	var attrs []slog.Attr
+	if h.component != "" {
+		attrs = append(attrs, slog.String("component", h.component))
+	}
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsSampled() {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+	}
+	if len(attrs) > 0 {
+		out = out.WithAttrs(attrs)
+	}
+	for _, with := range h.with {
+		out = with(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.extend(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.extend(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
+
+func (h *handler) extend(with func(slog.Handler) slog.Handler) *handler {
+	return &handler{component: h.component, with: append(h.with[:len(h.with):len(h.with)], with)}
+}
+
+// ParseLevel parses a level name such as "debug", "info", "warn" or "error".
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
 }
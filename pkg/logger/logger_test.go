@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// capture directs all loggers to a buffer for the duration of the test.
+func capture(t *testing.T, opts Options) *bytes.Buffer {
+	t.Helper()
+	previous := current.Load()
+	previousDefault := slog.Default()
+	t.Cleanup(func() {
+		current.Store(previous)
+		slog.SetDefault(previousDefault)
+	})
+
+	var buf bytes.Buffer
+	use(opts, &buf)
+	return &buf
+}
+
+func TestComponentLevels(t *testing.T) {
+	buf := capture(t, Options{
+		Format: FormatText,
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{"scrapers": slog.LevelDebug, "scrapers/spar": slog.LevelWarn},
+	})
+
+	For("cache").Debug("cache debug")
+	For("cache").Info("cache info")
+	For("scrapers/billa").Debug("billa debug")
+	For("scrapers/spar").Info("spar info")
+	For("scrapers/spar").Warn("spar warn")
+	For("scrapersextra").Debug("other debug")
+
+	out := buf.String()
+	for _, want := range []string{"cache info", "billa debug", "spar warn"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"cache debug", "spar info", "other debug"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, out)
+		}
+	}
+	if !strings.Contains(out, "component=scrapers/spar") {
+		t.Errorf("missing component attribute in:\n%s", out)
+	}
+}
+
+func TestJSONWithRequestID(t *testing.T) {
+	buf := capture(t, Options{Format: FormatJSON, Level: slog.LevelInfo})
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	For("main").With("store", "billa").WithGroup("product").InfoContext(ctx, "Scraped", "id", "42")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if line["request_id"] != "abc123" || line["component"] != "main" || line["store"] != "billa" || line["msg"] != "Scraped" {
+		t.Errorf("unexpected line: %v", line)
+	}
+	if product, _ := line["product"].(map[string]any); product["id"] != "42" {
+		t.Errorf("group attribute missing: %v", line)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("warn"); err != nil || level != slog.LevelWarn {
+		t.Errorf("ParseLevel(warn) = %v, %v", level, err)
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
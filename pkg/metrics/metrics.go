@@ -0,0 +1,152 @@
+// Package metrics defines the Prometheus metrics served on GET /metrics.
+//
+// Metrics are registered with the default registry, which also carries the
+// Go runtime and process collectors.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hunter"
+
+// ResultOK labels successful scrapes and revalidations. Failures are labelled
+// with their error class, e.g. "timeout" or "cloudflare".
+const ResultOK = "ok"
+
+// scrapeBuckets span fast HTTP fetches to browser scrapes close to their
+// timeout.
+var scrapeBuckets = []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120}
+
+var (
+	// ScrapeDuration is the duration of single scrape attempts; retries are
+	// observed separately.
+	ScrapeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_duration_seconds",
+		Help:      "Duration of scrape attempts by store and result.",
+		Buckets:   scrapeBuckets,
+	}, []string{"store", "result"})
+
+	// Scrapes counts scrape attempts, plus scrapes rejected by an open
+	// circuit breaker as result "circuit_open".
+	Scrapes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrapes_total",
+		Help:      "Scrape attempts by store and result (ok or error class).",
+	}, []string{"store", "result"})
+
+	// CacheRequests counts product lookups by the cache status they were
+	// answered with.
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Product lookups by store and cache status (hit, miss, stale, revalidated, negative-hit).",
+	}, []string{"store", "status"})
+
+	// Revalidations counts background refreshes of cached products.
+	Revalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "revalidations_total",
+		Help:      "Background revalidations by store and result (ok, failed, cancelled).",
+	}, []string{"store", "result"})
+
+	// ScraperSlots is the size of the scraper semaphore.
+	ScraperSlots = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scraper_slots",
+		Help:      "Number of scrapes that may run at once.",
+	})
+
+	// ScraperSlotsBusy is the number of taken scraper slots.
+	ScraperSlotsBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scraper_slots_busy",
+		Help:      "Number of scraper slots currently taken.",
+	})
+
+	// ScraperWait is how long requests and revalidations waited for a
+	// scraper slot.
+	ScraperWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scraper_wait_seconds",
+		Help:      "Time spent waiting for a scraper slot.",
+		Buckets:   []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 120},
+	})
+
+	// WarmupQueued is the number of products waiting in the warmup queue.
+	WarmupQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "warmup_queue_depth",
+		Help:      "Products waiting in the cache warmup queue.",
+	})
+
+	// BrowsersRunning is the number of live Chrome instances.
+	BrowsersRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "browsers_running",
+		Help:      "Chrome instances currently running.",
+	})
+
+	// CloudflarePolls counts polls of a page showing a Cloudflare challenge.
+	CloudflarePolls = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cloudflare_polls_total",
+		Help:      "Polls while waiting for a Cloudflare challenge to resolve.",
+	})
+
+	// CloudflareChallenges counts Cloudflare challenges by whether they
+	// resolved before the browser timed out.
+	CloudflareChallenges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cloudflare_challenges_total",
+		Help:      "Cloudflare challenges by result (resolved, unresolved).",
+	}, []string{"result"})
+
+	// Panics counts panics recovered in handlers, scrapes and background
+	// work. Store is "none" when the work is not tied to a store.
+	Panics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "panics_total",
+		Help:      "Recovered panics by store and where they happened (handler, scrape, background).",
+	}, []string{"store", "where"})
+
+	// AuthRejections counts requests refused by API key auth.
+	AuthRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_rejections_total",
+		Help:      "Requests refused by API key auth by reason (missing, invalid, scope, rate_limit, quota).",
+	}, []string{"reason"})
+
+	// HTTPRequests counts API requests by route template, not raw path, to
+	// keep product IDs out of the label values.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration is the duration of API requests by route template.
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by method and route.",
+		Buckets:   []float64{0.005, 0.025, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method", "route"})
+)
+
+// ObserveScrape records a scrape attempt that took d.
+func ObserveScrape(store, result string, d time.Duration) {
+	Scrapes.WithLabelValues(store, result).Inc()
+	ScrapeDuration.WithLabelValues(store, result).Observe(d.Seconds())
+}
+
+// Handler serves the default registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -13,20 +13,27 @@ type Variant struct {
 }
 
 type Product struct {
-	Source            string    `json:"source"`
-	ID                string    `json:"id"`
-	Name              string    `json:"name"`
-	Price             float64   `json:"price"`
-	OldPrice          float64   `json:"old_price,omitempty"`
-	Currency          string    `json:"currency"`
-	URL               string    `json:"url"`
-	ScrapedAt         time.Time `json:"scraped_at"`
-	IsAvailable       bool      `json:"is_available"`
-	IsDiscounted      bool      `json:"is_discounted"`
-	DiscountLabel     string    `json:"discount_label,omitempty"`
-	AvailabilityLabel string    `json:"availability_label,omitempty"`
-	PriceDetails      string    `json:"price_details,omitempty"`
-	Rating            float64   `json:"rating,omitempty"`
-	ReviewCount       int       `json:"review_count,omitempty"`
-	Variants          []Variant `json:"variants,omitempty"`
+	Source            string     `json:"source"`
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Brand             string     `json:"brand,omitempty"`
+	GTIN13            string     `json:"gtin13,omitempty"`
+	Price             float64    `json:"price"`
+	OldPrice          float64    `json:"old_price,omitempty"`
+	Currency          string     `json:"currency"`
+	URL               string     `json:"url"`
+	ScrapedAt         time.Time  `json:"scraped_at"`
+	Strategy          string     `json:"strategy,omitempty"`
+	CacheStatus       string     `json:"cache_status,omitempty"`
+	AgeSeconds        int64      `json:"age_seconds,omitempty"`
+	StaleReason       string     `json:"stale_reason,omitempty"`
+	IsAvailable       bool       `json:"is_available"`
+	IsDiscounted      bool       `json:"is_discounted"`
+	DiscountLabel     string     `json:"discount_label,omitempty"`
+	AvailabilityLabel string     `json:"availability_label,omitempty"`
+	PriceDetails      string     `json:"price_details,omitempty"`
+	PriceValidUntil   *time.Time `json:"price_valid_until,omitempty"`
+	Rating            float64    `json:"rating,omitempty"`
+	ReviewCount       int        `json:"review_count,omitempty"`
+	Variants          []Variant  `json:"variants,omitempty"`
 }
@@ -0,0 +1,344 @@
+package politeness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+	"hunter-base/pkg/logger"
+	"hunter-base/pkg/tracing"
+)
+
+var log = logger.For("politeness")
+
+// ErrDisallowed is returned by Wait when robots.txt forbids the URL.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// RobotsAgent is the user agent matched against robots.txt groups.
+const RobotsAgent = "hunter-base"
+
+const robotsTTL = 24 * time.Hour
+
+// Config controls pacing per domain.
+type Config struct {
+	// MinInterval is the minimum gap between two requests to the same domain.
+	MinInterval time.Duration
+	// MaxPerMinute caps requests per domain in any sliding minute. Zero disables the cap.
+	MaxPerMinute int
+	// Jitter adds a random delay of up to this duration to every interval.
+	Jitter time.Duration
+	// RespectRobots enables robots.txt checks, including Crawl-delay.
+	RespectRobots bool
+	// BackoffBase is the first pause after a domain throttles us; it doubles
+	// on every further throttle up to BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// DefaultConfig returns conservative settings suitable for a single home server.
+func DefaultConfig() Config {
+	return Config{
+		MinInterval:  2 * time.Second,
+		MaxPerMinute: 20,
+		Jitter:       time.Second,
+		BackoffBase:  30 * time.Second,
+		BackoffMax:   10 * time.Minute,
+	}
+}
+
+type hostState struct {
+	next         time.Time
+	window       []time.Time
+	backoff      time.Duration
+	blockedUntil time.Time
+}
+
+type robotsEntry struct {
+	group     *robotstxt.Group
+	fetchedAt time.Time
+}
+
+// Limiter paces requests per domain. It is safe for concurrent use and
+// shared by every scraper so interactive, batch and background work all
+// draw from the same budget.
+type Limiter struct {
+	cfg Config
+
+	mu     sync.Mutex
+	hosts  map[string]*hostState
+	robots map[string]*robotsEntry
+
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	client *http.Client
+}
+
+// New creates a Limiter with cfg.
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:    cfg,
+		hosts:  make(map[string]*hostState),
+		robots: make(map[string]*robotsEntry),
+		now:    time.Now,
+		sleep:  sleepContext,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+var (
+	defaultMu      sync.RWMutex
+	defaultLimiter = New(DefaultConfig())
+)
+
+// Configure replaces the shared limiter.
+func Configure(cfg Config) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLimiter = New(cfg)
+}
+
+// Default returns the shared limiter.
+func Default() *Limiter {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLimiter
+}
+
+// Wait blocks until a request to rawURL may be sent using the shared limiter.
+func Wait(ctx context.Context, rawURL string) error {
+	ctx, span := tracing.Start(ctx, "politeness.wait", tracing.URL(rawURL))
+	err := Default().Wait(ctx, rawURL)
+	tracing.End(span, err)
+	return err
+}
+
+// ReportThrottled records a 429 or challenge page on the shared limiter.
+func ReportThrottled(rawURL string, retryAfter time.Duration) {
+	Default().ReportThrottled(rawURL, retryAfter)
+}
+
+// ReportOK records a successful response on the shared limiter.
+func ReportOK(rawURL string) {
+	Default().ReportOK(rawURL)
+}
+
+// Wait blocks until a request to rawURL may be sent. It returns
+// ErrDisallowed when robots.txt checks are enabled and forbid the path, or
+// the context error if ctx ends first.
+func (l *Limiter) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	crawlDelay := time.Duration(0)
+	if l.cfg.RespectRobots {
+		group := l.robotsGroup(ctx, u)
+		if group != nil {
+			if !group.Test(u.RequestURI()) {
+				return fmt.Errorf("%w: %s", ErrDisallowed, rawURL)
+			}
+			crawlDelay = group.CrawlDelay
+		}
+	}
+
+	delay := l.reserve(hostKey(u), crawlDelay)
+	if delay <= 0 {
+		return nil
+	}
+	if delay > time.Second {
+		log.InfoContext(ctx, "Waiting before request", "host", u.Host, "delay", delay.Round(100*time.Millisecond))
+	}
+	return l.sleep(ctx, delay)
+}
+
+// reserve books the next free slot for host and returns how long the caller
+// has to wait for it.
+func (l *Limiter) reserve(host string, crawlDelay time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	st := l.state(host)
+
+	start := now
+	if st.next.After(start) {
+		start = st.next
+	}
+	if st.blockedUntil.After(start) {
+		start = st.blockedUntil
+	}
+
+	if l.cfg.MaxPerMinute > 0 {
+		cutoff := start.Add(-time.Minute)
+		kept := st.window[:0]
+		for _, t := range st.window {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		st.window = kept
+		if len(st.window) >= l.cfg.MaxPerMinute {
+			if earliest := st.window[len(st.window)-l.cfg.MaxPerMinute].Add(time.Minute); earliest.After(start) {
+				start = earliest
+			}
+		}
+		st.window = append(st.window, start)
+	}
+
+	interval := l.cfg.MinInterval
+	if crawlDelay > interval {
+		interval = crawlDelay
+	}
+	if l.cfg.Jitter > 0 {
+		interval += rand.N(l.cfg.Jitter)
+	}
+	st.next = start.Add(interval)
+
+	return start.Sub(now)
+}
+
+// ReportThrottled backs off from the domain of rawURL after it answered with
+// 429, 503 or a bot challenge. A Retry-After longer than the current backoff
+// takes precedence.
+func (l *Limiter) ReportThrottled(rawURL string, retryAfter time.Duration) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st := l.state(hostKey(u))
+	switch {
+	case st.backoff == 0:
+		st.backoff = l.cfg.BackoffBase
+	default:
+		st.backoff *= 2
+	}
+	if l.cfg.BackoffMax > 0 && st.backoff > l.cfg.BackoffMax {
+		st.backoff = l.cfg.BackoffMax
+	}
+
+	pause := st.backoff
+	if retryAfter > pause {
+		pause = retryAfter
+	}
+	st.blockedUntil = l.now().Add(pause)
+	log.Warn("Host is throttling, backing off", "host", u.Host, "pause", pause)
+}
+
+// ReportOK halves the backoff of the domain of rawURL after a normal response.
+func (l *Limiter) ReportOK(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st := l.state(hostKey(u))
+	if st.backoff == 0 {
+		return
+	}
+	st.backoff /= 2
+	if st.backoff < l.cfg.BackoffBase {
+		st.backoff = 0
+	}
+}
+
+// Backoff returns the current backoff for host, mainly for diagnostics.
+func (l *Limiter) Backoff(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if st, ok := l.hosts[strings.ToLower(host)]; ok {
+		return st.backoff
+	}
+	return 0
+}
+
+func (l *Limiter) state(host string) *hostState {
+	st, ok := l.hosts[host]
+	if !ok {
+		st = &hostState{}
+		l.hosts[host] = st
+	}
+	return st
+}
+
+// robotsGroup returns the robots.txt group that applies to us on u's host,
+// fetching and caching the file as needed. Unreachable or broken robots.txt
+// files allow everything.
+func (l *Limiter) robotsGroup(ctx context.Context, u *url.URL) *robotstxt.Group {
+	key := u.Scheme + "://" + u.Host
+
+	l.mu.Lock()
+	entry, ok := l.robots[key]
+	l.mu.Unlock()
+	if ok && l.now().Sub(entry.fetchedAt) < robotsTTL {
+		return entry.group
+	}
+
+	entry = &robotsEntry{fetchedAt: l.now()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key+"/robots.txt", nil)
+	if err == nil {
+		req.Header.Set("User-Agent", RobotsAgent)
+		resp, err := l.client.Do(req)
+		if err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512<<10))
+			resp.Body.Close()
+			if data, err := robotstxt.FromStatusAndBytes(resp.StatusCode, body); err == nil {
+				entry.group = data.FindGroup(RobotsAgent)
+			}
+		} else {
+			log.Warn("Failed to fetch robots.txt", "host", u.Host, "error", err)
+		}
+	}
+
+	l.mu.Lock()
+	l.robots[key] = entry
+	l.mu.Unlock()
+	return entry.group
+}
+
+func hostKey(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// ParseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var secs int
+	if _, err := fmt.Sscanf(value, "%d", &secs); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package politeness
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock advances instead of sleeping so tests run instantly.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func newTestLimiter(cfg Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(cfg)
+	l.now = clock.Now
+	l.sleep = clock.Sleep
+	return l, clock
+}
+
+func TestWaitEnforcesMinInterval(t *testing.T) {
+	l, clock := newTestLimiter(Config{MinInterval: 2 * time.Second})
+	start := clock.now
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), "https://shop.billa.at/produkte/1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := clock.now.Sub(start); elapsed != 4*time.Second {
+		t.Errorf("expected 4s for three requests, got %s", elapsed)
+	}
+
+	// Other domains have their own budget.
+	before := clock.now
+	if err := l.Wait(context.Background(), "https://www.lidl.at/p/1"); err != nil {
+		t.Fatal(err)
+	}
+	if clock.now != before {
+		t.Errorf("unrelated domain should not wait, waited %s", clock.now.Sub(before))
+	}
+}
+
+func TestWaitEnforcesMaxPerMinute(t *testing.T) {
+	l, clock := newTestLimiter(Config{MaxPerMinute: 3})
+	start := clock.now
+
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(context.Background(), "https://www.spar.at/p1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := clock.now.Sub(start); elapsed != time.Minute {
+		t.Errorf("fourth request should wait for the window, waited %s", elapsed)
+	}
+}
+
+func TestBackoffAfterThrottling(t *testing.T) {
+	l, clock := newTestLimiter(Config{BackoffBase: 30 * time.Second, BackoffMax: time.Minute})
+
+	l.ReportThrottled("https://www.hofer.at/de/p.1.html", 0)
+	l.ReportThrottled("https://www.hofer.at/de/p.1.html", 0)
+	l.ReportThrottled("https://www.hofer.at/de/p.1.html", 0)
+	if b := l.Backoff("www.hofer.at"); b != time.Minute {
+		t.Errorf("backoff should double up to the max, got %s", b)
+	}
+
+	start := clock.now
+	if err := l.Wait(context.Background(), "https://www.hofer.at/de/p.2.html"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := clock.now.Sub(start); elapsed != time.Minute {
+		t.Errorf("expected to wait out the backoff, waited %s", elapsed)
+	}
+
+	l.ReportThrottled("https://www.hofer.at/", 5*time.Minute)
+	if until := l.hosts["www.hofer.at"].blockedUntil.Sub(clock.now); until != 5*time.Minute {
+		t.Errorf("Retry-After should win over a shorter backoff, got %s", until)
+	}
+
+	l.ReportOK("https://www.hofer.at/")
+	l.ReportOK("https://www.hofer.at/")
+	if b := l.Backoff("www.hofer.at"); b != 0 {
+		t.Errorf("backoff should decay after successes, got %s", b)
+	}
+}
+
+func TestRobotsTxt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /checkout\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	l, _ := newTestLimiter(Config{RespectRobots: true})
+
+	if err := l.Wait(context.Background(), srv.URL+"/p/123"); err != nil {
+		t.Errorf("allowed path returned %v", err)
+	}
+	if err := l.Wait(context.Background(), srv.URL+"/checkout/cart"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("expected ErrDisallowed, got %v", err)
+	}
+}
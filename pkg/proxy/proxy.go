@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"hunter-base/pkg/logger"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logger.For("proxy")
+
+// Rotation selects how a Pool hands out proxies.
+type Rotation string
+
+const (
+	// RoundRobin cycles through the healthy proxies on every request.
+	RoundRobin Rotation = "round-robin"
+	// Sticky always routes the same product through the same proxy.
+	Sticky Rotation = "sticky"
+	// Failover keeps using the first healthy proxy until it gets blocked.
+	Failover Rotation = "failover"
+)
+
+const (
+	// maxConsecutiveFailures marks a proxy unhealthy after this many errors in a row.
+	maxConsecutiveFailures = 3
+	defaultCooldown        = 5 * time.Minute
+)
+
+// Proxy is a single outbound HTTP or SOCKS5 proxy with its health record.
+type Proxy struct {
+	URL *url.URL
+
+	mu                  sync.Mutex
+	successes           int
+	failures            int
+	blocks              int
+	consecutiveFailures int
+	lastError           string
+	disabledUntil       time.Time
+	transport           *http.Transport
+	transportTimeout    time.Duration
+}
+
+// Parse validates a proxy URL. Supported schemes are http, https and socks5.
+func Parse(raw string) (*Proxy, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %q", raw, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", raw)
+	}
+	return &Proxy{URL: u}, nil
+}
+
+// String returns the proxy URL with any password redacted.
+func (p *Proxy) String() string {
+	return p.URL.Redacted()
+}
+
+// ServerFlag returns the value for Chrome's --proxy-server flag. Chrome does
+// not accept credentials there, so user info is dropped; the browser has to
+// answer the proxy's authentication challenge itself.
+func (p *Proxy) ServerFlag() string {
+	scheme := p.URL.Scheme
+	if scheme == "socks5h" {
+		scheme = "socks5"
+	}
+	return scheme + "://" + p.URL.Host
+}
+
+// ProxyFunc returns a function usable as http.Transport.Proxy.
+func (p *Proxy) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	return http.ProxyURL(p.URL)
+}
+
+// Transport returns a shared transport dialing through this proxy that waits
+// at most timeout for response headers. It is rebuilt when the timeout
+// changes, e.g. after a configuration reload.
+func (p *Proxy) Transport(timeout time.Duration) *http.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.transport == nil || p.transportTimeout != timeout {
+		if p.transport != nil {
+			p.transport.CloseIdleConnections()
+		}
+		p.transport = &http.Transport{
+			Proxy:                 p.ProxyFunc(),
+			ResponseHeaderTimeout: timeout,
+			IdleConnTimeout:       90 * time.Second,
+		}
+		p.transportTimeout = timeout
+	}
+	return p.transport
+}
+
+// Healthy reports whether the proxy is currently usable.
+func (p *Proxy) Healthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().After(p.disabledUntil)
+}
+
+// Status is a snapshot of a proxy's health.
+type Status struct {
+	URL           string    `json:"url"`
+	Healthy       bool      `json:"healthy"`
+	Successes     int       `json:"successes"`
+	Failures      int       `json:"failures"`
+	Blocks        int       `json:"blocks"`
+	LastError     string    `json:"last_error,omitempty"`
+	DisabledUntil time.Time `json:"disabled_until,omitzero"`
+}
+
+func (p *Proxy) status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := Status{
+		URL:       p.URL.Redacted(),
+		Healthy:   time.Now().After(p.disabledUntil),
+		Successes: p.successes,
+		Failures:  p.failures,
+		Blocks:    p.blocks,
+		LastError: p.lastError,
+	}
+	if !s.Healthy {
+		s.DisabledUntil = p.disabledUntil
+	}
+	return s
+}
+
+// Pool rotates requests for one store across a set of proxies.
+type Pool struct {
+	Rotation Rotation
+	Cooldown time.Duration
+
+	mu      sync.Mutex
+	proxies []*Proxy
+	next    int
+}
+
+// NewPool builds a pool from proxy URLs. An empty list yields a nil pool,
+// which callers treat as a direct connection.
+func NewPool(urls []string, rotation Rotation) (*Pool, error) {
+	var proxies []*Proxy
+	for _, raw := range urls {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		px, err := Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, px)
+	}
+	if len(proxies) == 0 {
+		return nil, nil
+	}
+
+	switch rotation {
+	case "":
+		rotation = RoundRobin
+	case RoundRobin, Sticky, Failover:
+	default:
+		return nil, fmt.Errorf("unknown proxy rotation %q (use round-robin, sticky or failover)", rotation)
+	}
+
+	return &Pool{
+		Rotation: rotation,
+		Cooldown: defaultCooldown,
+		proxies:  proxies,
+	}, nil
+}
+
+// Len returns the number of proxies in the pool.
+func (p *Pool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.proxies)
+}
+
+// Pick returns the proxy to use for key (usually the product ID), skipping
+// unhealthy ones. When every proxy is unhealthy the one that recovers first is
+// returned rather than failing outright. A nil pool returns nil.
+func (p *Pool) Pick(key string) *Proxy {
+	if p == nil || len(p.proxies) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.proxies)
+	start := 0
+	switch p.Rotation {
+	case RoundRobin:
+		start = p.next % n
+		p.next = (p.next + 1) % n
+	case Sticky:
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		start = int(h.Sum32() % uint32(n))
+	case Failover:
+		start = 0
+	}
+
+	for i := 0; i < n; i++ {
+		px := p.proxies[(start+i)%n]
+		if px.Healthy() {
+			return px
+		}
+	}
+
+	best := p.proxies[start]
+	for _, px := range p.proxies {
+		if px.status().DisabledUntil.Before(best.status().DisabledUntil) {
+			best = px
+		}
+	}
+	return best
+}
+
+// ReportSuccess records a successful request through px.
+func (p *Pool) ReportSuccess(px *Proxy) {
+	if p == nil || px == nil {
+		return
+	}
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	px.successes++
+	px.consecutiveFailures = 0
+}
+
+// ReportFailure records a failed request through px. A block takes the proxy
+// out of rotation immediately; other errors only after several in a row.
+func (p *Pool) ReportFailure(px *Proxy, err error, blocked bool) {
+	if p == nil || px == nil {
+		return
+	}
+	px.mu.Lock()
+	defer px.mu.Unlock()
+
+	px.failures++
+	px.consecutiveFailures++
+	if err != nil {
+		px.lastError = err.Error()
+	}
+	if blocked {
+		px.blocks++
+	}
+
+	if blocked || px.consecutiveFailures >= maxConsecutiveFailures {
+		px.disabledUntil = time.Now().Add(p.Cooldown)
+		log.Warn("Proxy disabled", "proxy", px.URL.Redacted(), "until", px.disabledUntil.Format(time.TimeOnly), "error", err)
+	}
+}
+
+// Status returns the health of every proxy in the pool.
+func (p *Pool) Status() []Status {
+	if p == nil {
+		return nil
+	}
+	statuses := make([]Status, 0, len(p.proxies))
+	for _, px := range p.proxies {
+		statuses = append(statuses, px.status())
+	}
+	return statuses
+}
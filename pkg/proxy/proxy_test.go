@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolRotation(t *testing.T) {
+	urls := []string{"http://a:8080", "socks5://b:1080", "http://c:3128"}
+
+	rr, err := NewPool(urls, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		seen[rr.Pick("1").URL.Host] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("round-robin should visit every proxy, got %v", seen)
+	}
+
+	sticky, _ := NewPool(urls, Sticky)
+	first := sticky.Pick("4006040048400")
+	for i := 0; i < 5; i++ {
+		if px := sticky.Pick("4006040048400"); px != first {
+			t.Errorf("sticky rotation changed proxy: %s -> %s", first, px)
+		}
+	}
+
+	failover, _ := NewPool(urls, Failover)
+	primary := failover.Pick("1")
+	if primary.URL.Host != "a:8080" {
+		t.Fatalf("failover should start with the first proxy, got %s", primary)
+	}
+	failover.ReportFailure(primary, errors.New("403 Forbidden"), true)
+	if px := failover.Pick("1"); px.URL.Host != "b:1080" {
+		t.Errorf("failover should move on after a block, got %s", px)
+	}
+}
+
+func TestPoolHealth(t *testing.T) {
+	pool, _ := NewPool([]string{"http://a:8080"}, RoundRobin)
+	px := pool.Pick("1")
+
+	for i := 0; i < maxConsecutiveFailures-1; i++ {
+		pool.ReportFailure(px, errors.New("timeout"), false)
+	}
+	if !px.Healthy() {
+		t.Fatal("proxy should stay healthy below the failure threshold")
+	}
+	pool.ReportSuccess(px)
+	pool.ReportFailure(px, errors.New("timeout"), false)
+	if !px.Healthy() {
+		t.Fatal("a success should reset consecutive failures")
+	}
+
+	pool.ReportFailure(px, errors.New("timeout"), false)
+	pool.ReportFailure(px, errors.New("timeout"), false)
+	if px.Healthy() {
+		t.Fatal("proxy should be disabled after consecutive failures")
+	}
+
+	if got := pool.Pick("1"); got != px {
+		t.Error("an exhausted pool should still return a proxy")
+	}
+
+	status := pool.Status()
+	if len(status) != 1 || status[0].Healthy || status[0].Failures != 5 || status[0].Successes != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestNewPool(t *testing.T) {
+	if pool, err := NewPool([]string{""}, ""); err != nil || pool != nil {
+		t.Errorf("empty list should give a nil pool, got %v, %v", pool, err)
+	}
+	if _, err := NewPool([]string{"ftp://a:21"}, ""); err == nil {
+		t.Error("expected unsupported scheme error")
+	}
+	if _, err := NewPool([]string{"http://a:8080"}, "random"); err == nil {
+		t.Error("expected unknown rotation error")
+	}
+
+	px, err := Parse("socks5h://user:secret@b:1080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if px.ServerFlag() != "socks5://b:1080" {
+		t.Errorf("unexpected chrome flag %q", px.ServerFlag())
+	}
+	if px.String() != "socks5h://user:xxxxx@b:1080" {
+		t.Errorf("password not redacted: %q", px.String())
+	}
+
+	transport := px.Transport(5 * time.Second)
+	if transport.ResponseHeaderTimeout != 5*time.Second || px.Transport(5*time.Second) != transport {
+		t.Error("expected the transport to be shared and use the given timeout")
+	}
+	if px.Transport(10*time.Second).ResponseHeaderTimeout != 10*time.Second {
+		t.Error("expected a new transport when the timeout changes")
+	}
+}
@@ -0,0 +1,143 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while a store's breaker rejects scrapes.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// State is the state of a Breaker.
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half-open"
+)
+
+// Breaker stops scraping a store after repeated failures. Once OpenFor has
+// passed, a single probe scrape is let through; its outcome closes the
+// breaker again or re-opens it.
+type Breaker struct {
+	Name      string
+	Threshold int
+	OpenFor   time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewBreaker creates a closed breaker that opens after threshold consecutive
+// failures and stays open for openFor.
+func NewBreaker(name string, threshold int, openFor time.Duration) *Breaker {
+	return &Breaker{
+		Name:      name,
+		Threshold: threshold,
+		OpenFor:   openFor,
+		state:     StateClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a scrape may start. In the half-open state only the
+// first caller is admitted as the probe.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.OpenFor {
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		log.Info("Circuit breaker half-open, sending probe scrape", "breaker", b.Name)
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Record feeds the outcome of an admitted scrape back into the breaker.
+// Missing products count as success since the store answered.
+func (b *Breaker) Record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := err != nil && Classify(err) != ClassNotFound
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+			return
+		}
+		log.Info("Circuit breaker closed after successful probe", "breaker", b.Name)
+		b.state = StateClosed
+		b.failures = 0
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.Threshold {
+		b.trip()
+	}
+}
+
+func (b *Breaker) trip() {
+	b.state = StateOpen
+	b.openedAt = b.now()
+	log.Warn("Circuit breaker opened", "breaker", b.Name, "failures", b.failures, "retry_in", b.OpenFor)
+}
+
+// State returns the current state without transitioning it.
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter returns how long until an open breaker admits a probe.
+func (b *Breaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return 0
+	}
+	if remaining := b.OpenFor - b.now().Sub(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Class
+	}{
+		{models.ErrProductNotFound, ClassNotFound},
+		{fmt.Errorf("chromedp failed: %w", context.DeadlineExceeded), ClassTimeout},
+		{fmt.Errorf("chromedp execution failed: %w", context.Canceled), ClassCanceled},
+		{errors.New("cloudflare challenge did not resolve after 12 polls"), ClassCloudflare},
+		{errors.New("request blocked by store: 429"), ClassBlocked},
+		{errors.New("failed to create undetected browser: exec: chrome not found"), ClassBrowser},
+		{errors.New("unexpected EOF"), ClassOther},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	sleep = func(context.Context, time.Duration) error { return nil }
+	defer func() { sleep = sleepContext }()
+
+	policies := Policies{
+		ClassTimeout:  {MaxAttempts: 3, BaseDelay: time.Second},
+		ClassNotFound: {MaxAttempts: 1},
+	}
+
+	calls := 0
+	got, err := Retry(context.Background(), policies, "test", func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, context.DeadlineExceeded
+		}
+		return 42, nil
+	})
+	if err != nil || got != 42 || calls != 3 {
+		t.Errorf("expected success on third attempt, got %d, %v after %d calls", got, err, calls)
+	}
+
+	calls = 0
+	_, err = Retry(context.Background(), policies, "test", func() (int, error) {
+		calls++
+		return 0, models.ErrProductNotFound
+	})
+	if !errors.Is(err, models.ErrProductNotFound) || calls != 1 {
+		t.Errorf("not found should not be retried, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryCancelledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policies := Policies{ClassTimeout: {MaxAttempts: 3, BaseDelay: time.Minute}}
+
+	calls := 0
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := Retry(ctx, policies, "test", func() (int, error) {
+		calls++
+		return 0, context.DeadlineExceeded
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected cancellation after one attempt, got %v after %d calls", err, calls)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("backoff was not interrupted, took %v", elapsed)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBreaker("spar", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	failure := errors.New("chrome crashed")
+
+	b.Record(failure)
+	b.Record(models.ErrProductNotFound)
+	b.Record(failure)
+	if b.State() != StateClosed {
+		t.Fatal("not found should reset the failure count")
+	}
+
+	b.Record(failure)
+	if b.State() != StateOpen {
+		t.Fatal("breaker should open after consecutive failures")
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker should fail fast, got %v", err)
+	}
+	if b.RetryAfter() != time.Minute {
+		t.Errorf("unexpected retry after %s", b.RetryAfter())
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe should be admitted, got %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("only one probe should be admitted while half-open")
+	}
+	b.Record(failure)
+	if b.State() != StateOpen {
+		t.Fatal("failed probe should re-open the breaker")
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(nil)
+	if b.State() != StateClosed || b.Allow() != nil {
+		t.Fatal("successful probe should close the breaker")
+	}
+}
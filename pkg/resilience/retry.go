@@ -0,0 +1,137 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"hunter-base/pkg/logger"
+	"hunter-base/pkg/models"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+var log = logger.For("resilience")
+
+// Class groups scrape errors by how they should be retried.
+type Class string
+
+const (
+	ClassNotFound   Class = "not_found"
+	ClassTimeout    Class = "timeout"
+	ClassCloudflare Class = "cloudflare"
+	ClassBlocked    Class = "blocked"
+	ClassBrowser    Class = "browser"
+	ClassOther      Class = "other"
+	// ClassCanceled is a scrape cancelled on shutdown. It has no policy, so
+	// it is never retried.
+	ClassCanceled Class = "canceled"
+)
+
+// Classes lists every retryable error class, e.g. for configuration.
+var Classes = []Class{ClassNotFound, ClassTimeout, ClassCloudflare, ClassBlocked, ClassBrowser, ClassOther}
+
+// Classify maps a scrape error onto its class.
+func Classify(err error) Class {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, models.ErrProductNotFound) {
+		return ClassNotFound
+	}
+	if errors.Is(err, context.Canceled) {
+		return ClassCanceled
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "product not found"):
+		return ClassNotFound
+	case strings.Contains(msg, "cloudflare"):
+		return ClassCloudflare
+	case strings.Contains(msg, "blocked"), strings.Contains(msg, "forbidden"), strings.Contains(msg, "too many requests"), strings.Contains(msg, "robots.txt"):
+		return ClassBlocked
+	case errors.Is(err, context.DeadlineExceeded), strings.Contains(msg, "deadline exceeded"), strings.Contains(msg, "timeout"), strings.Contains(msg, "timed out"):
+		return ClassTimeout
+	case strings.Contains(msg, "chrome"), strings.Contains(msg, "browser"), strings.Contains(msg, "websocket"), strings.Contains(msg, "target closed"), strings.Contains(msg, "context canceled"):
+		return ClassBrowser
+	}
+	return ClassOther
+}
+
+// Policy describes how often and how fast one error class is retried.
+type Policy struct {
+	// MaxAttempts includes the first try; 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// backoff returns the delay before the given retry (1-based) with full
+// jitter on top of exponential growth.
+func (p Policy) backoff(retry int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	d := p.BaseDelay << (retry - 1)
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Policies maps each error class to its retry policy.
+type Policies map[Class]Policy
+
+// DefaultPolicies never retries missing products or blocks (those are handled
+// by proxies and the politeness layer) and retries transient failures a few
+// times.
+func DefaultPolicies() Policies {
+	return Policies{
+		ClassNotFound:   {MaxAttempts: 1},
+		ClassBlocked:    {MaxAttempts: 1},
+		ClassTimeout:    {MaxAttempts: 2, BaseDelay: 2 * time.Second, MaxDelay: 10 * time.Second},
+		ClassCloudflare: {MaxAttempts: 2, BaseDelay: 10 * time.Second, MaxDelay: 30 * time.Second},
+		ClassBrowser:    {MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second},
+		ClassOther:      {MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: 5 * time.Second},
+	}
+}
+
+// sleep waits for d or until ctx is done. It is replaced in tests.
+var sleep = sleepContext
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Retry calls fn until it succeeds or the policy of the error class it
+// returned is exhausted. The attempt budget follows the class of the most
+// recent error, so a timeout followed by a not-found stops immediately.
+// Cancelling ctx ends a wait between attempts with ctx.Err().
+func Retry[T any](ctx context.Context, policies Policies, label string, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil {
+			return result, nil
+		}
+
+		class := Classify(err)
+		policy, ok := policies[class]
+		if !ok || attempt >= policy.MaxAttempts {
+			return result, err
+		}
+
+		delay := policy.backoff(attempt)
+		log.InfoContext(ctx, "Retrying", "label", label, "class", class, "attempt", attempt+1, "max_attempts", policy.MaxAttempts, "delay", delay.Round(time.Millisecond), "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package router routes requests with http.ServeMux patterns and answers
+// what the mux leaves to plain-text errors as problem details: unknown paths
+// get a 404, wrong methods a 405 with an Allow header, and OPTIONS lists the
+// allowed methods.
+//
+// Routes are registered as "METHOD /path/{param}", like ServeMux patterns:
+//
+//	r := router.New(logRequests, countRequests)
+//	r.HandleFunc("GET /stores/{store}/products/{id}", productHandler)
+//	admin := r.Group(requireKey)
+//	admin.HandleFunc("DELETE /admin/cache/{store}", purgeHandler)
+//
+// Middleware passed to New wraps every request, including 404s, 405s and
+// OPTIONS; middleware of a Group or a single route wraps only its handlers.
+package router
+
+import (
+	"fmt"
+	"hunter-base/pkg/api"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Middleware wraps a handler, e.g. to log or authenticate requests.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middleware, the first one outermost.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for _, mw := range slices.Backward(middleware) {
+		h = mw(h)
+	}
+	return h
+}
+
+// Router is an http.Handler dispatching to the registered routes.
+type Router struct {
+	mux        *http.ServeMux
+	middleware []Middleware
+	paths      map[string]*path
+}
+
+// path holds the handlers of one path pattern by method.
+type path struct {
+	handlers map[string]http.Handler
+}
+
+// New returns a Router that runs every request through middleware.
+func New(middleware ...Middleware) *Router {
+	r := &Router{mux: http.NewServeMux(), middleware: middleware, paths: map[string]*path{}}
+	r.mux.Handle("/", Chain(http.HandlerFunc(notFound), middleware...))
+	return r
+}
+
+// Handle registers h for pattern, "METHOD /path", wrapped in middleware. A
+// GET route also answers HEAD. It panics on malformed or duplicate patterns,
+// like http.ServeMux.
+func (r *Router) Handle(pattern string, h http.Handler, middleware ...Middleware) {
+	method, pathPattern, ok := strings.Cut(pattern, " ")
+	if !ok || method == "" || !strings.HasPrefix(pathPattern, "/") {
+		panic(fmt.Sprintf("router: pattern %q is not \"METHOD /path\"", pattern))
+	}
+
+	p, ok := r.paths[pathPattern]
+	if !ok {
+		p = &path{handlers: map[string]http.Handler{}}
+		r.paths[pathPattern] = p
+		r.mux.Handle(pathPattern, Chain(p, r.middleware...))
+	}
+	if _, dup := p.handlers[method]; dup {
+		panic(fmt.Sprintf("router: %s registered twice", pattern))
+	}
+	p.handlers[method] = Chain(h, middleware...)
+}
+
+// HandleFunc registers a handler function, see Handle.
+func (r *Router) HandleFunc(pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	r.Handle(pattern, h, middleware...)
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+// Group returns a set of routes that share middleware, such as
+// authentication for admin endpoints.
+func (r *Router) Group(middleware ...Middleware) *Group {
+	return &Group{router: r, middleware: middleware}
+}
+
+// Group registers routes on its Router with the group's middleware.
+type Group struct {
+	router     *Router
+	middleware []Middleware
+}
+
+// Handle registers h on the group's Router, wrapped in the group's
+// middleware and then in middleware.
+func (g *Group) Handle(pattern string, h http.Handler, middleware ...Middleware) {
+	g.router.Handle(pattern, h, append(slices.Clip(g.middleware), middleware...)...)
+}
+
+// HandleFunc registers a handler function, see Handle.
+func (g *Group) HandleFunc(pattern string, h http.HandlerFunc, middleware ...Middleware) {
+	g.Handle(pattern, h, middleware...)
+}
+
+// allowed lists the methods of p in a fixed order for the Allow header.
+func (p *path) allowed() []string {
+	methods := []string{http.MethodOptions}
+	for method := range p.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := p.handlers[http.MethodGet]; ok {
+		if _, ok := p.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+func (p *path) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := p.handlers[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		h, ok = p.handlers[http.MethodGet]
+	}
+	if ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	allow := strings.Join(p.allowed(), ", ")
+	w.Header().Set("Allow", allow)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	api.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed",
+		fmt.Sprintf("Method %s is not allowed. Use %s.", r.Method, allow), r.URL.Path)
+}
+
+// Route returns the path pattern r was routed by, such as
+// "/stores/{store}/products/{id}", or "" when no route matched.
+func Route(r *http.Request) string {
+	if r.Pattern == "/" {
+		return ""
+	}
+	return strings.TrimSuffix(r.Pattern, "{$}")
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	api.WriteNotFound(w, "No such endpoint: "+r.URL.Path, r.URL.Path)
+}
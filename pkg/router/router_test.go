@@ -0,0 +1,143 @@
+package router
+
+import (
+	"encoding/json"
+	"hunter-base/pkg/api"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// trace returns middleware that appends name to the X-Trace header.
+func trace(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newTestRouter() *Router {
+	r := New(trace("global"))
+	r.HandleFunc("GET /stores/{store}/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("store") + ":" + r.PathValue("id") + " " + Route(r)))
+	})
+	r.HandleFunc("POST /stores/{store}/products/batch", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("batch"))
+	})
+	admin := r.Group(trace("admin"))
+	admin.HandleFunc("DELETE /admin/cache/{store}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, trace("route"))
+	return r
+}
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+	return rr
+}
+
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) api.ProblemDetails {
+	t.Helper()
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("content type = %q", ct)
+	}
+	var problem api.ProblemDetails
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	return problem
+}
+
+func TestRouting(t *testing.T) {
+	r := newTestRouter()
+
+	rr := serve(r, "GET", "/stores/billa/products/00626061")
+	if rr.Code != http.StatusOK || rr.Body.String() != "billa:00626061 /stores/{store}/products/{id}" {
+		t.Errorf("product: got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr = serve(r, "POST", "/stores/billa/products/batch"); rr.Body.String() != "batch" {
+		t.Errorf("batch: got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr = serve(r, "HEAD", "/stores/billa/products/1"); rr.Code != http.StatusOK {
+		t.Errorf("HEAD: got status %d", rr.Code)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	r := newTestRouter()
+	for _, path := range []string{"/", "/stores", "/stores/billa/products/1/extra", "/admin/cache/billa/1/2"} {
+		rr := serve(r, "GET", path)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d", path, rr.Code)
+			continue
+		}
+		if problem := decodeProblem(t, rr); problem.Instance != path || problem.Status != http.StatusNotFound {
+			t.Errorf("%s: unexpected problem %+v", path, problem)
+		}
+		if rr.Header().Get("X-Trace") != "global" {
+			t.Errorf("%s: global middleware did not run", path)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := newTestRouter()
+
+	tests := map[string]string{
+		"/stores/billa/products/1":     "GET, HEAD, OPTIONS",
+		"/stores/billa/products/batch": "OPTIONS, POST",
+		"/admin/cache/billa":           "DELETE, OPTIONS",
+	}
+	for path, allow := range tests {
+		rr := serve(r, "PUT", path)
+		if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != allow {
+			t.Errorf("PUT %s: got %d, Allow %q, want Allow %q", path, rr.Code, rr.Header().Get("Allow"), allow)
+			continue
+		}
+		if problem := decodeProblem(t, rr); !strings.Contains(problem.Detail, allow) {
+			t.Errorf("PUT %s: detail %q does not list the allowed methods", path, problem.Detail)
+		}
+
+		rr = serve(r, "OPTIONS", path)
+		if rr.Code != http.StatusNoContent || rr.Header().Get("Allow") != allow {
+			t.Errorf("OPTIONS %s: got %d, Allow %q", path, rr.Code, rr.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := newTestRouter()
+
+	tests := []struct {
+		method, path string
+		want         []string
+	}{
+		{"GET", "/stores/billa/products/1", []string{"global"}},
+		{"DELETE", "/admin/cache/billa", []string{"global", "admin", "route"}},
+		// A 405 is answered before the route's own middleware runs.
+		{"GET", "/admin/cache/billa", []string{"global"}},
+	}
+	for _, tt := range tests {
+		rr := serve(r, tt.method, tt.path)
+		if got := rr.Header().Values("X-Trace"); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s %s: middleware ran as %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHandlePanicsOnBadPatterns(t *testing.T) {
+	for _, pattern := range []string{"/no/method", "GET stores", "GET /stores/{store}/products/{id}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected a panic", pattern)
+				}
+			}()
+			newTestRouter().HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+		}()
+	}
+}
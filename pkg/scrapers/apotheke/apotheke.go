@@ -1,32 +1,38 @@
 package apotheke
 
 import (
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
+	"hunter-base/pkg/tracing"
 	"regexp"
 	"strconv"
 	"strings"
 
 	"context"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/chromedp"
 )
 
+var log = logger.For("scrapers/apotheke")
+
 const (
 	Source  = "APOTHEKE_AT"
 	BaseURL = "https://www.apotheke.at/search.php?query=pzn-"
 )
 
 type Scraper struct {
-	BaseURL string
+	BaseURL    string
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
 }
 
 func NewScraper() *Scraper {
 	return &Scraper{
-		BaseURL: BaseURL,
+		BaseURL:    BaseURL,
+		Strategies: []common.Strategy{common.StrategyHTML, common.StrategyBrowser},
 	}
 }
 
@@ -38,38 +44,70 @@ func apothekeReadyCheck(execCtx context.Context) bool {
 	return false
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
-	product := common.NewProduct(Source, productID, s.BaseURL+productID)
-	searchURL := product.URL
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyHTML:    s.scrapeHTML,
+		common.StrategyBrowser: s.scrapeBrowser,
+	})
+}
+
+// pageFetcher loads a page and returns it parsed.
+type pageFetcher func(url string) (*goquery.Document, error)
 
-	ctx, cancel, err := common.NewUndetectedBrowser(120 * time.Second)
+func (s *Scraper) scrapeHTML(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	return s.scrape(ctx, productID, func(url string) (*goquery.Document, error) {
+		doc, _, err := common.FetchDocument(ctx, px, url)
+		return doc, err
+	})
+}
+
+func (s *Scraper) scrapeBrowser(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	ctx, cancel, err := common.NewUndetectedBrowser(ctx, px)
 	if err != nil {
 		return nil, err
 	}
 	defer cancel()
 
-	searchDoc, _, err := common.FetchPageHTML(ctx, searchURL, apothekeReadyCheck)
+	return s.scrape(ctx, productID, func(url string) (*goquery.Document, error) {
+		doc, _, err := common.FetchPageHTML(ctx, url, apothekeReadyCheck)
+		return doc, err
+	})
+}
+
+func (s *Scraper) scrape(ctx context.Context, productID string, fetch pageFetcher) (*models.Product, error) {
+	product := common.NewProduct(Source, productID, s.BaseURL+productID)
+	searchURL := product.URL
+
+	searchDoc, err := fetch(searchURL)
 	if err != nil {
 		return nil, err
 	}
 
+	_, span := tracing.Start(ctx, "parse.search")
 	foundLink := parseSearchCard(searchDoc, product)
+	span.End()
 
 	if product.Name != "" && foundLink != "" && foundLink != searchURL {
-		pdpDoc, _, pdpErr := common.FetchPageHTML(ctx, foundLink, apothekeReadyCheck)
+		pdpDoc, pdpErr := fetch(foundLink)
 		if pdpErr == nil {
+			_, span := tracing.Start(ctx, "parse.product")
+			common.ApplyJSONLD(product, common.ExtractJSONLD(pdpDoc))
 			parsePDP(pdpDoc, product)
+			span.End()
 		} else {
-			log.Printf("Failed to fetch PDP %s: %v", foundLink, pdpErr)
+			log.WarnContext(ctx, "Failed to fetch product page", "url", foundLink, "error", pdpErr)
 		}
 	} else {
 		if product.Name == "" {
+			_, span := tracing.Start(ctx, "parse.product")
+			common.ApplyJSONLD(product, common.ExtractJSONLD(searchDoc))
 			parsePDP(searchDoc, product)
+			span.End()
 		}
 	}
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
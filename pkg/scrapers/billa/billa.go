@@ -1,46 +1,130 @@
 package billa
 
 import (
+	"context"
+	"fmt"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gocolly/colly/v2"
 )
 
+var log = logger.For("scrapers/billa")
+
 const (
 	Source  = "BILLA"
 	BaseURL = "https://shop.billa.at/produkte/"
+	APIURL  = "https://shop.billa.at/api/product-discovery/products/"
 )
 
 type Scraper struct {
-	Collector *colly.Collector
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
 }
 
 func NewScraper() *Scraper {
-	c := colly.NewCollector(
-		colly.AllowedDomains("shop.billa.at"),
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
-	)
-	c.WithTransport(&http.Transport{
-		ResponseHeaderTimeout: 30 * time.Second,
-	})
-	c.SetRequestTimeout(30 * time.Second)
 	return &Scraper{
-		Collector: c,
+		Strategies: []common.Strategy{common.StrategyAPI, common.StrategyHTML},
+	}
+}
+
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyAPI:  s.scrapeAPI,
+		common.StrategyHTML: s.scrapeHTML,
+	})
+}
+
+// billaAPIProduct is the subset of the shop's product-discovery response we
+// use. Prices are given in cents.
+type billaAPIProduct struct {
+	Name        string `json:"name"`
+	SKU         string `json:"sku"`
+	Slug        string `json:"slug"`
+	Purchasable bool   `json:"purchasable"`
+	Brand       *struct {
+		Name string `json:"name"`
+	} `json:"brand"`
+	Price struct {
+		Regular struct {
+			Value                   int `json:"value"`
+			PerStandardizedQuantity int `json:"perStandardizedQuantity"`
+		} `json:"regular"`
+		Crossed             int    `json:"crossed"`
+		DiscountDescription string `json:"discountDescription"`
+		ValidityEnd         string `json:"validityEnd"`
+		BaseUnitShort       string `json:"baseUnitShort"`
+	} `json:"price"`
+}
+
+// apiSKU converts the digits-only product ID back into the shop's
+// "00-626061" SKU notation.
+func apiSKU(productID string) string {
+	if len(productID) <= 2 || strings.Contains(productID, "-") {
+		return productID
 	}
+	return productID[:2] + "-" + productID[2:]
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
+func (s *Scraper) scrapeAPI(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
 	product := common.NewProduct(Source, productID, BaseURL+productID)
 
-	s.Collector.OnHTML("h1", func(e *colly.HTMLElement) {
-		product.Name = strings.TrimSpace(e.Text)
+	var data billaAPIProduct
+	if err := common.FetchJSON(ctx, px, APIURL+apiSKU(productID), &data); err != nil {
+		return nil, err
+	}
+
+	if data.Name == "" {
+		return nil, common.ErrNoProduct
+	}
+
+	product.Name = strings.TrimSpace(data.Name)
+	if data.Slug != "" {
+		product.URL = BaseURL + data.Slug
+	}
+	if data.Brand != nil {
+		product.Brand = data.Brand.Name
+	}
+
+	if data.Price.Regular.Value > 0 {
+		product.Price = float64(data.Price.Regular.Value) / 100
+		product.IsAvailable = true
+	}
+	if data.Price.Crossed > data.Price.Regular.Value {
+		product.OldPrice = float64(data.Price.Crossed) / 100
+		product.IsDiscounted = true
+	}
+	if data.Price.DiscountDescription != "" {
+		product.DiscountLabel = data.Price.DiscountDescription
+		product.IsDiscounted = true
+	}
+	if data.Price.Regular.PerStandardizedQuantity > 0 && data.Price.BaseUnitShort != "" {
+		product.PriceDetails = fmt.Sprintf("%.2f €/%s", float64(data.Price.Regular.PerStandardizedQuantity)/100, data.Price.BaseUnitShort)
+	}
+	if validTo, err := time.Parse(time.RFC3339, data.Price.ValidityEnd); err == nil {
+		product.PriceValidUntil = &validTo
+	}
+
+	return product, nil
+}
+
+func (s *Scraper) scrapeHTML(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	product := common.NewProduct(Source, productID, BaseURL+productID)
+	c := common.NewCollector(px, "shop.billa.at")
+
+	c.OnHTML(`script[type="application/ld+json"]`, func(e *colly.HTMLElement) {
+		common.ApplyJSONLD(product, common.ParseJSONLD(e.Text))
+	})
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		if name := strings.TrimSpace(e.Text); name != "" {
+			product.Name = name
+		}
 	})
-	s.Collector.OnHTML(".ws-product-detail-main__price", func(e *colly.HTMLElement) {
+	c.OnHTML(".ws-product-detail-main__price", func(e *colly.HTMLElement) {
 		priceStr := e.ChildText(".ws-product-price-type__value")
 		if priceStr != "" {
 			if val := common.ParsePrice(priceStr); val > 0 {
@@ -58,14 +142,14 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 		}
 	})
 
-	log.Printf("Navigating to %s", product.URL)
-	err := s.Collector.Visit(product.URL)
+	log.InfoContext(ctx, "Navigating", "url", product.URL)
+	err := common.Visit(ctx, c, product.URL)
 	if err != nil {
 		return nil, err
 	}
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
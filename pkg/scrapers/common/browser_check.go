@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// browserNames are the executables chromedp looks for on the PATH.
+var browserNames = []string{
+	"headless_shell",
+	"headless-shell",
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+	"chrome",
+}
+
+// browserPaths are well-known install locations outside the PATH.
+var browserPaths = map[string][]string{
+	"darwin": {
+		"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		"/Applications/Chromium.app/Contents/MacOS/Chromium",
+	},
+	"windows": {
+		filepath.Join(os.Getenv("ProgramFiles"), `Google\Chrome\Application\chrome.exe`),
+		filepath.Join(os.Getenv("ProgramFiles(x86)"), `Google\Chrome\Application\chrome.exe`),
+		filepath.Join(os.Getenv("LocalAppData"), `Google\Chrome\Application\chrome.exe`),
+	},
+}
+
+// ErrNoBrowser is returned by CheckBrowser when no Chrome executable exists.
+var ErrNoBrowser = errors.New("no Chrome or Chromium executable found")
+
+// FindBrowser returns the path of the Chrome executable browser strategies
+// would launch.
+func FindBrowser() (string, error) {
+	for _, name := range browserNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	for _, path := range browserPaths[runtime.GOOS] {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", ErrNoBrowser
+}
+
+// CheckBrowser makes sure Chrome can be launched by running it with
+// --version, and returns the version it reports. On Windows, where Chrome
+// opens a window instead of printing its version, only the path is checked.
+func CheckBrowser(ctx context.Context) (string, error) {
+	path, err := FindBrowser()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		return path, nil
+	}
+
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"hunter-base/pkg/metrics"
+	"sync"
+)
+
+// browsers holds the cancel functions of running Chrome instances so they
+// can be killed on shutdown instead of being orphaned.
+var browsers = struct {
+	sync.Mutex
+	next    int
+	cancels map[int]func()
+}{cancels: map[int]func(){}}
+
+// TrackBrowser registers the cancel function of a browser (or its allocator)
+// and returns one that both cancels and unregisters it. Callers defer the
+// returned function in place of cancel.
+func TrackBrowser(cancel func()) func() {
+	browsers.Lock()
+	id := browsers.next
+	browsers.next++
+	browsers.cancels[id] = cancel
+	metrics.BrowsersRunning.Set(float64(len(browsers.cancels)))
+	browsers.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			browsers.Lock()
+			delete(browsers.cancels, id)
+			metrics.BrowsersRunning.Set(float64(len(browsers.cancels)))
+			browsers.Unlock()
+			cancel()
+		})
+	}
+}
+
+// CloseBrowsers kills every browser that is still running and returns how
+// many there were.
+func CloseBrowsers() int {
+	browsers.Lock()
+	cancels := browsers.cancels
+	browsers.cancels = map[int]func(){}
+	metrics.BrowsersRunning.Set(0)
+	browsers.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels)
+}
@@ -3,8 +3,14 @@ package common
 import (
 	"context"
 	"fmt"
+	"hunter-base/pkg/logger"
+	"hunter-base/pkg/metrics"
 	"hunter-base/pkg/models"
-	"log"
+	"hunter-base/pkg/politeness"
+	"hunter-base/pkg/proxy"
+	"hunter-base/pkg/tracing"
+	"math/rand/v2"
+	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
@@ -12,9 +18,13 @@ import (
 
 	cu "github.com/Davincible/chromedp-undetected"
 	"github.com/PuerkitoBio/goquery"
+	cdpfetch "github.com/chromedp/cdproto/fetch"
 	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var log = logger.For("scrapers")
+
 func ParsePrice(raw string) float64 {
 	raw = strings.ReplaceAll(raw, "€", "")
 	raw = strings.ReplaceAll(raw, "\u00a0", "")
@@ -36,19 +46,123 @@ func NewProduct(source, id, url string) *models.Product {
 	}
 }
 
-func NewUndetectedBrowser(timeout time.Duration) (context.Context, func(), error) {
+// NewUndetectedBrowser launches Chrome, routed through px unless it is nil.
+// The returned context is derived from ctx and expires after the configured
+// browser timeout, and the browser is killed by CloseBrowsers if it is still
+// running on shutdown.
+func NewUndetectedBrowser(ctx context.Context, px *proxy.Proxy) (context.Context, func(), error) {
+
 	opts := []cu.Option{
-		cu.WithTimeout(timeout),
+		cu.WithContext(ctx),
+		cu.WithTimeout(CurrentSettings().BrowserTimeout),
 	}
 	if runtime.GOOS == "linux" {
 		opts = append(opts, cu.WithHeadless())
 	}
+	if px != nil {
+		log.InfoContext(ctx, "Launching browser", "proxy", px.String())
+		server, err := ProxyServer(px)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, cu.WithChromeFlags(server))
+	}
 
-	ctx, cancel, err := cu.New(cu.NewConfig(opts...))
+	browserCtx, cancel, err := cu.New(cu.NewConfig(opts...))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create undetected browser: %w", err)
 	}
-	return ctx, cancel, nil
+	cancel = TrackBrowser(cancel)
+
+	if err := LaunchBrowser(browserCtx, px); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return browserCtx, cancel, nil
+}
+
+// ProxyServer returns the Chrome flag routing the browser through px.
+// Credentials of HTTP proxies are answered by LaunchBrowser; Chrome has no
+// way to authenticate to a SOCKS proxy, so those are refused here rather
+// than failing on every navigation.
+func ProxyServer(px *proxy.Proxy) (chromedp.ExecAllocatorOption, error) {
+	if px.URL.User != nil && strings.HasPrefix(px.URL.Scheme, "socks") {
+		return nil, fmt.Errorf("proxy %s: the browser cannot authenticate to SOCKS proxies", px)
+	}
+	return chromedp.ProxyServer(px.ServerFlag()), nil
+}
+
+// LaunchBrowser starts the Chrome instance of a chromedp context right away
+// instead of on its first action, so its launch time is traced on its own
+// rather than as part of navigation. If px carries credentials, the browser
+// answers the proxy's authentication challenges with them.
+func LaunchBrowser(ctx context.Context, px *proxy.Proxy) error {
+	_, span := tracing.Start(ctx, "browser.launch")
+	err := chromedp.Run(ctx)
+	if err == nil && px != nil && px.URL.User != nil {
+		err = chromedp.Run(ctx, authenticateProxy(px.URL.User))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to launch browser: %w", err)
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// authenticateProxy intercepts the page's requests so that proxy challenges
+// can be answered with user. Every other request is let through unchanged,
+// and challenges from the store itself get Chrome's default handling.
+func authenticateProxy(user *url.Userinfo) chromedp.Action {
+	password, _ := user.Password()
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		chromedp.ListenTarget(ctx, func(ev any) {
+			switch ev := ev.(type) {
+			case *cdpfetch.EventRequestPaused:
+				go chromedp.Run(ctx, cdpfetch.ContinueRequest(ev.RequestID))
+			case *cdpfetch.EventAuthRequired:
+				response := &cdpfetch.AuthChallengeResponse{Response: cdpfetch.AuthChallengeResponseResponseDefault}
+				if ev.AuthChallenge.Source == cdpfetch.AuthChallengeSourceProxy {
+					response = &cdpfetch.AuthChallengeResponse{
+						Response: cdpfetch.AuthChallengeResponseResponseProvideCredentials,
+						Username: user.Username(),
+						Password: password,
+					}
+				}
+				go chromedp.Run(ctx, cdpfetch.ContinueWithAuth(ev.RequestID, response))
+			}
+		})
+		return cdpfetch.Enable().WithHandleAuthRequests(true).Do(ctx)
+	})
+}
+
+// Step runs actions as one group, traced as a span named "browser.<name>",
+// e.g. Step("extract", ...) around the evaluations reading the product.
+func Step(name string, actions ...chromedp.Action) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		ctx, span := tracing.Start(ctx, "browser."+name)
+		err := chromedp.Tasks(actions).Do(ctx)
+		tracing.End(span, err)
+		return err
+	})
+}
+
+// Navigate waits for the domain's politeness budget before navigating.
+func Navigate(url string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) (err error) {
+		ctx, span := tracing.Start(ctx, "browser.navigate", tracing.URL(url))
+		defer func() { tracing.End(span, err) }()
+
+		if err := politeness.Wait(ctx, url); err != nil {
+			return err
+		}
+		return chromedp.Navigate(url).Do(ctx)
+	})
+}
+
+// Pause sleeps for a randomized duration between 0.75d and 1.5d so page
+// interactions do not follow a fixed rhythm.
+func Pause(d time.Duration) chromedp.Action {
+	return Step("pause", chromedp.Sleep(d*3/4+rand.N(d*3/4)))
 }
 
 // ReadyCheck returns true when the page content has loaded (store-specific).
@@ -57,7 +171,14 @@ type ReadyCheck func(ctx context.Context) bool
 // WaitForCloudflare returns a chromedp.ActionFunc that polls until the Cloudflare
 // challenge resolves and the store-specific readyCheck reports the page is loaded.
 func WaitForCloudflare(readyCheck ReadyCheck) chromedp.ActionFunc {
-	return chromedp.ActionFunc(func(execCtx context.Context) error {
+	return chromedp.ActionFunc(func(execCtx context.Context) (err error) {
+		execCtx, span := tracing.Start(execCtx, "browser.wait_for_cloudflare")
+		challenged := false
+		defer func() {
+			span.SetAttributes(attribute.Bool("hunter.cloudflare_challenge", challenged))
+			tracing.End(span, err)
+		}()
+
 		ticker := time.NewTicker(500 * time.Millisecond)
 		defer ticker.Stop()
 		cfPolls := 0
@@ -65,6 +186,7 @@ func WaitForCloudflare(readyCheck ReadyCheck) chromedp.ActionFunc {
 			select {
 			case <-execCtx.Done():
 				if cfPolls > 0 {
+					metrics.CloudflareChallenges.WithLabelValues("unresolved").Inc()
 					return fmt.Errorf("cloudflare challenge did not resolve after %d polls", cfPolls)
 				}
 				return execCtx.Err()
@@ -72,13 +194,21 @@ func WaitForCloudflare(readyCheck ReadyCheck) chromedp.ActionFunc {
 				var isCF bool
 				if err := chromedp.Evaluate(`document.title.includes("Just a moment") || document.title.includes("Cloudflare") || !!document.querySelector('.cf-browser-verification') || !!document.querySelector('#challenge-running') || (document.body && (document.body.innerText.includes("Cloudflare") || document.body.innerText.includes("Ray ID")))`, &isCF).Do(execCtx); err == nil && isCF {
 					if cfPolls == 0 {
-						log.Println("Cloudflare challenge detected, waiting for auto-resolution...")
+						log.WarnContext(execCtx, "Cloudflare challenge detected, waiting for auto-resolution")
+						var location string
+						if err := chromedp.Evaluate(`window.location.href`, &location).Do(execCtx); err == nil {
+							politeness.ReportThrottled(location, 0)
+						}
 					}
 					cfPolls++
+					challenged = true
+					metrics.CloudflarePolls.Inc()
 					continue
 				}
 				if cfPolls > 0 {
-					log.Printf("Cloudflare challenge resolved after %d polls", cfPolls)
+					log.InfoContext(execCtx, "Cloudflare challenge resolved", "polls", cfPolls)
+					metrics.CloudflareChallenges.WithLabelValues("resolved").Inc()
+					cfPolls = 0
 				}
 				if readyCheck != nil && readyCheck(execCtx) {
 					return nil
@@ -92,25 +222,35 @@ func WaitForCloudflare(readyCheck ReadyCheck) chromedp.ActionFunc {
 }
 
 func FetchPageHTML(ctx context.Context, url string, readyCheck ReadyCheck) (*goquery.Document, string, error) {
-	log.Printf("Navigating to %s", url)
+	log.InfoContext(ctx, "Navigating", "url", url)
 	var html, finalURL string
 	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
+		Navigate(url),
 		WaitForCloudflare(readyCheck),
-		chromedp.Sleep(2*time.Second),
-		chromedp.Evaluate(`window.location.href`, &finalURL),
-		chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		Pause(2*time.Second),
+		Step("extract",
+			chromedp.Evaluate(`window.location.href`, &finalURL),
+			chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		),
 	)
 	if err != nil {
 		return nil, "", err
 	}
-	doc, err := ParseHTML(html)
+	doc, err := parseHTML(ctx, html)
 	if err != nil {
 		return nil, "", err
 	}
 	return doc, finalURL, nil
 }
 
+// parseHTML is ParseHTML traced as a span of ctx.
+func parseHTML(ctx context.Context, html string) (*goquery.Document, error) {
+	_, span := tracing.Start(ctx, "parse.html")
+	doc, err := ParseHTML(html)
+	tracing.End(span, err)
+	return doc, err
+}
+
 func ParseHTML(html string) (*goquery.Document, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
 	if err != nil {
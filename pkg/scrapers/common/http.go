@@ -0,0 +1,193 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/models"
+	"hunter-base/pkg/politeness"
+	"hunter-base/pkg/proxy"
+	"hunter-base/pkg/tracing"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+)
+
+// ErrBlocked is returned when a store answers a plain HTTP request with a
+// rate limit or bot challenge instead of content.
+var ErrBlocked = errors.New("request blocked by store")
+
+// FetchJSON GETs url through px (nil for a direct connection) and decodes
+// the JSON response into dst.
+func FetchJSON(ctx context.Context, px *proxy.Proxy, url string, dst any) error {
+	body, _, err := fetch(ctx, px, url, "application/json")
+	if err != nil {
+		return err
+	}
+	_, span := tracing.Start(ctx, "parse.json")
+	if err := json.Unmarshal(body, dst); err != nil {
+		err = fmt.Errorf("failed to decode JSON from %s: %w", url, err)
+		tracing.End(span, err)
+		return err
+	}
+	span.End()
+	return nil
+}
+
+// FetchDocument GETs url through px without a browser and returns the parsed
+// page and the URL it ended up on after redirects.
+func FetchDocument(ctx context.Context, px *proxy.Proxy, url string) (*goquery.Document, string, error) {
+	body, finalURL, err := fetch(ctx, px, url, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := parseHTML(ctx, string(body))
+	if err != nil {
+		return nil, "", err
+	}
+	return doc, finalURL, nil
+}
+
+// fetch GETs url and returns the body and the final URL, classifying
+// throttling, challenge pages and missing products.
+func fetch(ctx context.Context, px *proxy.Proxy, url, accept string) (body []byte, finalURL string, err error) {
+	ctx, span := tracing.Start(ctx, "http.get", tracing.URL(url))
+	defer func() { tracing.End(span, err) }()
+
+	settings := CurrentSettings()
+	client := &http.Client{Timeout: settings.HTTPTimeout}
+	if px != nil {
+		client.Transport = px.Transport(settings.HTTPTimeout)
+		log.InfoContext(ctx, "Fetching", "url", url, "proxy", px.String())
+	} else {
+		log.InfoContext(ctx, "Fetching", "url", url)
+	}
+
+	if err := politeness.Wait(ctx, url); err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", settings.UserAgent)
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Language", "de-AT,de;q=0.9")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		politeness.ReportThrottled(url, politeness.ParseRetryAfter(resp.Header.Get("Retry-After")))
+	default:
+		if IsChallengePage(string(body)) {
+			politeness.ReportThrottled(url, 0)
+		} else {
+			politeness.ReportOK(url)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "", models.ErrProductNotFound
+	case resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusServiceUnavailable:
+		return nil, "", fmt.Errorf("%w: %s returned %d", ErrBlocked, url, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return nil, "", fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+
+	if IsChallengePage(string(body)) {
+		return nil, "", fmt.Errorf("%w: %s served a bot challenge", ErrBlocked, url)
+	}
+
+	return body, resp.Request.URL.String(), nil
+}
+
+// IsBlocked reports whether err means the store refused to serve us, as
+// opposed to a network failure or a missing product.
+func IsBlocked(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrBlocked) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "cloudflare") ||
+		strings.Contains(msg, "forbidden") ||
+		strings.Contains(msg, "too many requests")
+}
+
+// IsChallengePage reports whether body looks like a Cloudflare interstitial.
+func IsChallengePage(body string) bool {
+	return strings.Contains(body, "<title>Just a moment") ||
+		strings.Contains(body, "cf-browser-verification") ||
+		strings.Contains(body, "challenge-platform") && strings.Contains(body, "cf_chl_")
+}
+
+// NewCollector returns a collector for one visit to the allowed domains,
+// connecting through px unless it is nil. Collectors are not shared: proxy
+// failover visits the same URL again, and the callbacks of one scrape must
+// not fire for another.
+func NewCollector(px *proxy.Proxy, domains ...string) *colly.Collector {
+	settings := CurrentSettings()
+	c := colly.NewCollector(
+		colly.AllowedDomains(domains...),
+		colly.UserAgent(settings.UserAgent),
+		colly.AllowURLRevisit(),
+	)
+	if px != nil {
+		c.WithTransport(px.Transport(settings.HTTPTimeout))
+	} else {
+		c.WithTransport(&http.Transport{ResponseHeaderTimeout: settings.HTTPTimeout})
+	}
+	c.SetRequestTimeout(settings.HTTPTimeout)
+	TrackThrottling(c)
+	return c
+}
+
+// Visit waits for the domain's politeness budget before visiting url with c.
+// The span of the visit also covers the collector's parsing callbacks.
+func Visit(ctx context.Context, c *colly.Collector, url string) (err error) {
+	ctx, span := tracing.Start(ctx, "http.visit", tracing.URL(url))
+	defer func() { tracing.End(span, err) }()
+
+	if err := politeness.Wait(ctx, url); err != nil {
+		return err
+	}
+	return c.Visit(url)
+}
+
+// TrackThrottling reports colly responses to the politeness layer so that
+// 429s and challenge pages slow down every later request to the domain.
+func TrackThrottling(c *colly.Collector) {
+	c.OnResponse(func(r *colly.Response) {
+		if IsChallengePage(string(r.Body)) {
+			politeness.ReportThrottled(r.Request.URL.String(), 0)
+			return
+		}
+		politeness.ReportOK(r.Request.URL.String())
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		switch r.StatusCode {
+		case http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			politeness.ReportThrottled(r.Request.URL.String(), politeness.ParseRetryAfter(r.Headers.Get("Retry-After")))
+		}
+	})
+}
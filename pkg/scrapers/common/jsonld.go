@@ -0,0 +1,411 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"hunter-base/pkg/models"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+)
+
+// JSONLDProduct is a schema.org Product normalized from any of the shapes
+// stores embed in their application/ld+json scripts.
+type JSONLDProduct struct {
+	Name        string
+	SKU         string
+	GTIN13      string
+	Brand       string
+	URL         string
+	Offers      []JSONLDOffer
+	Rating      float64
+	ReviewCount int
+}
+
+// JSONLDOffer is a single Offer, or one price point of an AggregateOffer.
+type JSONLDOffer struct {
+	Price        float64
+	HighPrice    float64
+	Currency     string
+	ValidUntil   time.Time
+	Availability string // schema.org item availability without the URI prefix, e.g. "InStock"
+	URL          string
+}
+
+// BestOffer returns the first offer carrying a positive price.
+func (p *JSONLDProduct) BestOffer() (JSONLDOffer, bool) {
+	for _, o := range p.Offers {
+		if o.Price > 0 {
+			return o, true
+		}
+	}
+	if len(p.Offers) > 0 {
+		return p.Offers[0], true
+	}
+	return JSONLDOffer{}, false
+}
+
+// IsAvailable reports whether a normalized schema.org availability value means
+// the product can be bought.
+func IsAvailable(availability string) bool {
+	switch availability {
+	case "InStock", "LimitedAvailability", "InStoreOnly", "OnlineOnly", "PreSale", "PreOrder", "BackOrder":
+		return true
+	}
+	return false
+}
+
+// JSONLDScripts evaluates the contents of every ld+json script on the current
+// page into dst, for scrapers that drive chromedp without parsing full HTML.
+func JSONLDScripts(dst *[]string) chromedp.Action {
+	return chromedp.Evaluate(`Array.from(document.querySelectorAll('script[type="application/ld+json"]')).map(s => s.textContent)`, dst)
+}
+
+// ExtractJSONLD collects every schema.org Product embedded in doc.
+func ExtractJSONLD(doc *goquery.Document) []JSONLDProduct {
+	var products []JSONLDProduct
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		products = append(products, ParseJSONLD(s.Text())...)
+	})
+	return products
+}
+
+// ParseJSONLD parses the body of a single ld+json script. It accepts a single
+// node, an array of nodes or an @graph container, and silently skips anything
+// that is not a Product.
+func ParseJSONLD(raw string) []JSONLDProduct {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+
+	var products []JSONLDProduct
+	collectJSONLD(json.RawMessage(raw), &products, 0)
+	return products
+}
+
+func collectJSONLD(raw json.RawMessage, products *[]JSONLDProduct, depth int) {
+	if depth > 4 {
+		return
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return
+	}
+
+	if raw[0] == '[' {
+		var nodes []json.RawMessage
+		if err := json.Unmarshal(raw, &nodes); err != nil {
+			return
+		}
+		for _, n := range nodes {
+			collectJSONLD(n, products, depth+1)
+		}
+		return
+	}
+
+	var node jsonLDNode
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return
+	}
+
+	for _, n := range node.Graph {
+		collectJSONLD(n, products, depth+1)
+	}
+
+	if node.Type.has("Product") {
+		*products = append(*products, node.product())
+	}
+}
+
+type jsonLDNode struct {
+	Type            jsonLDTypes       `json:"@type"`
+	Graph           []json.RawMessage `json:"@graph"`
+	Name            jsonLDString      `json:"name"`
+	SKU             jsonLDString      `json:"sku"`
+	GTIN13          jsonLDString      `json:"gtin13"`
+	GTIN            jsonLDString      `json:"gtin"`
+	URL             jsonLDString      `json:"url"`
+	Brand           jsonLDBrand       `json:"brand"`
+	Offers          jsonLDOffers      `json:"offers"`
+	AggregateRating *jsonLDRating     `json:"aggregateRating"`
+}
+
+func (n *jsonLDNode) product() JSONLDProduct {
+	p := JSONLDProduct{
+		Name:   strings.TrimSpace(string(n.Name)),
+		SKU:    strings.TrimSpace(string(n.SKU)),
+		GTIN13: strings.TrimSpace(string(n.GTIN13)),
+		Brand:  strings.TrimSpace(string(n.Brand)),
+		URL:    strings.TrimSpace(string(n.URL)),
+	}
+	if p.GTIN13 == "" {
+		p.GTIN13 = strings.TrimSpace(string(n.GTIN))
+	}
+
+	for _, o := range n.Offers {
+		p.Offers = append(p.Offers, o.flatten()...)
+	}
+
+	if n.AggregateRating != nil {
+		p.Rating = float64(n.AggregateRating.RatingValue)
+		p.ReviewCount = int(n.AggregateRating.ReviewCount)
+		if p.ReviewCount == 0 {
+			p.ReviewCount = int(n.AggregateRating.RatingCount)
+		}
+	}
+
+	return p
+}
+
+type jsonLDOffer struct {
+	Type            jsonLDTypes  `json:"@type"`
+	Price           jsonLDNumber `json:"price"`
+	LowPrice        jsonLDNumber `json:"lowPrice"`
+	HighPrice       jsonLDNumber `json:"highPrice"`
+	PriceCurrency   string       `json:"priceCurrency"`
+	PriceValidUntil string       `json:"priceValidUntil"`
+	Availability    string       `json:"availability"`
+	URL             string       `json:"url"`
+	Offers          jsonLDOffers `json:"offers"`
+}
+
+// flatten expands an AggregateOffer into its nested offers when present and
+// otherwise maps it onto a single price point using lowPrice.
+func (o *jsonLDOffer) flatten() []JSONLDOffer {
+	if len(o.Offers) > 0 {
+		var out []JSONLDOffer
+		for _, nested := range o.Offers {
+			for _, f := range nested.flatten() {
+				if f.Currency == "" {
+					f.Currency = o.PriceCurrency
+				}
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+
+	offer := JSONLDOffer{
+		Price:        float64(o.Price),
+		HighPrice:    float64(o.HighPrice),
+		Currency:     o.PriceCurrency,
+		ValidUntil:   parseJSONLDDate(o.PriceValidUntil),
+		Availability: normalizeAvailability(o.Availability),
+		URL:          strings.TrimSpace(o.URL),
+	}
+	if offer.Price == 0 {
+		offer.Price = float64(o.LowPrice)
+	}
+	return []JSONLDOffer{offer}
+}
+
+type jsonLDRating struct {
+	RatingValue jsonLDNumber `json:"ratingValue"`
+	ReviewCount jsonLDNumber `json:"reviewCount"`
+	RatingCount jsonLDNumber `json:"ratingCount"`
+}
+
+// jsonLDTypes accepts "@type" as either a string or an array of strings.
+type jsonLDTypes []string
+
+func (t *jsonLDTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = jsonLDTypes{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return nil
+	}
+	*t = many
+	return nil
+}
+
+func (t jsonLDTypes) has(name string) bool {
+	for _, v := range t {
+		if v == name || strings.HasSuffix(v, "/"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonLDString accepts strings and numbers, e.g. SKUs published as integers.
+type jsonLDString string
+
+func (s *jsonLDString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = jsonLDString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err == nil {
+		*s = jsonLDString(num.String())
+	}
+	return nil
+}
+
+// jsonLDNumber accepts numbers and numeric strings in either decimal notation.
+type jsonLDNumber float64
+
+func (n *jsonLDNumber) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err == nil {
+		*n = jsonLDNumber(f)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return nil
+	}
+	*n = jsonLDNumber(ParsePrice(str))
+	return nil
+}
+
+// jsonLDBrand accepts a plain brand name or a Brand/Organization node.
+type jsonLDBrand string
+
+func (b *jsonLDBrand) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*b = jsonLDBrand(str)
+		return nil
+	}
+	var node struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &node); err == nil {
+		*b = jsonLDBrand(node.Name)
+	}
+	return nil
+}
+
+// jsonLDOffers accepts "offers" as a single node or an array of nodes.
+type jsonLDOffers []jsonLDOffer
+
+func (o *jsonLDOffers) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var many []jsonLDOffer
+		if err := json.Unmarshal(data, &many); err != nil {
+			return nil
+		}
+		*o = many
+		return nil
+	}
+	var single jsonLDOffer
+	if err := json.Unmarshal(data, &single); err != nil {
+		return nil
+	}
+	*o = jsonLDOffers{single}
+	return nil
+}
+
+func normalizeAvailability(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if i := strings.LastIndex(raw, "/"); i != -1 {
+		raw = raw[i+1:]
+	}
+	return raw
+}
+
+func parseJSONLDDate(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// MatchJSONLD picks the product whose SKU or GTIN matches productID. Without
+// a match it only falls back to the single product of a page with a name;
+// pages listing several products, e.g. recommendations, match nothing rather
+// than report another product's price.
+func MatchJSONLD(products []JSONLDProduct, productID string) (*JSONLDProduct, bool) {
+	trimmedID := strings.TrimLeft(productID, "0")
+	for i := range products {
+		p := &products[i]
+		for _, id := range []string{p.SKU, p.GTIN13} {
+			if id != "" && (id == productID || strings.TrimLeft(id, "0") == trimmedID) {
+				return p, true
+			}
+		}
+	}
+	if len(products) == 1 && products[0].Name != "" {
+		return &products[0], true
+	}
+	return nil, false
+}
+
+// ApplyJSONLD fills the empty fields of product from the best matching
+// JSON-LD node. Scrapers call it before their own selectors so that
+// store-specific parsing can still refine the result. It reports whether a
+// matching node was found.
+func ApplyJSONLD(product *models.Product, products []JSONLDProduct) bool {
+	ld, ok := MatchJSONLD(products, product.ID)
+	if !ok {
+		return false
+	}
+
+	if product.Name == "" {
+		product.Name = ld.Name
+	}
+	if product.Brand == "" {
+		product.Brand = ld.Brand
+	}
+	if product.GTIN13 == "" {
+		product.GTIN13 = ld.GTIN13
+	}
+	if product.Rating == 0 {
+		product.Rating = ld.Rating
+	}
+	if product.ReviewCount == 0 {
+		product.ReviewCount = ld.ReviewCount
+	}
+
+	offer, ok := ld.BestOffer()
+	if !ok {
+		return true
+	}
+
+	if product.Price == 0 && offer.Price > 0 {
+		product.Price = offer.Price
+	}
+	if offer.Currency != "" {
+		product.Currency = offer.Currency
+	}
+	if product.PriceValidUntil == nil && !offer.ValidUntil.IsZero() {
+		validUntil := offer.ValidUntil
+		product.PriceValidUntil = &validUntil
+	}
+	if offer.Availability != "" {
+		product.IsAvailable = IsAvailable(offer.Availability)
+		if !product.IsAvailable && product.AvailabilityLabel == "" {
+			product.AvailabilityLabel = offer.Availability
+		}
+	} else if product.Price > 0 {
+		product.IsAvailable = true
+	}
+
+	return true
+}
+
+// ParseJSONLDScripts parses the raw script bodies returned by JSONLDScripts.
+func ParseJSONLDScripts(scripts []string) []JSONLDProduct {
+	var products []JSONLDProduct
+	for _, s := range scripts {
+		products = append(products, ParseJSONLD(s)...)
+	}
+	return products
+}
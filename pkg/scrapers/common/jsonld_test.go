@@ -0,0 +1,141 @@
+package common
+
+import (
+	"hunter-base/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestParseJSONLD(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          string
+		expectedLen  int
+		expectedName string
+		expectedGTIN string
+		price        float64
+		availability string
+		brand        string
+		rating       float64
+		reviews      int
+		validUntil   string
+	}{
+		{
+			name:         "Single Product with string price",
+			raw:          `{"@context":"https://schema.org","@type":"Product","name":"Kaiserschmarrn","sku":"000000000592213001","offers":{"@type":"Offer","price":"0.99","priceCurrency":"EUR","availability":"https://schema.org/InStock"}}`,
+			expectedLen:  1,
+			expectedName: "Kaiserschmarrn",
+			price:        0.99,
+			availability: "InStock",
+		},
+		{
+			name:         "Graph with brand node and numeric price",
+			raw:          `{"@context":"https://schema.org","@graph":[{"@type":"BreadcrumbList"},{"@type":["Product"],"name":"Philadelphia","gtin13":"4000417025005","brand":{"@type":"Brand","name":"Philadelphia"},"offers":{"@type":"Offer","price":1.66,"priceValidUntil":"2026-02-20","availability":"http://schema.org/OutOfStock"}}]}`,
+			expectedLen:  1,
+			expectedName: "Philadelphia",
+			expectedGTIN: "4000417025005",
+			price:        1.66,
+			availability: "OutOfStock",
+			brand:        "Philadelphia",
+			validUntil:   "2026-02-20",
+		},
+		{
+			name:         "AggregateOffer with rating",
+			raw:          `[{"@type":"Organization"},{"@type":"Product","name":"Kijimea","aggregateRating":{"ratingValue":"4,5","reviewCount":"12"},"offers":{"@type":"AggregateOffer","lowPrice":"89,89","highPrice":"99,99","priceCurrency":"EUR"}}]`,
+			expectedLen:  1,
+			expectedName: "Kijimea",
+			price:        89.89,
+			rating:       4.5,
+			reviews:      12,
+		},
+		{
+			name:        "No Product",
+			raw:         `{"@type":"WebSite","name":"Shop"}`,
+			expectedLen: 0,
+		},
+		{
+			name:        "Invalid JSON",
+			raw:         `{"@type":"Product",`,
+			expectedLen: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products := ParseJSONLD(tt.raw)
+			if len(products) != tt.expectedLen {
+				t.Fatalf("got %d products, want %d", len(products), tt.expectedLen)
+			}
+			if tt.expectedLen == 0 {
+				return
+			}
+
+			p := products[0]
+			if p.Name != tt.expectedName {
+				t.Errorf("name mismatch: got %q want %q", p.Name, tt.expectedName)
+			}
+			if p.GTIN13 != tt.expectedGTIN {
+				t.Errorf("gtin13 mismatch: got %q want %q", p.GTIN13, tt.expectedGTIN)
+			}
+			if p.Brand != tt.brand {
+				t.Errorf("brand mismatch: got %q want %q", p.Brand, tt.brand)
+			}
+			if p.Rating != tt.rating || p.ReviewCount != tt.reviews {
+				t.Errorf("rating mismatch: got %v/%d want %v/%d", p.Rating, p.ReviewCount, tt.rating, tt.reviews)
+			}
+
+			offer, ok := p.BestOffer()
+			if !ok {
+				t.Fatal("expected an offer")
+			}
+			if offer.Price != tt.price {
+				t.Errorf("price mismatch: got %v want %v", offer.Price, tt.price)
+			}
+			if offer.Availability != tt.availability {
+				t.Errorf("availability mismatch: got %q want %q", offer.Availability, tt.availability)
+			}
+			if tt.validUntil != "" && offer.ValidUntil.Format("2006-01-02") != tt.validUntil {
+				t.Errorf("priceValidUntil mismatch: got %v want %v", offer.ValidUntil, tt.validUntil)
+			}
+		})
+	}
+}
+
+func TestApplyJSONLDKeepsExistingFields(t *testing.T) {
+	product := NewProduct("TEST", "4000417025005", "https://example.com")
+	product.Name = "From selector"
+
+	ld := ParseJSONLD(`{"@type":"Product","name":"From JSON-LD","gtin13":"4000417025005","offers":{"price":"2.49","priceValidUntil":"2026-02-20T00:00:00Z","availability":"InStock"}}`)
+	if !ApplyJSONLD(product, ld) {
+		t.Fatal("expected JSON-LD to match")
+	}
+
+	if product.Name != "From selector" {
+		t.Errorf("name was overwritten: %q", product.Name)
+	}
+	if product.Price != 2.49 || !product.IsAvailable {
+		t.Errorf("price/availability not applied: %v/%v", product.Price, product.IsAvailable)
+	}
+	if product.PriceValidUntil == nil || !product.PriceValidUntil.Equal(time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("priceValidUntil not applied: %v", product.PriceValidUntil)
+	}
+
+	if ApplyJSONLD(&models.Product{}, nil) {
+		t.Error("expected no match for empty input")
+	}
+}
+
+func TestMatchJSONLD(t *testing.T) {
+	single := ParseJSONLD(`{"@type":"Product","name":"Milk","sku":"other"}`)
+	if p, ok := MatchJSONLD(single, "123"); !ok || p.Name != "Milk" {
+		t.Errorf("single product: got %v, %v", p, ok)
+	}
+
+	related := ParseJSONLD(`[{"@type":"Product","name":"Recommended","sku":"999"},{"@type":"Product","name":"Butter","gtin13":"0000000000123"}]`)
+	if p, ok := MatchJSONLD(related, "123"); !ok || p.Name != "Butter" {
+		t.Errorf("matching GTIN: got %v, %v", p, ok)
+	}
+	if p, ok := MatchJSONLD(related, "456"); ok {
+		t.Errorf("several products without a match: got %v", p.Name)
+	}
+}
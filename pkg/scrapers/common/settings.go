@@ -0,0 +1,50 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is sent by all scrapers unless configured otherwise.
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// Settings are shared by all scrapers.
+type Settings struct {
+	// UserAgent is sent by plain HTTP requests, colly collectors and browsers.
+	UserAgent string
+	// HTTPTimeout bounds a single request without a browser.
+	HTTPTimeout time.Duration
+	// BrowserTimeout bounds a whole browser scrape.
+	BrowserTimeout time.Duration
+	// DebugDir receives screenshots and HTML of failed browser scrapes.
+	// Empty skips capturing them.
+	DebugDir string
+}
+
+// DefaultSettings returns the settings used until Configure is called.
+func DefaultSettings() Settings {
+	return Settings{
+		UserAgent:      DefaultUserAgent,
+		HTTPTimeout:    30 * time.Second,
+		BrowserTimeout: 120 * time.Second,
+	}
+}
+
+var (
+	settingsMu sync.RWMutex
+	settings   = DefaultSettings()
+)
+
+// Configure replaces the shared scraper settings.
+func Configure(s Settings) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	settings = s
+}
+
+// CurrentSettings returns the shared scraper settings.
+func CurrentSettings() Settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
+	"hunter-base/pkg/tracing"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Strategy names a way of obtaining a product from a store.
+type Strategy string
+
+const (
+	// StrategyAPI reads a store's JSON endpoint over plain HTTP.
+	StrategyAPI Strategy = "api"
+	// StrategyHTML fetches and parses the product page over plain HTTP.
+	StrategyHTML Strategy = "html"
+	// StrategyBrowser renders the page in Chrome.
+	StrategyBrowser Strategy = "browser"
+)
+
+// StrategyFunc scrapes a single product using one strategy, connecting
+// through px unless it is nil.
+type StrategyFunc func(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error)
+
+// ParseStrategies parses a comma separated strategy order such as
+// "api,browser". Unknown names are dropped.
+func ParseStrategies(raw string) []Strategy {
+	var order []Strategy
+	for _, part := range strings.Split(raw, ",") {
+		switch s := Strategy(strings.ToLower(strings.TrimSpace(part))); s {
+		case StrategyAPI, StrategyHTML, StrategyBrowser:
+			order = append(order, s)
+		}
+	}
+	return order
+}
+
+// ErrNoProduct is returned by strategies that got a response but could not
+// find the product in it. Unlike a 404 from the store, it lets the next
+// strategy try. It wraps models.ErrProductNotFound, so a product that no
+// strategy finds counts as missing.
+var ErrNoProduct = fmt.Errorf("%w: no product in response", models.ErrProductNotFound)
+
+// RunStrategies tries the strategies of a store in order and returns the
+// first product found, recording which strategy produced it. Strategies that
+// the store does not implement are skipped. Each strategy runs through the
+// store's proxy pool (see WithProxy). A strategy reporting
+// models.ErrProductNotFound other than ErrNoProduct ends the run, as the
+// store answered 404 and a slower strategy would only find the same. When
+// every strategy fails the last error is returned.
+func RunStrategies(ctx context.Context, source, productID string, order []Strategy, pool *proxy.Pool, funcs map[Strategy]StrategyFunc) (*models.Product, error) {
+	var lastErr error
+	tried := 0
+
+	for _, name := range order {
+		fn, ok := funcs[name]
+		if !ok {
+			continue
+		}
+		tried++
+
+		strategyCtx, span := tracing.Start(ctx, "scrape."+string(name),
+			attribute.String("hunter.source", source), tracing.Product(productID))
+		product, err := WithProxy(strategyCtx, pool, productID, func(px *proxy.Proxy) (*models.Product, error) {
+			return fn(strategyCtx, productID, px)
+		})
+		tracing.End(span, err)
+		if err == nil {
+			product.Strategy = string(name)
+			return product, nil
+		}
+
+		if errors.Is(err, models.ErrProductNotFound) && !errors.Is(err, ErrNoProduct) {
+			return nil, err
+		}
+
+		log.WarnContext(ctx, "Strategy failed", "source", source, "strategy", name, "id", productID, "error", err)
+		lastErr = err
+	}
+
+	if tried == 0 {
+		return nil, fmt.Errorf("no supported scrape strategy configured for %s", source)
+	}
+	return nil, lastErr
+}
+
+// WithProxy runs fn through a proxy picked from pool for productID and
+// records the outcome on that proxy. When the store blocks the proxy, fn is
+// retried through the next one until the pool is exhausted. A nil pool runs
+// fn once over a direct connection.
+func WithProxy(ctx context.Context, pool *proxy.Pool, productID string, fn func(px *proxy.Proxy) (*models.Product, error)) (*models.Product, error) {
+	attempts := pool.Len()
+	if attempts == 0 {
+		return fn(nil)
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		px := pool.Pick(productID)
+
+		product, err := fn(px)
+		if err == nil || errors.Is(err, models.ErrProductNotFound) {
+			pool.ReportSuccess(px)
+			return product, err
+		}
+
+		blocked := IsBlocked(err)
+		pool.ReportFailure(px, err, blocked)
+		if !blocked {
+			return nil, err
+		}
+
+		log.WarnContext(ctx, "Proxy was blocked, failing over", "proxy", px.String())
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
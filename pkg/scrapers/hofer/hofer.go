@@ -2,143 +2,135 @@ package hofer
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
+	"hunter-base/pkg/tracing"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/chromedp/chromedp"
 )
 
+var log = logger.For("scrapers/hofer")
+
 const (
 	Source  = "HOFER"
 	BaseURL = "https://www.hofer.at/de/p."
 )
 
-type Scraper struct{}
+type Scraper struct {
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
+}
 
 func NewScraper() *Scraper {
-	return &Scraper{}
+	return &Scraper{
+		Strategies: []common.Strategy{common.StrategyHTML, common.StrategyBrowser},
+	}
+}
+
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyHTML:    s.scrapeHTML,
+		common.StrategyBrowser: s.scrapeBrowser,
+	})
 }
 
-type JSONLDProduct struct {
-	Type        string `json:"@type"`
-	Name        string `json:"name"`
-	Image       string `json:"image"`
-	Description string `json:"description"`
-	Sku         string `json:"sku"`
-	Offers      struct {
-		Type          string          `json:"@type"`
-		Availability  string          `json:"availability"`
-		Price         json.RawMessage `json:"price"` // Can be string or number
-		PriceCurrency string          `json:"priceCurrency"`
-		Url           string          `json:"url"`
-	} `json:"offers"`
+// productURL builds https://www.hofer.at/de/p.{id}.html
+func productURL(productID string) string {
+	return fmt.Sprintf("%s%s.html", BaseURL, productID)
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
-	// Hofer URL construction: https://www.hofer.at/de/p.{id}.html
-	productURL := fmt.Sprintf("%s%s.html", BaseURL, productID)
+// scrapeHTML reads the server-rendered JSON-LD without starting Chrome.
+func (s *Scraper) scrapeHTML(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	product := common.NewProduct(Source, productID, productURL(productID))
 
-	product := common.NewProduct(Source, productID, productURL)
+	doc, _, err := common.FetchDocument(ctx, px, product.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	applyJSONLD(product, common.ExtractJSONLD(doc))
+
+	if product.Name == "" {
+		product.Name = strings.TrimSpace(doc.Find("h1").First().Text())
+	}
+	applyPriceLabel(product, doc.Find(".pdp_price__now, .at-productprice_lbl").First().Text())
+
+	if product.Name == "" {
+		return nil, common.ErrNoProduct
+	}
+
+	return product, nil
+}
+
+func (s *Scraper) scrapeBrowser(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	product := common.NewProduct(Source, productID, productURL(productID))
+	settings := common.CurrentSettings()
 
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
+		chromedp.UserAgent(settings.UserAgent),
 		chromedp.WindowSize(1920, 1080),
 	)
-	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	if px != nil {
+		server, err := common.ProxyServer(px)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server)
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	cancelAlloc = common.TrackBrowser(cancelAlloc)
 	defer cancelAlloc()
 
-	ctx, cancel := chromedp.NewContext(allocCtx)
+	browserCtx, cancel := chromedp.NewContext(allocCtx)
 	defer cancel()
+	if err := common.LaunchBrowser(browserCtx, px); err != nil {
+		return nil, err
+	}
 
-	scrapeCtx, cancelScrape := context.WithTimeout(ctx, 45*time.Second)
+	scrapeCtx, cancelScrape := context.WithTimeout(browserCtx, settings.BrowserTimeout)
 	defer cancelScrape()
 
-	var jsonLDContent string
+	var ldScripts []string
 	var priceNowStr string
 
-	log.Printf("[HOFER] Navigating to %s", product.URL)
+	log.InfoContext(ctx, "Navigating", "url", product.URL)
 
 	err := chromedp.Run(scrapeCtx,
-		chromedp.Navigate(product.URL),
-		chromedp.WaitReady(`body`, chromedp.ByQuery),
-		chromedp.Sleep(2*time.Second),
-
-		// Extract JSON-LD
-		chromedp.Evaluate(`
-			(function() {
-				const scripts = document.querySelectorAll('script[type="application/ld+json"]');
-				for (const script of scripts) {
-					if (script.innerText.includes('"@type": "Product"') || script.innerText.includes('"@type":"Product"')) {
-						return script.innerText;
-					}
-				}
-				return "";
-			})()
-		`, &jsonLDContent),
-
-		// Extract Price label directly if JSON-LD fails or as backup
-		chromedp.Evaluate(`
-			(function() {
-				let el = document.querySelector(".pdp_price__now") || document.querySelector(".at-productprice_lbl");
-				return el ? el.innerText : "";
-			})()
-		`, &priceNowStr),
+		common.Navigate(product.URL),
+		common.Step("wait_ready", chromedp.WaitReady(`body`, chromedp.ByQuery)),
+		common.Pause(2*time.Second),
+
+		common.Step("extract",
+			// Extract JSON-LD
+			common.JSONLDScripts(&ldScripts),
+
+			// Extract Price label directly if JSON-LD fails or as backup
+			chromedp.Evaluate(`
+				(function() {
+					let el = document.querySelector(".pdp_price__now") || document.querySelector(".at-productprice_lbl");
+					return el ? el.innerText : "";
+				})()
+			`, &priceNowStr),
+		),
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("chromedp execution failed: %w", err)
 	}
 
+	_, span := tracing.Start(ctx, "parse.product")
+	defer span.End()
+
 	// 1. Try JSON-LD first
-	if jsonLDContent != "" {
-		var ld ProductJSONLD
-		if err := json.Unmarshal([]byte(jsonLDContent), &ld); err == nil {
-			product.Name = strings.TrimSpace(ld.Name)
-			if ld.Offers.PriceCurrency != "" {
-				product.Currency = ld.Offers.PriceCurrency
-			}
-
-			// Parse Price (handle string or number)
-			var priceStr string
-			if len(ld.Offers.Price) > 0 {
-				// Try unquote first if it's a string
-				if err := json.Unmarshal(ld.Offers.Price, &priceStr); err != nil {
-					priceStr = string(ld.Offers.Price)
-				}
-			}
-
-			// Clean price string
-			priceStr = strings.Trim(priceStr, `"'`)
-			if val, err := strconv.ParseFloat(priceStr, 64); err == nil {
-				product.Price = val
-			}
-
-			// Availability
-			avail := strings.ToLower(ld.Offers.Availability)
-			if strings.Contains(avail, "instock") || avail == "in stock" {
-				product.IsAvailable = true
-				product.AvailabilityLabel = "Available"
-			} else {
-				product.IsAvailable = false
-				product.AvailabilityLabel = ld.Offers.Availability
-			}
-
-			// Update URL if redirected/different in JSON
-			if ld.Offers.Url != "" {
-				if _, err := url.Parse(ld.Offers.Url); err == nil {
-					product.URL = ld.Offers.Url
-				}
-			}
-		} else {
-			log.Printf("[HOFER] Failed to parse JSON-LD: %v", err)
-		}
+	ldProducts := common.ParseJSONLDScripts(ldScripts)
+	if !applyJSONLD(product, ldProducts) && len(ldScripts) > 0 {
+		log.WarnContext(ctx, "No product found in JSON-LD", "scripts", len(ldScripts))
 	}
 
 	// 2. Fallback to HTML selectors
@@ -149,30 +141,47 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 		}
 	}
 
-	if product.Price == 0 && priceNowStr != "" {
-		if val := common.ParsePrice(priceNowStr); val > 0 {
-			product.Price = val
-
-			if !product.IsAvailable && product.AvailabilityLabel == "" {
-				product.IsAvailable = true
-			}
-		}
-	}
+	applyPriceLabel(product, priceNowStr)
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
 }
 
-type ProductJSONLD struct {
-	Type   string `json:"@type"`
-	Name   string `json:"name"`
-	Offers struct {
-		Price         json.RawMessage `json:"price"`
-		PriceCurrency string          `json:"priceCurrency"`
-		Availability  string          `json:"availability"`
-		Url           string          `json:"url"`
-	} `json:"offers"`
+// applyJSONLD applies the matching JSON-LD product and Hofer's availability
+// label, preferring the canonical offer URL when one is published.
+func applyJSONLD(product *models.Product, ldProducts []common.JSONLDProduct) bool {
+	ld, ok := common.MatchJSONLD(ldProducts, product.ID)
+	if !ok {
+		return false
+	}
+	common.ApplyJSONLD(product, ldProducts)
+
+	if product.IsAvailable {
+		product.AvailabilityLabel = "Available"
+	}
+
+	// Update URL if redirected/different in JSON
+	if offer, ok := ld.BestOffer(); ok && offer.URL != "" {
+		if _, err := url.Parse(offer.URL); err == nil {
+			product.URL = offer.URL
+		}
+	}
+	return true
+}
+
+// applyPriceLabel uses the rendered price label when JSON-LD had no price.
+func applyPriceLabel(product *models.Product, priceNowStr string) {
+	if product.Price != 0 || priceNowStr == "" {
+		return
+	}
+	if val := common.ParsePrice(priceNowStr); val > 0 {
+		product.Price = val
+
+		if !product.IsAvailable && product.AvailabilityLabel == "" {
+			product.IsAvailable = true
+		}
+	}
 }
@@ -1,41 +1,36 @@
 package lidl
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
-	"net/http"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/gocolly/colly/v2"
 )
 
+var log = logger.For("scrapers/lidl")
+
 const (
 	Source  = "LIDL"
 	BaseURL = "https://www.lidl.at/p/"
 )
 
 type Scraper struct {
-	Collector *colly.Collector
-	BaseURL   string
+	BaseURL    string
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
 }
 
 func NewScraper() *Scraper {
-	c := colly.NewCollector(
-		colly.AllowedDomains("www.lidl.at", "127.0.0.1"), // localhost for testing
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
-	)
-	c.WithTransport(&http.Transport{
-		ResponseHeaderTimeout: 30 * time.Second,
-	})
-	c.SetRequestTimeout(30 * time.Second)
 	return &Scraper{
-		Collector: c,
-		BaseURL:   "https://www.lidl.at/p/product/p",
+		BaseURL:    "https://www.lidl.at/p/product/p",
+		Strategies: []common.Strategy{common.StrategyHTML},
 	}
 }
 
@@ -47,14 +42,25 @@ type lidlDataLayer struct {
 	Brand    string  `json:"brand"`
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyHTML: s.scrapeHTML,
+	})
+}
+
+func (s *Scraper) scrapeHTML(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
 	url := fmt.Sprintf("%s%s", s.BaseURL, productID)
 
 	product := common.NewProduct(Source, productID, url)
+	c := common.NewCollector(px, "www.lidl.at", "127.0.0.1") // localhost for testing
 
 	var jsonFound bool
 
-	s.Collector.OnHTML("script", func(e *colly.HTMLElement) {
+	c.OnHTML(`script[type="application/ld+json"]`, func(e *colly.HTMLElement) {
+		common.ApplyJSONLD(product, common.ParseJSONLD(e.Text))
+	})
+
+	c.OnHTML("script", func(e *colly.HTMLElement) {
 		if jsonFound {
 			return
 		}
@@ -75,7 +81,9 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 						if err := json.Unmarshal([]byte(jsonStr), &data); err == nil {
 							product.Name = data.Name
 							product.Price = data.Price
-							product.Currency = data.Currency
+							if data.Currency != "" {
+								product.Currency = data.Currency
+							}
 							jsonFound = true
 							product.IsAvailable = true
 						}
@@ -88,7 +96,7 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 	// Availability & Labels
 	// Keywords: "Mengenrabatt", "AKTION", "Billiger", "Filiale"
 
-	s.Collector.OnHTML("body", func(e *colly.HTMLElement) {
+	c.OnHTML("body", func(e *colly.HTMLElement) {
 		fullText := e.Text
 
 		if strings.Contains(fullText, "Mengenrabatt") {
@@ -131,21 +139,21 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 	})
 
 	// Check for old price (Strikethrough)
-	s.Collector.OnHTML(".ods-price__stroke-price", func(e *colly.HTMLElement) {
+	c.OnHTML(".ods-price__stroke-price", func(e *colly.HTMLElement) {
 		if val := common.ParsePrice(e.Text); val > 0 {
 			product.OldPrice = val
 			product.IsDiscounted = true
 		}
 	})
 
-	log.Printf("Navigating to %s", product.URL)
-	err := s.Collector.Visit(product.URL)
+	log.InfoContext(ctx, "Navigating", "url", product.URL)
+	err := common.Visit(ctx, c, product.URL)
 	if err != nil {
 		return nil, err
 	}
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
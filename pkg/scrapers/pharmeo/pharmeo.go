@@ -3,9 +3,12 @@ package pharmeo
 import (
 	"context"
 	"fmt"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
+	"hunter-base/pkg/tracing"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,39 +18,88 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
+var log = logger.For("scrapers/pharmeo")
+
 const (
 	Source  = "PHARMEO_AT"
 	BaseURL = "https://www.pharmeo.at"
 )
 
 type Scraper struct {
-	BaseURL string
+	BaseURL    string
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
 }
 
 func NewScraper() *Scraper {
 	return &Scraper{
-		BaseURL: BaseURL,
+		BaseURL:    BaseURL,
+		Strategies: []common.Strategy{common.StrategyHTML, common.StrategyBrowser},
 	}
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyHTML:    s.scrapeHTML,
+		common.StrategyBrowser: s.scrapeBrowser,
+	})
+}
+
+// scrapeHTML uses the storefront's server-rendered search page, following the
+// first result when the search does not land on a product directly.
+func (s *Scraper) scrapeHTML(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
 	product := common.NewProduct(Source, productID, s.BaseURL)
 
-	ctx, cancel, err := common.NewUndetectedBrowser(120 * time.Second)
+	doc, finalURL, err := common.FetchDocument(ctx, px, s.BaseURL+"/search?search="+url.QueryEscape(productID))
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Find(".product-detail-information").Length() == 0 {
+		href, ok := doc.Find(".product-list a[href], .search-result a[href]").First().Attr("href")
+		if !ok || href == "" {
+			return nil, common.ErrNoProduct
+		}
+		if strings.HasPrefix(href, "/") {
+			href = s.BaseURL + href
+		}
+		doc, finalURL, err = common.FetchDocument(ctx, px, href)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	product.URL = finalURL
+	common.ApplyJSONLD(product, common.ExtractJSONLD(doc))
+	parseDetailPage(doc, product)
+
+	if product.Name == "" {
+		return nil, common.ErrNoProduct
+	}
+
+	return product, nil
+}
+
+func (s *Scraper) scrapeBrowser(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	product := common.NewProduct(Source, productID, s.BaseURL)
+
+	ctx, cancel, err := common.NewUndetectedBrowser(ctx, px)
 	if err != nil {
 		return nil, err
 	}
 	defer cancel()
 
-	log.Printf("Navigating to %s", s.BaseURL)
+	log.InfoContext(ctx, "Navigating", "url", s.BaseURL)
 
 	var html, finalURL string
 	err = chromedp.Run(ctx,
-		chromedp.Navigate(s.BaseURL),
-		chromedp.WaitVisible(`input#q`, chromedp.ByQuery),
-		chromedp.Clear(`input#q`, chromedp.ByQuery),
-		chromedp.SendKeys(`input#q`, productID+"\n", chromedp.ByQuery),
-		chromedp.ActionFunc(func(execCtx context.Context) error {
+		common.Navigate(s.BaseURL),
+		common.Step("search",
+			chromedp.WaitVisible(`input#q`, chromedp.ByQuery),
+			chromedp.Clear(`input#q`, chromedp.ByQuery),
+			chromedp.SendKeys(`input#q`, productID+"\n", chromedp.ByQuery),
+		),
+		common.Step("wait_for_product", chromedp.ActionFunc(func(execCtx context.Context) error {
 			ticker := time.NewTicker(500 * time.Millisecond)
 			defer ticker.Stop()
 			polls := 0
@@ -75,8 +127,8 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 							`(function() { var a = document.querySelector('.product-list a[href], .search-result a[href]'); return a ? a.href : ''; })()`,
 							&firstLink,
 						).Do(execCtx); err == nil && firstLink != "" {
-							log.Printf("Search returned a list, navigating to first result: %s", firstLink)
-							if err := chromedp.Navigate(firstLink).Do(execCtx); err != nil {
+							log.InfoContext(ctx, "Search returned a list, navigating to first result", "url", firstLink)
+							if err := common.Navigate(firstLink).Do(execCtx); err != nil {
 								return fmt.Errorf("failed to navigate to first result: %w", err)
 							}
 							continue
@@ -88,27 +140,33 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 					}
 				}
 			}
-		}),
-		chromedp.Sleep(2*time.Second),
-		chromedp.Evaluate(`window.location.href`, &finalURL),
-		chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		})),
+		common.Pause(2*time.Second),
+		common.Step("extract",
+			chromedp.Evaluate(`window.location.href`, &finalURL),
+			chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch product page: %w", err)
 	}
 
 	product.URL = finalURL
-	log.Printf("Landed on %s", finalURL)
+	log.InfoContext(ctx, "Landed", "url", finalURL)
+
+	_, span := tracing.Start(ctx, "parse.product")
+	defer span.End()
 
 	doc, err := common.ParseHTML(html)
 	if err != nil {
 		return nil, err
 	}
 
+	common.ApplyJSONLD(product, common.ExtractJSONLD(doc))
 	parseDetailPage(doc, product)
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
@@ -170,7 +228,7 @@ func parseDetailPage(doc *goquery.Document, product *models.Product) {
 		valueText := strings.TrimSpace(valueEl.Find(".product-detail-attributes__attribute-value").Text())
 
 		if strings.Contains(labelText, "PZN") && valueText != "" && valueText != product.ID {
-			log.Printf("PZN mismatch: expected %s, got %s", product.ID, valueText)
+			log.Warn("PZN mismatch", "expected", product.ID, "got", valueText)
 		}
 	})
 
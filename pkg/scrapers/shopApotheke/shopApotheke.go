@@ -2,10 +2,13 @@ package shopApotheke
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
+	"hunter-base/pkg/tracing"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,18 +18,23 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
+var log = logger.For("scrapers/shop-apotheke")
+
 const (
 	Source  = "SHOP_APOTHEKE_AT"
 	BaseURL = "https://www.shop-apotheke.at"
 )
 
 type Scraper struct {
-	BaseURL string
+	BaseURL    string
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
 }
 
 func NewScraper() *Scraper {
 	return &Scraper{
-		BaseURL: BaseURL,
+		BaseURL:    BaseURL,
+		Strategies: []common.Strategy{common.StrategyHTML, common.StrategyBrowser},
 	}
 }
 
@@ -50,40 +58,72 @@ func buildProductURLs(baseURL, pzn string) []string {
 	}
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyHTML:    s.scrapeHTML,
+		common.StrategyBrowser: s.scrapeBrowser,
+	})
+}
+
+// scrapeHTML tries the candidate product URLs over plain HTTP. The search
+// fallback is left to the browser strategy since results render client-side.
+func (s *Scraper) scrapeHTML(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	candidateURLs := buildProductURLs(s.BaseURL, productID)
+
+	// A 404 only means the URL was guessed wrong.
+	var lastErr error = common.ErrNoProduct
+	for _, candidateURL := range candidateURLs {
+		doc, finalURL, err := common.FetchDocument(ctx, px, candidateURL)
+		if err != nil {
+			if !errors.Is(err, models.ErrProductNotFound) {
+				lastErr = err
+			}
+			continue
+		}
+		if doc.Find(`[data-qa-id="product-title"]`).Length() == 0 {
+			continue
+		}
+		product := common.NewProduct(Source, productID, candidateURL)
+		return buildProductFromDoc(ctx, doc, finalURL, product)
+	}
+
+	return nil, lastErr
+}
+
+func (s *Scraper) scrapeBrowser(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
 	candidateURLs := buildProductURLs(s.BaseURL, productID)
 
 	product := common.NewProduct(Source, productID, candidateURLs[0])
 
-	ctx, cancel, err := common.NewUndetectedBrowser(120 * time.Second)
+	ctx, cancel, err := common.NewUndetectedBrowser(ctx, px)
 	if err != nil {
 		return nil, err
 	}
 	defer cancel()
 
 	for _, candidateURL := range candidateURLs {
-		log.Printf("Trying URL: %s", candidateURL)
+		log.InfoContext(ctx, "Trying URL", "url", candidateURL)
 		html, finalURL, err := navigateToProduct(ctx, candidateURL)
 		if err == errNotFound {
-			log.Printf("Not found at %s, trying next", candidateURL)
+			log.InfoContext(ctx, "Not found, trying next URL", "url", candidateURL)
 			continue
 		}
 		if err != nil {
-			log.Printf("Failed at %s: %v, trying next", candidateURL, err)
+			log.WarnContext(ctx, "Failed, trying next URL", "url", candidateURL, "error", err)
 			continue
 		}
-		return buildProduct(html, finalURL, product)
+		return buildProduct(ctx, html, finalURL, product)
 	}
 
-	log.Printf("URL attempts failed, falling back to search for PZN %s", productID)
+	log.InfoContext(ctx, "URL attempts failed, falling back to search", "pzn", productID)
 	html, finalURL, err := searchForProduct(ctx, s.BaseURL, productID)
 	if err != nil {
 		if err == errNotFound {
-			return nil, models.ErrProductNotFound
+			return nil, common.ErrNoProduct
 		}
 		return nil, fmt.Errorf("search fallback failed: %w", err)
 	}
-	return buildProduct(html, finalURL, product)
+	return buildProduct(ctx, html, finalURL, product)
 }
 
 var errNotFound = fmt.Errorf("product not found on page")
@@ -91,13 +131,15 @@ var errNotFound = fmt.Errorf("product not found on page")
 func navigateToProduct(ctx context.Context, url string) (string, string, error) {
 	var html, finalURL string
 	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
-		chromedp.ActionFunc(func(execCtx context.Context) error {
+		common.Navigate(url),
+		common.Step("wait_for_product", chromedp.ActionFunc(func(execCtx context.Context) error {
 			return waitForProductOrError(execCtx)
-		}),
-		chromedp.Sleep(2*time.Second),
-		chromedp.Evaluate(`window.location.href`, &finalURL),
-		chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		})),
+		common.Pause(2*time.Second),
+		common.Step("extract",
+			chromedp.Evaluate(`window.location.href`, &finalURL),
+			chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		),
 	)
 	if err == errNotFound || err == models.ErrProductNotFound {
 		return "", "", errNotFound
@@ -110,12 +152,12 @@ func navigateToProduct(ctx context.Context, url string) (string, string, error)
 
 func searchForProduct(ctx context.Context, baseURL, pzn string) (string, string, error) {
 	searchURL := baseURL + "/search.htm?q=" + pzn
-	log.Printf("Searching: %s", searchURL)
+	log.InfoContext(ctx, "Searching", "url", searchURL)
 
 	var html, finalURL string
 	err := chromedp.Run(ctx,
-		chromedp.Navigate(searchURL),
-		chromedp.ActionFunc(func(execCtx context.Context) error {
+		common.Navigate(searchURL),
+		common.Step("wait_for_search", chromedp.ActionFunc(func(execCtx context.Context) error {
 			ticker := time.NewTicker(500 * time.Millisecond)
 			defer ticker.Stop()
 			polls := 0
@@ -139,8 +181,8 @@ func searchForProduct(ctx context.Context, baseURL, pzn string) (string, string,
 						`(function() { var a = document.querySelector('[data-qa-id="serp-result-item-title"]'); return a ? a.href : ''; })()`,
 						&firstProductHref,
 					).Do(execCtx); err == nil && firstProductHref != "" {
-						log.Printf("Search found result, navigating to: %s", firstProductHref)
-						if err := chromedp.Navigate(firstProductHref).Do(execCtx); err != nil {
+						log.InfoContext(ctx, "Search found result, navigating", "url", firstProductHref)
+						if err := common.Navigate(firstProductHref).Do(execCtx); err != nil {
 							return fmt.Errorf("failed to navigate to search result: %w", err)
 						}
 						return waitForProductOrError(execCtx)
@@ -159,10 +201,12 @@ func searchForProduct(ctx context.Context, baseURL, pzn string) (string, string,
 					}
 				}
 			}
-		}),
-		chromedp.Sleep(2*time.Second),
-		chromedp.Evaluate(`window.location.href`, &finalURL),
-		chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		})),
+		common.Pause(2*time.Second),
+		common.Step("extract",
+			chromedp.Evaluate(`window.location.href`, &finalURL),
+			chromedp.OuterHTML(`html`, &html, chromedp.ByQuery),
+		),
 	)
 	if err == errNotFound {
 		return "", "", errNotFound
@@ -206,19 +250,27 @@ func waitForProductOrError(execCtx context.Context) error {
 	}
 }
 
-func buildProduct(html, finalURL string, product *models.Product) (*models.Product, error) {
-	product.URL = finalURL
-	log.Printf("Landed on %s", finalURL)
+func buildProduct(ctx context.Context, html, finalURL string, product *models.Product) (*models.Product, error) {
+	_, span := tracing.Start(ctx, "parse.product")
+	defer span.End()
 
 	doc, err := common.ParseHTML(html)
 	if err != nil {
 		return nil, err
 	}
 
+	return buildProductFromDoc(ctx, doc, finalURL, product)
+}
+
+func buildProductFromDoc(ctx context.Context, doc *goquery.Document, finalURL string, product *models.Product) (*models.Product, error) {
+	product.URL = finalURL
+	log.InfoContext(ctx, "Landed", "url", finalURL)
+
+	common.ApplyJSONLD(product, common.ExtractJSONLD(doc))
 	parseDetailPage(doc, product)
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
@@ -3,10 +3,14 @@ package spar
 import (
 	"context"
 	"fmt"
+	"hunter-base/pkg/logger"
 	"hunter-base/pkg/models"
+	"hunter-base/pkg/proxy"
 	"hunter-base/pkg/scrapers/common"
-	"log"
+	"hunter-base/pkg/tracing"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,15 +18,117 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
+var log = logger.For("scrapers/spar")
+
 const (
-	Source  = "SPAR"
-	BaseURL = "https://www.spar.at/produktwelt/p"
+	Source       = "SPAR"
+	BaseURL      = "https://www.spar.at/produktwelt/p"
+	SearchAPIURL = "https://search-spar.spar-ics.com/fact-finder/rest/v4/search/products_lmos_at"
 )
 
-type Scraper struct{}
+type Scraper struct {
+	Strategies []common.Strategy
+	Proxies    *proxy.Pool
+}
 
 func NewScraper() *Scraper {
-	return &Scraper{}
+	return &Scraper{
+		Strategies: []common.Strategy{common.StrategyAPI, common.StrategyBrowser},
+	}
+}
+
+func (s *Scraper) Scrape(ctx context.Context, productID string) (*models.Product, error) {
+	return common.RunStrategies(ctx, Source, productID, s.Strategies, s.Proxies, map[common.Strategy]common.StrategyFunc{
+		common.StrategyAPI:     s.scrapeAPI,
+		common.StrategyBrowser: s.scrapeBrowser,
+	})
+}
+
+// sparSearchResponse is the part of the FactFinder search response backing
+// the storefront that we need. Master values are loosely typed, so they are
+// read through stringValue and floatValue.
+type sparSearchResponse struct {
+	Hits []struct {
+		MasterValues map[string]any `json:"masterValues"`
+	} `json:"hits"`
+}
+
+func (s *Scraper) scrapeAPI(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
+	product := common.NewProduct(Source, productID, BaseURL+productID)
+
+	query := url.Values{}
+	query.Set("query", productID)
+	query.Set("q", productID)
+	query.Set("page", "1")
+	query.Set("hitsPerPage", "10")
+
+	var resp sparSearchResponse
+	if err := common.FetchJSON(ctx, px, SearchAPIURL+"?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	for _, hit := range resp.Hits {
+		values := hit.MasterValues
+		if stringValue(values["product-number"]) != productID && stringValue(values["code"]) != productID {
+			continue
+		}
+
+		product.Name = strings.TrimSpace(stringValue(values["title"]))
+		if product.Name == "" {
+			product.Name = strings.TrimSpace(stringValue(values["name"]))
+		}
+
+		if val := floatValue(values["price"]); val > 0 {
+			product.Price = val
+			product.IsAvailable = true
+		}
+		if val := floatValue(values["regular-price"]); val > product.Price && product.Price > 0 {
+			product.OldPrice = val
+			product.IsDiscounted = true
+		}
+		if label := stringValue(values["promotion-text"]); label != "" {
+			product.DiscountLabel = label
+			product.IsDiscounted = true
+		}
+		if path := stringValue(values["url"]); strings.HasPrefix(path, "/") {
+			product.URL = "https://www.spar.at" + path
+		}
+		break
+	}
+
+	if product.Name == "" {
+		return nil, common.ErrNoProduct
+	}
+
+	return product, nil
+}
+
+func stringValue(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case []any:
+		if len(val) > 0 {
+			return stringValue(val[0])
+		}
+	}
+	return ""
+}
+
+func floatValue(v any) float64 {
+	switch val := v.(type) {
+	case float64:
+		return val
+	case string:
+		return common.ParsePrice(val)
+	case []any:
+		if len(val) > 0 {
+			return floatValue(val[0])
+		}
+	}
+	return 0
 }
 
 func sparReadyCheck(ctx context.Context) bool {
@@ -33,59 +139,68 @@ func sparReadyCheck(ctx context.Context) bool {
 	return false
 }
 
-func (s *Scraper) Scrape(productID string) (*models.Product, error) {
+func (s *Scraper) scrapeBrowser(ctx context.Context, productID string, px *proxy.Proxy) (*models.Product, error) {
 	product := common.NewProduct(Source, productID, BaseURL+productID)
 
-	ctx, cancel, err := common.NewUndetectedBrowser(120 * time.Second)
+	ctx, cancel, err := common.NewUndetectedBrowser(ctx, px)
 	if err != nil {
 		return nil, err
 	}
 	defer cancel()
 
 	var name, priceStr, oldPriceStr, articleNumber string
+	var ldScripts []string
 
-	log.Printf("Navigating to %s", product.URL)
+	log.InfoContext(ctx, "Navigating", "url", product.URL)
 
 	err = chromedp.Run(ctx,
-		chromedp.Navigate(product.URL),
+		common.Navigate(product.URL),
 		common.WaitForCloudflare(sparReadyCheck),
-		chromedp.Evaluate(`document.querySelector("h1[data-tosca='pdp-heading']")?.innerText || document.querySelector("h1.heading__title")?.innerText || ""`, &name),
-		chromedp.Evaluate(`document.querySelector(".product-price__price")?.innerText || ""`, &priceStr),
-		chromedp.Evaluate(`document.querySelector(".product-price__price-old")?.innerText || ""`, &oldPriceStr),
-		chromedp.Evaluate(`
-			(function() {
-				const el = document.querySelector(".pdp__meta-entry[data-tosca='pdp-article-number']");
-				return el ? el.innerText : "";
-			})()
-		`, &articleNumber),
+		common.Step("extract",
+			common.JSONLDScripts(&ldScripts),
+			chromedp.Evaluate(`document.querySelector("h1[data-tosca='pdp-heading']")?.innerText || document.querySelector("h1.heading__title")?.innerText || ""`, &name),
+			chromedp.Evaluate(`document.querySelector(".product-price__price")?.innerText || ""`, &priceStr),
+			chromedp.Evaluate(`document.querySelector(".product-price__price-old")?.innerText || ""`, &oldPriceStr),
+			chromedp.Evaluate(`
+				(function() {
+					const el = document.querySelector(".pdp__meta-entry[data-tosca='pdp-article-number']");
+					return el ? el.innerText : "";
+				})()
+			`, &articleNumber),
+		),
 	)
 
 	if err != nil {
-		log.Printf("Chromedp run failed: %v", err)
+		log.WarnContext(ctx, "Chromedp run failed", "error", err)
 
-		if !strings.Contains(err.Error(), "cloudflare") {
-			debugCtx, cancelDebug := context.WithTimeout(ctx, 30*time.Second)
+		settings := common.CurrentSettings()
+		if !strings.Contains(err.Error(), "cloudflare") && settings.DebugDir != "" {
+			// The browser context may already have expired; the capture gets
+			// its own short deadline.
+			debugCtx, cancelDebug := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
 			defer cancelDebug()
 
 			var buf []byte
+			shotFile := filepath.Join(settings.DebugDir, "spar_debug.png")
 			if errShot := chromedp.Run(debugCtx, chromedp.CaptureScreenshot(&buf)); errShot != nil {
-				log.Printf("Failed to capture screenshot: %v", errShot)
+				log.WarnContext(ctx, "Failed to capture screenshot", "error", errShot)
 			} else {
-				if errWrite := os.WriteFile("spar_debug.png", buf, 0644); errWrite != nil {
-					log.Printf("Failed to write screenshot: %v", errWrite)
+				if errWrite := os.WriteFile(shotFile, buf, 0644); errWrite != nil {
+					log.WarnContext(ctx, "Failed to write screenshot", "error", errWrite)
 				} else {
-					log.Println("Screenshot saved to spar_debug.png")
+					log.InfoContext(ctx, "Screenshot saved", "file", shotFile)
 				}
 			}
 
 			var html string
+			htmlFile := filepath.Join(settings.DebugDir, "spar_debug.html")
 			if errHTML := chromedp.Run(debugCtx, chromedp.Evaluate(`document.documentElement.outerHTML`, &html)); errHTML != nil {
-				log.Printf("Failed to capture HTML: %v", errHTML)
+				log.WarnContext(ctx, "Failed to capture HTML", "error", errHTML)
 			} else {
-				if errWrite := os.WriteFile("spar_debug.html", []byte(html), 0644); errWrite != nil {
-					log.Printf("Failed to write HTML: %v", errWrite)
+				if errWrite := os.WriteFile(htmlFile, []byte(html), 0644); errWrite != nil {
+					log.WarnContext(ctx, "Failed to write HTML", "error", errWrite)
 				} else {
-					log.Println("HTML saved to spar_debug.html")
+					log.InfoContext(ctx, "HTML saved", "file", htmlFile)
 				}
 			}
 		}
@@ -93,8 +208,14 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 		return nil, fmt.Errorf("chromedp failed: %w", err)
 	}
 
-	product.Name = strings.TrimSpace(name)
-	product.Name = strings.ReplaceAll(product.Name, "\n", " ")
+	_, span := tracing.Start(ctx, "parse.product")
+	defer span.End()
+
+	common.ApplyJSONLD(product, common.ParseJSONLDScripts(ldScripts))
+
+	if name = strings.TrimSpace(name); name != "" {
+		product.Name = strings.ReplaceAll(name, "\n", " ")
+	}
 
 	if priceStr != "" {
 		priceStr = strings.TrimSpace(priceStr)
@@ -120,13 +241,13 @@ func (s *Scraper) Scrape(productID string) (*models.Product, error) {
 		if len(parts) > 1 {
 			id := strings.TrimSpace(parts[1])
 			if id != productID {
-				fmt.Printf("Warning: Scraped ID %s does not match requested ID %s\n", id, productID)
+				log.WarnContext(ctx, "Scraped ID does not match requested ID", "scraped", id, "requested", productID)
 			}
 		}
 	}
 
 	if product.Name == "" {
-		return nil, models.ErrProductNotFound
+		return nil, common.ErrNoProduct
 	}
 
 	return product, nil
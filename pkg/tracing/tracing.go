@@ -0,0 +1,150 @@
+// Package tracing sets up OpenTelemetry tracing and starts the spans that
+// show where a request spends its time: the HTTP handler, cache lookup,
+// scraper queue, browser launch, each group of browser actions and parsing.
+//
+// Spans are started through Start, which does nothing useful until Setup
+// installs an exporter, so packages can trace unconditionally:
+//
+//	ctx, span := tracing.Start(ctx, "cache.lookup", tracing.Store(store), tracing.Product(id))
+//	defer span.End()
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// DefaultEndpoint is the OTLP/HTTP port of a collector on the same host.
+const DefaultEndpoint = "http://localhost:4318"
+
+// Options configures Setup.
+type Options struct {
+	// Exporter is ExporterNone, ExporterOTLP or ExporterStdout.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL. /v1/traces is added when it
+	// has no path.
+	Endpoint string
+	// SampleRatio is the share of new traces recorded, from 0 to 1.
+	// Requests that arrive with a sampled traceparent are always recorded.
+	SampleRatio float64
+	// Service and Version identify the service in the exported spans.
+	Service string
+	Version string
+	// Stdout is where ExporterStdout writes, os.Stdout if nil.
+	Stdout io.Writer
+}
+
+// tracerName is the instrumentation scope of all spans.
+const tracerName = "hunter-base"
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes buffered spans and stops the
+// exporter; it is a no-op with ExporterNone.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(tracesURL(opts.Endpoint)))
+	case ExporterStdout:
+		stdoutOpts := []stdouttrace.Option{}
+		if opts.Stdout != nil {
+			stdoutOpts = append(stdoutOpts, stdouttrace.WithWriter(opts.Stdout))
+		}
+		exporter, err = stdouttrace.New(stdoutOpts...)
+	default:
+		return nil, fmt.Errorf("unknown exporter %q (use none, otlp or stdout)", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(opts.Service),
+		semconv.ServiceVersion(opts.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// tracesURL adds the OTLP/HTTP traces path to a collector base URL.
+func tracesURL(endpoint string) string {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Path != "" && u.Path != "/") {
+		return endpoint
+	}
+	u.Path = "/v1/traces"
+	return u.String()
+}
+
+// Start starts a span named name as a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartLinked starts a span named name in a new trace linked to the span in
+// from, for work that outlives the request that started it. The span's
+// context is derived from ctx.
+func StartLinked(ctx, from context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithNewRoot(), trace.WithLinks(trace.LinkFromContext(from)), trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, as the span's status and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Store is the store a span works on, e.g. "billa".
+func Store(store string) attribute.KeyValue {
+	return attribute.String("hunter.store", store)
+}
+
+// URL is the URL a span fetches.
+func URL(url string) attribute.KeyValue {
+	return semconv.URLFull(url)
+}
+
+// Product is the product ID a span works on.
+func Product(id string) attribute.KeyValue {
+	return attribute.String("hunter.product_id", id)
+}
@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector stands in for an OpenTelemetry collector's OTLP/HTTP receiver.
+type collector struct {
+	mu    sync.Mutex
+	paths []string
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(raw, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	c.paths = append(c.paths, r.URL.Path)
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+
+	out, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
+
+func (c *collector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// restoreGlobals puts back the global tracer provider and propagator that
+// Setup replaces.
+func restoreGlobals(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+}
+
+func TestOTLPExport(t *testing.T) {
+	restoreGlobals(t)
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	shutdown, err := Setup(context.Background(), Options{
+		Exporter:    ExporterOTLP,
+		Endpoint:    server.URL,
+		SampleRatio: 1,
+		Service:     "hunter-base",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := Start(context.Background(), "GET /stores/{store}/products/{id}")
+	_, child := Start(ctx, "cache.lookup", Store("billa"), Product("00626061"))
+	child.End()
+	_, failed := Start(ctx, "scrape")
+	End(failed, errors.New("blocked"))
+	parent.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(c.paths, "/v1/traces") {
+		t.Errorf("spans posted to %v, want /v1/traces", c.paths)
+	}
+
+	root, lookup, scrape := c.span("GET /stores/{store}/products/{id}"), c.span("cache.lookup"), c.span("scrape")
+	if root == nil || lookup == nil || scrape == nil {
+		t.Fatalf("missing spans, got %d", len(c.spans))
+	}
+	if !bytes.Equal(lookup.ParentSpanId, root.SpanId) || !bytes.Equal(lookup.TraceId, root.TraceId) {
+		t.Error("cache.lookup is not a child of the request span")
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range lookup.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	if attrs["hunter.store"] != "billa" || attrs["hunter.product_id"] != "00626061" {
+		t.Errorf("cache.lookup attributes = %v", attrs)
+	}
+	if scrape.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || scrape.Status.GetMessage() != "blocked" {
+		t.Errorf("scrape status = %v", scrape.Status)
+	}
+}
+
+func TestStdoutExport(t *testing.T) {
+	restoreGlobals(t)
+	var buf bytes.Buffer
+
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterStdout, SampleRatio: 1, Stdout: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "browser.navigate", URL("https://www.billa.at/"))
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := buf.String(); !strings.Contains(out, `"Name":"browser.navigate"`) || !strings.Contains(out, "https://www.billa.at/") {
+		t.Errorf("unexpected stdout export:\n%s", out)
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func TestTracesURL(t *testing.T) {
+	tests := map[string]string{
+		"":                                    "http://localhost:4318/v1/traces",
+		"http://collector:4318":               "http://collector:4318/v1/traces",
+		"https://collector:4318/":             "https://collector:4318/v1/traces",
+		"https://otlp.example.com/api/traces": "https://otlp.example.com/api/traces",
+	}
+	for endpoint, want := range tests {
+		if got := tracesURL(endpoint); got != want {
+			t.Errorf("tracesURL(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
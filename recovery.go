@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/metrics"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Where a panic was recovered, as labelled in metrics.
+const (
+	panicInHandler    = "handler"
+	panicInScrape     = "scrape"
+	panicInBackground = "background"
+)
+
+// errPanic is returned by scrapes that panicked.
+var errPanic = errors.New("unexpected failure")
+
+// logPanic logs a recovered panic with its stack and the request ID of ctx,
+// and counts it for store, which may be empty.
+func logPanic(ctx context.Context, store, where string, v any) {
+	if store == "" {
+		store = "none"
+	}
+	metrics.Panics.WithLabelValues(store, where).Inc()
+	log.ErrorContext(ctx, "Recovered from panic", "store", store, "where", where,
+		"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+}
+
+// guard runs fn and recovers a panic in it, which is logged and counted for
+// store. It reports whether fn returned normally.
+func guard(ctx context.Context, store, where string, fn func()) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			logPanic(ctx, store, where, v)
+		}
+	}()
+	fn()
+	return true
+}
+
+// withRecovery answers a request whose handler panicked, such as a scraper
+// tripping over malformed HTML, with a 500 problem instead of dropping the
+// connection. When the response has already started it can only be cut off.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logPanic(r.Context(), panicStore(r), panicInHandler, v)
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			api.WriteError(w, http.StatusInternalServerError, "Internal Server Error",
+				"The request failed unexpectedly. Quote the request ID when reporting it.", r.URL.Path)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// panicStore is the {store} of r for metrics, if it is a supported one.
+func panicStore(r *http.Request) string {
+	store := strings.ToLower(r.PathValue("store"))
+	if !slices.Contains(supportedStores, store) {
+		return ""
+	}
+	return store
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/logger"
+	"hunter-base/pkg/metrics"
+	"hunter-base/pkg/router"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWithRecovery(t *testing.T) {
+	r := router.New(withRequestID, withRecovery)
+	r.HandleFunc("GET /stores/{store}/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var items []string
+		_ = items[3]
+	})
+	r.HandleFunc("GET /export", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("id,name\n"))
+		panic("broken row")
+	})
+
+	panics := metrics.Panics.WithLabelValues("billa", panicInHandler)
+	before := testutil.ToFloat64(panics)
+
+	req := httptest.NewRequest("GET", "/stores/billa/products/1", nil)
+	req.Header.Set(api.RequestIDHeader, "panic-1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var problem api.ProblemDetails
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.RequestID != "panic-1" || problem.Instance != "/stores/billa/products/1" {
+		t.Errorf("unexpected problem %+v", problem)
+	}
+	if got := testutil.ToFloat64(panics); got != before+1 {
+		t.Errorf("panics: got %v, want %v", got, before+1)
+	}
+
+	// A response that has started cannot become a 500 and is aborted.
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("started response: got panic %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/export", nil))
+}
+
+func TestGoBackgroundRecoversPanics(t *testing.T) {
+	panics := metrics.Panics.WithLabelValues("spar", panicInBackground)
+	before := testutil.ToFloat64(panics)
+
+	var requestID string
+	ctx := logger.WithRequestID(context.Background(), "revalidate-1")
+	if !goBackground(ctx, "spar", func(ctx context.Context) {
+		requestID = logger.RequestID(ctx)
+		var product *struct{ Name string }
+		_ = product.Name
+	}) {
+		t.Fatal("background work refused")
+	}
+
+	wait, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !waitBackground(wait) {
+		t.Fatal("background work did not finish")
+	}
+	if requestID != "revalidate-1" {
+		t.Errorf("request ID = %q, want revalidate-1", requestID)
+	}
+	if got := testutil.ToFloat64(panics); got != before+1 {
+		t.Errorf("panics: got %v, want %v", got, before+1)
+	}
+}
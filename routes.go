@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/auth"
+	"hunter-base/pkg/router"
+	"net/http"
+	"slices"
+	"strings"
+
+	scalargo "github.com/bdpiprava/scalar-go"
+)
+
+// corsExposedHeaders are the response headers scripts on other origins may
+// read.
+const corsExposedHeaders = "X-Request-ID, X-Cache-Status, Age, Retry-After, Content-Disposition"
+
+// newRouter maps the API endpoints onto their handlers. Every request,
+// including 404s and 405s, is traced, logged with its request ID, counted in
+// the metrics, given CORS headers and answered with a 500 if it panics. With
+// auth enabled, product lookups and the admin endpoints need an API key.
+func newRouter() *router.Router {
+	r := router.New(withTracing, withRequestID, instrument, withCORS, withRecovery)
+
+	r.HandleFunc("GET /{$}", docsHandler)
+	r.HandleFunc("GET /healthz", healthzHandler)
+	r.HandleFunc("GET /readyz", readyzHandler)
+	r.HandleFunc("GET /version", versionHandler)
+	r.HandleFunc("GET /metrics", metricsHandler)
+
+	products := r.Group(requireScope(auth.ScopeRead, auth.ScopeScrape))
+	products.HandleFunc("GET /stores/{store}/products/{id}", productHandler)
+	products.HandleFunc("POST /stores/{store}/products/batch", batchProductsHandler)
+
+	admin := r.Group(requireScope(auth.ScopeAdmin))
+	admin.HandleFunc("GET /export", exportHandler)
+	admin.HandleFunc("POST /import", importHandler)
+	admin.HandleFunc("GET /admin/proxies", proxyStatusHandler)
+	admin.HandleFunc("GET /admin/config", configHandler)
+	admin.HandleFunc("GET /admin/cache/stats", cacheStatsHandler)
+	admin.HandleFunc("GET /admin/cache/entries", cacheEntriesHandler)
+	admin.HandleFunc("POST /admin/cache/warmup", cacheWarmupHandler)
+	admin.HandleFunc("POST /admin/cache/retention", cacheRetentionHandler)
+	admin.HandleFunc("POST /admin/cache/vacuum", cacheVacuumHandler)
+	admin.HandleFunc("DELETE /admin/cache/negative", clearNegativeCacheHandler)
+	admin.HandleFunc("DELETE /admin/cache/{store}", purgeStoreHandler)
+	admin.HandleFunc("DELETE /admin/cache/{store}/{id}", purgeProductHandler)
+	admin.HandleFunc("GET /admin/keys", listKeysHandler, withKeyStore)
+	admin.HandleFunc("POST /admin/keys", createKeyHandler, withKeyStore)
+	admin.HandleFunc("DELETE /admin/keys/{id}", revokeKeyHandler, withKeyStore)
+	admin.HandleFunc("GET /admin/keys/{id}/usage", keyUsageHandler, withKeyStore)
+
+	return r
+}
+
+// docsHandler serves the Scalar API reference.
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	html, err := scalargo.NewV2(
+		scalargo.WithSpecDir("./"),
+		scalargo.WithMetaDataOpts(
+			scalargo.WithTitle("Price Deal Hunter API"),
+		),
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, html)
+}
+
+// storeParam returns the {store} path parameter in lower case. It answers
+// 400 and returns false when the store is not supported.
+func storeParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	store := strings.ToLower(r.PathValue("store"))
+	if !slices.Contains(supportedStores, store) {
+		api.WriteBadRequest(w, "Store not supported. Available: "+strings.Join(supportedStores, ", "), r.URL.Path)
+		return "", false
+	}
+	return store, true
+}
+
+// productIDParam returns the digits of the {id} path parameter, e.g.
+// "00626061" for "00-626061". It answers 400 and returns false when there
+// are none.
+func productIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	raw := r.PathValue("id")
+	productID := digitsOnly(raw)
+	if productID == "" {
+		api.WriteBadRequest(w, fmt.Sprintf("Invalid product ID: %s. Must contain at least one digit.", raw), r.URL.Path)
+		return "", false
+	}
+	return productID, true
+}
+
+// withCORS lets browsers on the configured origins call the API. Preflight
+// requests reach the router, which answers OPTIONS with the allowed methods.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origins := appConfig.Server.CORSOrigins
+		if len(origins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		anyOrigin := slices.Contains(origins, "*")
+		if !anyOrigin {
+			h.Add("Vary", "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		if origin != "" && (anyOrigin || slices.Contains(origins, origin)) {
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, DELETE, OPTIONS")
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				h.Set("Access-Control-Max-Age", "600")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
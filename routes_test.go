@@ -0,0 +1,46 @@
+package main
+
+import (
+	"hunter-base/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	defer func(cfg *config.Config) { appConfig = cfg }(appConfig)
+	appConfig = config.Default(supportedStores)
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/stores/billa/products/batch", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := preflight("https://app.example.com"); rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers sent without configured origins")
+	}
+
+	appConfig.Server.CORSOrigins = []string{"https://app.example.com"}
+	rr := preflight("https://app.example.com")
+	h := rr.Header()
+	if rr.Code != http.StatusNoContent || h.Get("Allow") != "OPTIONS, POST" {
+		t.Errorf("preflight: got %d, Allow %q", rr.Code, h.Get("Allow"))
+	}
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Headers") != "content-type" || h.Get("Vary") != "Origin" {
+		t.Errorf("preflight: unexpected CORS headers %v", h)
+	}
+
+	if rr := preflight("https://evil.example.com"); rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers sent to an origin that is not allowed")
+	}
+
+	appConfig.Server.CORSOrigins = []string{"*"}
+	if rr := preflight("https://evil.example.com"); rr.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("wildcard: got Access-Control-Allow-Origin %q", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
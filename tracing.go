@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"hunter-base/pkg/api"
+	"hunter-base/pkg/metrics"
+	"hunter-base/pkg/tracing"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// configureTracing installs the configured span exporter. The returned
+// function flushes the spans not exported yet.
+func configureTracing(ctx context.Context) (func(context.Context) error, error) {
+	opts := appConfig.Tracing.Options()
+	opts.Service, opts.Version = "hunter-base", buildInfo().Version
+	return tracing.Setup(ctx, opts)
+}
+
+// withTracing serves every request in a span named after its method and
+// route, continuing the trace of an incoming traceparent header.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeOf(r)
+		ctx, span := tracing.Start(ctx, r.Method+" "+route,
+			semconv.HTTPRequestMethodKey.String(methodLabel(r.Method)),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(r.URL.Path),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(rec.code()),
+			attribute.String("hunter.request_id", w.Header().Get(api.RequestIDHeader)),
+		)
+		if rec.code() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.code()))
+		}
+	})
+}
+
+// countCacheStatus records the cache status a product lookup was answered
+// with, in the metrics and on the request's span.
+func countCacheStatus(ctx context.Context, store, status string) {
+	metrics.CacheRequests.WithLabelValues(store, status).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("hunter.cache_status", status))
+}
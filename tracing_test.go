@@ -0,0 +1,73 @@
+package main
+
+import (
+	"hunter-base/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWithTracing(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	productCache = newTestCache(t)
+	productCache.Set("billa", "00626061", &models.Product{Source: "BILLA", ID: "00626061", Name: "Milk", ScrapedAt: time.Now()})
+	handler := newRouter()
+
+	req := httptest.NewRequest("GET", "/stores/billa/products/00626061?cache_only=true", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Request-ID", "abc123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d", rr.Code)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	root, ok := spans["GET /stores/{store}/products/{id}"]
+	if !ok {
+		t.Fatalf("no request span in %v", exporter.GetSpans())
+	}
+	if got := root.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("request span did not continue the incoming trace, got trace %s", got)
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range root.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["hunter.cache_status"].AsString(); got != "hit" {
+		t.Errorf("cache status = %q, want hit", got)
+	}
+	if got := attrs["hunter.request_id"].AsString(); got != "abc123" {
+		t.Errorf("request ID = %q, want abc123", got)
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("status code = %d", got)
+	}
+
+	lookup, ok := spans["cache.lookup"]
+	if !ok {
+		t.Fatal("no cache.lookup span")
+	}
+	if lookup.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Error("cache.lookup is not a child of the request span")
+	}
+}